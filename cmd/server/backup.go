@@ -0,0 +1,54 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/iamgp/hvr/internal/backup"
+)
+
+func backupCommand(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s backup <dest>\n\nWrites a snapshot of the registry to the new directory dest. Safe to run while the server is running.\n", os.Args[0])
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db, _, err := openStorage()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	info, err := backup.Create(db, fileStoreDir, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backed up %d library versions (%d bytes) to %s\n", info.Libraries, info.Bytes, fs.Arg(0))
+	return nil
+}
+
+func restoreCommand(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s restore <src>\n\nReplaces the registry data with the snapshot in src after checking it. Stop the server first.\n", os.Args[0])
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	info, err := backup.Restore(fs.Arg(0), dbPath, fileStoreDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %d library versions from the backup taken %s\n", info.Libraries, info.Created.Local().Format("2006-01-02 15:04"))
+	fmt.Printf("The previous data was kept as %s.pre-restore and %s.pre-restore\n", dbPath, fileStoreDir)
+	return nil
+}
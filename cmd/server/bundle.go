@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/bundle"
+)
+
+func exportCommand(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	selection := fs.String("libraries", "", "Libraries to export, as comma-separated name[@constraint] patterns (\"*\" for all)")
+	out := fs.String("out", "", "Bundle file to write")
+	noDeps := fs.Bool("no-deps", false, "Don't add the versions the selected libraries depend on")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s export --libraries <selector> --out <bundle.tar> [--no-deps]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if *selection == "" || *out == "" || fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	selectors, err := bundle.ParseSelectors(*selection)
+	if err != nil {
+		return err
+	}
+
+	s, closeStorage, err := openService()
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	// Written next to the destination and renamed, so an interrupted export
+	// never leaves a truncated bundle behind.
+	tmp, err := os.CreateTemp(filepath.Dir(*out), ".bundle-*.tar")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	manifest, err := s.Export(tmp, selectors, !*noDeps)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), *out); err != nil {
+		return err
+	}
+
+	for _, lib := range manifest.Libraries {
+		fmt.Printf("Exported %s %s (sha256 %s)\n", lib.Name, lib.Version, lib.Hash)
+	}
+	fmt.Printf("Wrote %d library versions to %s\n", len(manifest.Libraries), *out)
+	return nil
+}
+
+func importCommand(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	check := fs.Bool("check", false, "Only verify the bundle against this registry, import nothing")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import [--check] <bundle.tar>\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	b, err := bundle.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+	fmt.Printf("Bundle %s created %s: %d library versions, all hashes verified\n",
+		fs.Arg(0), b.Manifest.Created.Local().Format("2006-01-02 15:04"), len(b.Manifest.Libraries))
+
+	s, closeStorage, err := openService()
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	statuses, err := s.Import(audit.LocalActor(), b, *check)
+	var added, present int
+	for _, st := range statuses {
+		switch {
+		case st.Present:
+			present++
+			fmt.Printf("Already present %s %s\n", st.Name, st.Version)
+		case *check:
+			added++
+			fmt.Printf("Would import %s %s\n", st.Name, st.Version)
+		default:
+			added++
+			fmt.Printf("Imported %s %s\n", st.Name, st.Version)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if *check {
+		fmt.Printf("%d to import, %d already present\n", added, present)
+	} else {
+		fmt.Printf("%d imported, %d already present\n", added, present)
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/iamgp/hvr/internal/metrics"
+	"github.com/iamgp/hvr/internal/services"
+)
+
+const defaultGCGrace = 24 * time.Hour
+
+func fsckCommand(args []string) error {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	gc := fs.Bool("gc", false, "Remove orphaned files older than the grace period")
+	grace := fs.Duration("grace", defaultGCGrace, "Only remove orphans last modified longer ago than this")
+	jsonOutput := fs.Bool("json", false, "Print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s fsck [--gc] [--grace 24h] [--json]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() > 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	s, closeStorage, err := openService()
+	if err != nil {
+		return err
+	}
+	defer closeStorage()
+
+	report, err := s.Fsck(*gc, *grace)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printFsckReport(report, *gc)
+	}
+
+	if len(report.Problems) > 0 {
+		return fmt.Errorf("found %d damaged library versions", len(report.Problems))
+	}
+	if report.AuditError != "" {
+		return fmt.Errorf("the audit log has been tampered with")
+	}
+	return nil
+}
+
+func printFsckReport(report *services.FsckReport, gc bool) {
+	for _, p := range report.Problems {
+		fmt.Println(p)
+	}
+
+	removed := make(map[string]bool, len(report.Removed))
+	for _, path := range report.Removed {
+		removed[path] = true
+	}
+	for _, o := range report.Orphans {
+		switch {
+		case removed[o.Path]:
+			fmt.Printf("Removed orphan %s (%d bytes)\n", o.Path, o.Size)
+		case gc:
+			fmt.Printf("Orphan %s (%d bytes, modified %s) is within the grace period\n", o.Path, o.Size, o.ModTime.Local().Format("2006-01-02 15:04"))
+		default:
+			fmt.Printf("Orphan %s (%d bytes, modified %s)\n", o.Path, o.Size, o.ModTime.Local().Format("2006-01-02 15:04"))
+		}
+	}
+
+	if report.AuditError != "" {
+		fmt.Println(report.AuditError)
+	} else {
+		fmt.Printf("Verified the hash chain of %d audit log entries\n", report.AuditEntries)
+	}
+
+	fmt.Printf("Checked %d archives (%d bytes) in %s: %d problems, %d orphans, %d removed\n",
+		report.Checked, report.Bytes, report.Duration.Round(time.Millisecond), len(report.Problems), len(report.Orphans), len(report.Removed))
+}
+
+// fsckMetrics exposes the results of scheduled checks.
+type fsckMetrics struct {
+	lastRun  *metrics.Gauge
+	duration *metrics.Gauge
+	checked  *metrics.Gauge
+	missing  *metrics.Gauge
+	corrupt  *metrics.Gauge
+	invalid  *metrics.Gauge
+	orphans  *metrics.Gauge
+	audit    *metrics.Gauge
+	removed  *metrics.Counter
+	failures *metrics.Counter
+}
+
+func newFsckMetrics(r *metrics.Registry) *fsckMetrics {
+	return &fsckMetrics{
+		lastRun:  r.NewGauge("hvr_fsck_last_run_timestamp_seconds", "Time the last storage check finished."),
+		duration: r.NewGauge("hvr_fsck_duration_seconds", "Duration of the last storage check."),
+		checked:  r.NewGauge("hvr_fsck_checked_archives", "Archives hashed by the last storage check."),
+		missing:  r.NewGauge("hvr_fsck_missing_archives", "Library versions whose archive was missing in the last storage check."),
+		corrupt:  r.NewGauge("hvr_fsck_corrupt_archives", "Archives that did not match their hash in the last storage check."),
+		invalid:  r.NewGauge("hvr_fsck_invalid_records", "Unusable library records found by the last storage check."),
+		orphans:  r.NewGauge("hvr_fsck_orphaned_files", "Files with no library record found by the last storage check."),
+		audit:    r.NewGauge("hvr_fsck_audit_chain_broken", "1 if the last storage check found the audit log hash chain broken, 0 otherwise."),
+		removed:  r.NewCounter("hvr_fsck_orphans_removed_total", "Orphaned files removed by garbage collection."),
+		failures: r.NewCounter("hvr_fsck_failures_total", "Storage checks that could not run to completion."),
+	}
+}
+
+func (m *fsckMetrics) observe(report *services.FsckReport) {
+	counts := make(map[string]int)
+	for _, p := range report.Problems {
+		counts[p.Kind]++
+	}
+
+	m.lastRun.Set(float64(time.Now().Unix()))
+	m.duration.Set(report.Duration.Seconds())
+	m.checked.Set(float64(report.Checked))
+	m.missing.Set(float64(counts[services.ProblemMissing]))
+	m.corrupt.Set(float64(counts[services.ProblemCorrupt]))
+	m.invalid.Set(float64(counts[services.ProblemInvalid]))
+	m.orphans.Set(float64(len(report.Orphans) - len(report.Removed)))
+	if report.AuditError != "" {
+		m.audit.Set(1)
+	} else {
+		m.audit.Set(0)
+	}
+	m.removed.Add(float64(len(report.Removed)))
+}
+
+// scheduleFsck checks the storage every interval until ctx is done, logging
+// what it finds and recording it in m.
+func scheduleFsck(ctx context.Context, s *services.LibraryService, interval time.Duration, gc bool, grace time.Duration, m *fsckMetrics) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := s.Fsck(gc, grace)
+		if err != nil {
+			m.failures.Inc()
+			slog.Error("storage check failed", "error", err)
+			continue
+		}
+		m.observe(report)
+		for _, p := range report.Problems {
+			slog.Warn("storage check found a problem", "kind", p.Kind, "library", p.Name, "version", p.Version, "path", p.Path, "message", p.Message)
+		}
+		if report.AuditError != "" {
+			slog.Error("audit log hash chain is broken", "error", report.AuditError)
+		}
+		slog.Info("storage check finished", "checked", report.Checked,
+			"problems", len(report.Problems), "orphans", len(report.Orphans), "removed", len(report.Removed))
+	}
+}
@@ -1,25 +1,97 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	"github.com/iamgp/hvr/internal/api/handlers"
+	"github.com/iamgp/hvr/internal/certs"
+	"github.com/iamgp/hvr/internal/logging"
+	"github.com/iamgp/hvr/internal/metrics"
 	"github.com/iamgp/hvr/internal/services"
 	"github.com/iamgp/hvr/internal/storage"
+	"github.com/iamgp/hvr/internal/upstream"
+	"github.com/iamgp/hvr/internal/webhook"
 )
 
-func indexHandler(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, "Welcome to Hamilton Venus Registry!")
+const (
+	dbPath       = "./hvpm.db"
+	fileStoreDir = "./library_files"
+)
+
+// commands are the maintenance subcommands of hvr-server. Anything else on
+// the command line starts the server.
+var commands = map[string]struct {
+	run   func(args []string) error
+	usage string
+}{
+	"export":  {exportCommand, "Write libraries to a bundle for transfer to another registry"},
+	"import":  {importCommand, "Add the libraries of a bundle to this registry"},
+	"backup":  {backupCommand, "Take a consistent snapshot of the registry"},
+	"restore": {restoreCommand, "Replace the registry data with a snapshot"},
+	"fsck":    {fsckCommand, "Check stored archives and remove orphaned files"},
 }
 
 func main() {
-	port := "8080" // default port
 	if len(os.Args) > 1 {
-		port = os.Args[1]
+		if c, ok := commands[os.Args[1]]; ok {
+			if err := c.run(os.Args[2:]); err != nil {
+				log.Fatalf("%s: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
+	serve()
+}
+
+func serve() {
+	upstreamURL := flag.String("upstream", os.Getenv("HVR_UPSTREAM"), "URL of an upstream registry to proxy libraries from (env HVR_UPSTREAM)")
+	fsckInterval := flag.Duration("fsck-interval", 0, "Check stored archives this often, e.g. 24h (0 disables)")
+	fsckGC := flag.Bool("fsck-gc", false, "Remove orphaned files during scheduled checks")
+	gcGrace := flag.Duration("gc-grace", defaultGCGrace, "Only remove orphans last modified longer ago than this")
+	logFormat := flag.String("log-format", envOr("HVR_LOG_FORMAT", "text"), "Log format, text or json (env HVR_LOG_FORMAT)")
+	logLevel := flag.String("log-level", envOr("HVR_LOG_LEVEL", "info"), "Log level, debug, info, warn or error (env HVR_LOG_LEVEL)")
+	readTimeout := flag.Duration("read-timeout", 5*time.Minute, "Maximum time to read a request, including an uploaded archive")
+	writeTimeout := flag.Duration("write-timeout", 5*time.Minute, "Maximum time to write a response, including a downloaded archive")
+	idleTimeout := flag.Duration("idle-timeout", 2*time.Minute, "Close keep-alive connections idle for longer than this")
+	tlsCert := flag.String("tls-cert", os.Getenv("HVR_TLS_CERT"), "Serve HTTPS with this PEM certificate, reloaded on SIGHUP (env HVR_TLS_CERT)")
+	tlsKey := flag.String("tls-key", os.Getenv("HVR_TLS_KEY"), "PEM key of -tls-cert (env HVR_TLS_KEY)")
+	clientCA := flag.String("client-ca", os.Getenv("HVR_CLIENT_CA"), "Verify client certificates against the CAs in this PEM bundle (env HVR_CLIENT_CA)")
+	clientAuth := flag.String("client-auth", "require", "With -client-ca, whether clients must present a certificate: require or optional")
+	upstreamCA := flag.String("upstream-ca", "", "Trust the CAs in this PEM bundle for the upstream, as well as the system ones")
+	upstreamCert := flag.String("upstream-cert", "", "Present this PEM client certificate to the upstream")
+	upstreamKey := flag.String("upstream-key", "", "PEM key of -upstream-cert")
+	upstreamTimeout := flag.Duration("upstream-timeout", upstream.DefaultTimeout, "Wait this long for the upstream to answer before using local data")
+	admins := flag.String("admins", os.Getenv("HVR_ADMINS"), "Comma-separated users, identified by their client certificates, allowed to manage webhooks (env HVR_ADMINS)")
+	webhookAllowLocal := flag.Bool("webhook-allow-local", false, "Allow webhooks to loopback and link-local addresses")
+	shutdownTimeout := flag.Duration("shutdown-timeout", 30*time.Second, "On SIGINT or SIGTERM, wait this long for requests in progress to finish")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintf(out, "Usage: %s [flags] [port]\n       %s <command> [flags]\n\nCommands:\n", os.Args[0], os.Args[0])
+		for _, name := range []string{"export", "import", "backup", "restore", "fsck"} {
+			fmt.Fprintf(out, "  %-10s %s\n", name, commands[name].usage)
+		}
+		fmt.Fprintf(out, "\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	port := "8080" // default port
+	if flag.NArg() > 0 {
+		port = flag.Arg(0)
 	}
 
 	// Validate the port
@@ -27,25 +99,160 @@ func main() {
 		log.Fatalf("Invalid port number: %s", port)
 	}
 
-	db, err := storage.NewSQLiteDatabase("./hvpm.db")
+	logger, err := logging.New(os.Stderr, *logFormat, *logLevel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	slog.SetDefault(logger)
+
+	// The first SIGINT or SIGTERM shuts the server down gracefully; a
+	// second one stops it at once.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	db, fileStore, err := openStorage()
+	if err != nil {
+		log.Fatal(err)
+	}
+	libraryService, dispatcher := newService(db, fileStore)
+	libraryService.SetAdmins(splitList(*admins))
+	libraryService.SetAllowLocalWebhooks(*webhookAllowLocal)
+	dispatcher.AllowLocal = *webhookAllowLocal
+
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		dispatcher.Run(ctx)
+	}()
+
+	if *upstreamURL != "" {
+		client := upstream.NewClient(*upstreamURL)
+		client.SetTimeout(*upstreamTimeout)
+		tlsConfig, err := certs.ClientConfig(*upstreamCA, *upstreamCert, *upstreamKey)
+		if err != nil {
+			log.Fatalf("Invalid upstream TLS settings: %v", err)
+		}
+		if tlsConfig != nil {
+			client.SetTLSConfig(tlsConfig)
+		}
+		libraryService.SetUpstream(client)
+		slog.Info("proxying libraries from upstream", "upstream", *upstreamURL)
+	}
+
+	registry := metrics.NewRegistry()
+	instrument(registry, libraryService, db)
+	if *fsckInterval > 0 {
+		m := newFsckMetrics(registry)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			scheduleFsck(ctx, libraryService, *fsckInterval, *fsckGC, *gcGrace, m)
+		}()
+		slog.Info("checking storage periodically", "interval", *fsckInterval, "gc", *fsckGC)
+	}
+
+	var draining atomic.Bool
+	router := handlers.NewRouter(libraryService, handlers.RouterOptions{Draining: &draining, Metrics: registry.Handler()})
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handlers.LogRequests(handlers.Instrument(router, handlers.NewHTTPMetrics(registry))),
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       *readTimeout,
+		WriteTimeout:      *writeTimeout,
+		IdleTimeout:       *idleTimeout,
+	}
+
+	if *tlsCert != "" || *tlsKey != "" {
+		reloader, requireClientCert, err := newReloader(*tlsCert, *tlsKey, *clientCA, *clientAuth)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.TLSConfig = reloader.TLSConfig(requireClientCert)
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			reloadOnHangup(ctx, reloader)
+		}()
+		if *clientCA != "" {
+			slog.Info("serving HTTPS with client certificates", "client_ca", *clientCA, "client_auth", *clientAuth)
+		} else {
+			slog.Info("serving HTTPS")
+		}
+	} else if *clientCA != "" {
+		log.Fatal("-client-ca needs -tls-cert and -tls-key")
+	}
+
+	slog.Info("server starting", "addr", server.Addr)
+	err = runServer(ctx, server, &draining, &workers, *shutdownTimeout)
+	if errors.Is(err, errStillRunning) {
+		// Closing the database under them could lose their writes; SQLite
+		// rolls back whatever they leave unfinished when it is next opened.
+		slog.Error("exiting without closing the database", "error", err)
+		os.Exit(1)
+	}
+	if closeErr := db.Close(); closeErr != nil {
+		slog.Error("failed to close database", "error", closeErr)
+	}
 	if err != nil {
-		log.Fatalf("Failed to initialize database: %v", err)
+		slog.Error("server stopped", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("server stopped")
+}
+
+// envOr returns the environment variable key, or def when it is unset.
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
 	}
-	defer db.Close()
+	return def
+}
 
-	fileStore, err := storage.NewLocalFileStore("./library_files")
+// splitList returns the non-empty, trimmed elements of a comma-separated
+// list.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// openService opens the registry database and file store in the working
+// directory.
+func openService() (*services.LibraryService, func(), error) {
+	db, fileStore, err := openStorage()
 	if err != nil {
-		log.Fatalf("Failed to initialize file store: %v", err)
+		return nil, nil, err
 	}
+	s, _ := newService(db, fileStore)
+	return s, func() { db.Close() }, nil
+}
 
-	libraryService := services.NewLibraryService(db, fileStore)
+// newService returns the registry service and the dispatcher that delivers
+// its webhook events. Commands other than the server only queue events; the
+// running server delivers them.
+func newService(db *storage.SQLiteDatabase, fileStore storage.FileStore) (*services.LibraryService, *webhook.Dispatcher) {
+	s := services.NewLibraryService(db, fileStore)
+	dispatcher := webhook.NewDispatcher(db)
+	s.SetNotifier(dispatcher)
+	return s, dispatcher
+}
 
-	http.HandleFunc("/", indexHandler)
-	http.HandleFunc("/upload", handlers.UploadHandler(libraryService))
-	http.HandleFunc("/download", handlers.DownloadHandler(libraryService))
-	http.HandleFunc("/search", handlers.SearchHandler(libraryService))
-	http.HandleFunc("/resolve", handlers.ResolveDependenciesHandler(libraryService))
+func openStorage() (*storage.SQLiteDatabase, *storage.LocalFileStore, error) {
+	db, err := storage.NewSQLiteDatabase(dbPath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to initialize database: %w", err)
+	}
 
-	log.Printf("Server starting on :%s", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+	fileStore, err := storage.NewLocalFileStore(fileStoreDir)
+	if err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("Failed to initialize file store: %w", err)
+	}
+	return db, fileStore, nil
 }
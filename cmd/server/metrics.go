@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/iamgp/hvr/internal/metrics"
+	"github.com/iamgp/hvr/internal/services"
+	"github.com/iamgp/hvr/internal/storage"
+)
+
+// instrument records dependency resolutions, database operations and the
+// size of the registry in r.
+func instrument(r *metrics.Registry, s *services.LibraryService, db *storage.SQLiteDatabase) {
+	resolveDuration := r.NewHistogram("hvr_resolve_duration_seconds", "Time to resolve dependencies.", metrics.DefaultBuckets)
+	resolveFailures := r.NewCounter("hvr_resolve_failures_total", "Dependency resolutions that failed.")
+	s.SetResolveObserver(func(d time.Duration, err error) {
+		resolveDuration.Observe(d.Seconds())
+		if err != nil {
+			resolveFailures.Inc()
+		}
+	})
+
+	queryDuration := r.NewHistogramVec("hvr_db_query_duration_seconds", "Time of database operations by operation.", metrics.DefaultBuckets, "operation")
+	db.SetQueryObserver(func(ctx context.Context, operation string, d time.Duration) {
+		queryDuration.With(operation).Observe(d.Seconds())
+		slog.DebugContext(ctx, "database operation", "operation", operation, "duration", d)
+	})
+
+	libraries := r.NewGauge("hvr_libraries", "Libraries in the registry.")
+	versions := r.NewGauge("hvr_library_versions", "Library versions in the registry.")
+	storedFiles := r.NewGauge("hvr_storage_files", "Files in the file store.")
+	storedBytes := r.NewGauge("hvr_storage_bytes", "Bytes of the files in the file store.")
+	r.OnScrape(func() {
+		stats, err := s.Stats()
+		if err != nil {
+			slog.Error("failed to collect registry size", "error", err)
+			return
+		}
+		libraries.Set(float64(stats.Libraries))
+		versions.Set(float64(stats.Versions))
+		storedFiles.Set(float64(stats.StoredFiles))
+		storedBytes.Set(float64(stats.StoredBytes))
+	})
+}
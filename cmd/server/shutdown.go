@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// readHeaderTimeout bounds how long a client may take to send request
+// headers, whatever the other timeouts are.
+const readHeaderTimeout = 10 * time.Second
+
+// lingerTimeout is how long handlers cut off at the shutdown deadline and
+// background workers get to return before the server gives up on them.
+const lingerTimeout = 5 * time.Second
+
+// errStillRunning is returned by runServer when handlers or background
+// workers didn't return, so the storage they use must be left open.
+var errStillRunning = errors.New("requests or background work still running after shutdown")
+
+// runServer serves until ctx is done. It then sets draining, stops accepting
+// connections and waits up to timeout for in-flight requests and the
+// background workers, which stop when ctx is done, to finish. Requests still
+// running at the deadline are cut off, but their handlers keep running until
+// they notice; if they or the workers haven't returned lingerTimeout later,
+// runServer returns errStillRunning.
+func runServer(ctx context.Context, server *http.Server, draining *atomic.Bool, workers *sync.WaitGroup, timeout time.Duration) error {
+	var requests sync.WaitGroup
+	server.Handler = trackRequests(server.Handler, &requests)
+
+	errc := make(chan error, 1)
+	go func() {
+		if server.TLSConfig != nil {
+			errc <- server.ListenAndServeTLS("", "")
+		} else {
+			errc <- server.ListenAndServe()
+		}
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("shutting down, draining requests", "timeout", timeout)
+	draining.Store(true)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("cutting off requests still running at the shutdown deadline", "error", err)
+		server.Close()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		requests.Wait()
+		workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-shutdownCtx.Done():
+	}
+	slog.Warn("requests or background work still running at the shutdown deadline", "wait", lingerTimeout)
+	select {
+	case <-done:
+		return nil
+	case <-time.After(lingerTimeout):
+		return errStillRunning
+	}
+}
+
+// trackRequests adds every request h serves to requests while it runs.
+func trackRequests(h http.Handler, requests *sync.WaitGroup) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		defer requests.Done()
+		h.ServeHTTP(w, r)
+	})
+}
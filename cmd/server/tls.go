@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/iamgp/hvr/internal/certs"
+)
+
+// clientAuthModes are the values of -client-auth, by whether they require
+// a client certificate.
+var clientAuthModes = map[string]bool{"require": true, "optional": false}
+
+// newReloader loads the server certificate, and the client CAs when client
+// certificates are verified.
+func newReloader(certFile, keyFile, clientCAFile, clientAuth string) (*certs.Reloader, bool, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, false, fmt.Errorf("-tls-cert and -tls-key must be given together")
+	}
+	require, ok := clientAuthModes[clientAuth]
+	if !ok {
+		return nil, false, fmt.Errorf("invalid -client-auth %q, expected require or optional", clientAuth)
+	}
+	r, err := certs.NewReloader(certFile, keyFile, clientCAFile)
+	if err != nil {
+		return nil, false, err
+	}
+	return r, require, nil
+}
+
+// reloadOnHangup reads the certificates again on every SIGHUP until ctx is
+// done.
+func reloadOnHangup(ctx context.Context, r *certs.Reloader) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		if err := r.Reload(); err != nil {
+			slog.Error("failed to reload certificates, keeping the current ones", "error", err)
+			continue
+		}
+		slog.Info("reloaded certificates")
+	}
+}
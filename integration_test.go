@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
@@ -55,6 +56,14 @@ func TestClientServerIntegration(t *testing.T) {
 	}
 	defer os.RemoveAll(tempDir)
 
+	// Keep the client's download cache out of the user's cache directory
+	configPath := filepath.Join(tempDir, "config.json")
+	configData := fmt.Sprintf(`{"cache_dir": %q}`, filepath.Join(tempDir, "cache"))
+	if err := os.WriteFile(configPath, []byte(configData), 0644); err != nil {
+		t.Fatalf("Failed to write client config: %v", err)
+	}
+	t.Setenv("HVR_CONFIG", configPath)
+
 	tests := []struct {
 		name           string
 		args           []string
@@ -80,8 +89,27 @@ func TestClientServerIntegration(t *testing.T) {
 				t.Errorf("Downloaded file not found: %s", expectedFile)
 			}
 		}},
-		{"Install", []string{"install", "test-lib", "1.0.0"}, false, "Library test-lib version 1.0.0 installed successfully", nil},
-		// Remove the "Uninstall" test if the command doesn't exist
+		{"Install", []string{"install", "test-lib", "1.0.0", "--venus-root", filepath.Join(tempDir, "HAMILTON")}, false, "Library test-lib version 1.0.0 installed successfully", func(t *testing.T, output string) {
+			expectedFile := filepath.Join(tempDir, "HAMILTON", "Library", "lib-a.hsl")
+			if _, err := os.Stat(expectedFile); os.IsNotExist(err) {
+				t.Errorf("Installed file not found: %s", expectedFile)
+			}
+		}},
+		{"List", []string{"list", "--venus-root", filepath.Join(tempDir, "HAMILTON")}, false, "test-lib (1.0.0)", nil},
+		{"Uninstall", []string{"uninstall", "test-lib", "--venus-root", filepath.Join(tempDir, "HAMILTON")}, false, "Library test-lib version 1.0.0 uninstalled", func(t *testing.T, output string) {
+			removedFile := filepath.Join(tempDir, "HAMILTON", "Library", "lib-a.hsl")
+			if _, err := os.Stat(removedFile); !os.IsNotExist(err) {
+				t.Errorf("Uninstalled file still present: %s", removedFile)
+			}
+		}},
+		{"Rollback", []string{"rollback", "--venus-root", filepath.Join(tempDir, "HAMILTON")}, false, "Rolled back uninstall test-lib 1.0.0", func(t *testing.T, output string) {
+			restoredFile := filepath.Join(tempDir, "HAMILTON", "Library", "lib-a.hsl")
+			if _, err := os.Stat(restoredFile); err != nil {
+				t.Errorf("Rolled back file not restored: %s", restoredFile)
+			}
+		}},
+		{"Cache List", []string{"cache", "list"}, false, "test-lib 1.0.0", nil},
+		{"Install Offline", []string{"install", "test-lib", "--offline", "--venus-root", filepath.Join(tempDir, "OFFLINE")}, false, "Using cached test-lib 1.0.0", nil},
 	}
 
 	for _, tt := range tests {
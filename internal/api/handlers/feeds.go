@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iamgp/hvr/internal/feed"
+	"github.com/iamgp/hvr/internal/models"
+	"github.com/iamgp/hvr/internal/services"
+)
+
+const (
+	defaultFeedLimit = 50
+	maxFeedLimit     = 500
+)
+
+// FeedHandler serves feeds of recently published versions in Atom and JSON
+// Feed format: /feeds/releases.atom and /feeds/releases.json for every
+// library, /feeds/libraries/{name}.atom and /feeds/libraries/{name}.json
+// for one.
+func FeedHandler(s *services.LibraryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, "/feeds/")
+		ext := strings.ToLower(rest[strings.LastIndex(rest, ".")+1:])
+		if ext != "atom" && ext != "json" {
+			http.NotFound(w, r)
+			return
+		}
+		rest = strings.TrimSuffix(rest, "."+ext)
+
+		var name string
+		switch {
+		case rest == "releases":
+		case strings.HasPrefix(rest, "libraries/") && len(rest) > len("libraries/"):
+			name = strings.TrimPrefix(rest, "libraries/")
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		limit := defaultFeedLimit
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, maxFeedLimit)
+		}
+
+		releases, err := s.Releases(r.Context(), name, limit)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to list releases", "error", err)
+			http.Error(w, fmt.Sprintf("Error listing releases: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if name != "" && len(releases) == 0 {
+			http.Error(w, fmt.Sprintf("Library %s not found", name), http.StatusNotFound)
+			return
+		}
+
+		f := releaseFeed(baseURL(r), r.URL.Path, name, releases)
+		if ext == "atom" {
+			w.Header().Set("Content-Type", feed.AtomType)
+			err = feed.WriteAtom(w, f)
+		} else {
+			w.Header().Set("Content-Type", feed.JSONType)
+			err = feed.WriteJSON(w, f)
+		}
+		if err != nil {
+			slog.WarnContext(r.Context(), "failed to write feed", "path", r.URL.Path, "error", err)
+		}
+	}
+}
+
+// baseURL is the address the client used to reach the server.
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func releaseFeed(base, path, name string, releases []models.Library) feed.Feed {
+	f := feed.Feed{
+		ID:    base + path,
+		URL:   base + path,
+		Title: "Hamilton Venus Registry: new releases",
+		Link:  base + "/libraries",
+	}
+	if name != "" {
+		f.Title = fmt.Sprintf("Hamilton Venus Registry: %s releases", name)
+		f.Link = base + "/versions?name=" + url.QueryEscape(name)
+	}
+
+	f.Updated = time.Now()
+	if len(releases) > 0 {
+		f.Updated = releases[0].PublishedAt
+	}
+
+	for _, lib := range releases {
+		link := base + "/info?" + url.Values{"name": {lib.Name}, "version": {lib.Version.String()}}.Encode()
+		summary := lib.Description
+		if summary == "" {
+			summary = fmt.Sprintf("%s %s was published.", lib.Name, lib.Version)
+		}
+		f.Items = append(f.Items, feed.Item{
+			ID:        link,
+			Title:     fmt.Sprintf("%s %s", lib.Name, lib.Version),
+			Link:      link,
+			Author:    lib.Author,
+			Published: lib.PublishedAt,
+			Summary:   summary,
+			Content:   releaseHTML(lib),
+		})
+	}
+	return f
+}
+
+// releaseHTML describes a version for feed readers.
+func releaseHTML(lib models.Library) string {
+	var b strings.Builder
+	if lib.Description != "" {
+		fmt.Fprintf(&b, "<p>%s</p>\n", html.EscapeString(lib.Description))
+	}
+	if lib.Changelog != "" {
+		fmt.Fprintf(&b, "<h3>Changes</h3>\n<pre>%s</pre>\n", html.EscapeString(lib.Changelog))
+	}
+	if len(lib.Dependencies) > 0 {
+		names := make([]string, 0, len(lib.Dependencies))
+		for dep := range lib.Dependencies {
+			names = append(names, dep)
+		}
+		sort.Strings(names)
+		b.WriteString("<h3>Dependencies</h3>\n<ul>\n")
+		for _, dep := range names {
+			fmt.Fprintf(&b, "<li>%s %s</li>\n", html.EscapeString(dep), html.EscapeString(lib.Dependencies[dep]))
+		}
+		b.WriteString("</ul>\n")
+	}
+	if strings.HasPrefix(lib.RepoURL, "https://") || strings.HasPrefix(lib.RepoURL, "http://") {
+		fmt.Fprintf(&b, "<p>Repository: <a href=\"%s\">%s</a></p>\n", html.EscapeString(lib.RepoURL), html.EscapeString(lib.RepoURL))
+	}
+	fmt.Fprintf(&b, "<p>SHA-256: <code>%s</code></p>\n", html.EscapeString(lib.Hash))
+	return b.String()
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamgp/hvr/internal/audit"
+)
+
+func TestFeeds(t *testing.T) {
+	s, server := newTestServer(t)
+
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	f, _ := w.Create("lib-a.hsl")
+	f.Write([]byte("// lib-a\n"))
+	f, _ = w.Create("CHANGELOG.md")
+	f.Write([]byte("# Changelog\n\n## [1.1.0] - 2024-03-01\n\n- Faster <tip> pickup\n\n## [1.0.0]\n\n- First release\n"))
+	w.Close()
+	if _, err := s.Upload(context.Background(), audit.Actor{User: "test"}, "lib-a", "1.1.0", "Pipetting helpers", "Jane", "", nil, buf, time.Now(), "", ""); err != nil {
+		t.Fatalf("Failed to publish lib-a: %v", err)
+	}
+	publish(t, s, "lib-b", "1.0.0", map[string]string{"lib-a": "^1.0.0"})
+
+	resp, body := get(t, server.URL+"/feeds/releases.atom")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the Atom feed, got %s: %s", resp.Status, body)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/atom+xml") {
+		t.Errorf("Expected an Atom content type, got %s", ct)
+	}
+	var atom struct {
+		Entries []struct {
+			Title   string `xml:"title"`
+			Content string `xml:"content"`
+		} `xml:"entry"`
+	}
+	if err := xml.Unmarshal(body, &atom); err != nil {
+		t.Fatalf("Failed to parse Atom feed: %v", err)
+	}
+	if len(atom.Entries) != 2 || atom.Entries[0].Title != "lib-b 1.0.0" || atom.Entries[1].Title != "lib-a 1.1.0" {
+		t.Fatalf("Expected lib-b then lib-a, got %+v", atom.Entries)
+	}
+	if !strings.Contains(atom.Entries[1].Content, "Faster &lt;tip&gt; pickup") || strings.Contains(atom.Entries[1].Content, "First release") {
+		t.Errorf("Expected only the 1.1.0 changelog section, got %q", atom.Entries[1].Content)
+	}
+
+	resp, body = get(t, server.URL+"/feeds/libraries/lib-a.json")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the JSON feed, got %s: %s", resp.Status, body)
+	}
+	var jf struct {
+		Version string `json:"version"`
+		Items   []struct {
+			Title   string `json:"title"`
+			Summary string `json:"summary"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(body, &jf); err != nil {
+		t.Fatalf("Failed to parse JSON feed: %v", err)
+	}
+	if jf.Version != "https://jsonfeed.org/version/1.1" || len(jf.Items) != 1 || jf.Items[0].Summary != "Pipetting helpers" {
+		t.Errorf("Unexpected JSON feed: %s", body)
+	}
+
+	resp, _ = get(t, server.URL+"/feeds/libraries/missing.atom")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown library, got %s", resp.Status)
+	}
+	resp, _ = get(t, server.URL+"/feeds/releases.rss")
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown format, got %s", resp.Status)
+	}
+}
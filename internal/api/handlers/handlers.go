@@ -4,16 +4,22 @@ import (
 	"archive/zip"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/certs"
+	"github.com/iamgp/hvr/internal/models"
 	"github.com/iamgp/hvr/internal/services"
+	"github.com/iamgp/hvr/internal/venus"
 )
 
 func UploadHandler(s *services.LibraryService) http.HandlerFunc {
@@ -25,7 +31,7 @@ func UploadHandler(s *services.LibraryService) http.HandlerFunc {
 
 		err := r.ParseMultipartForm(10 << 20) // 10 MB max
 		if err != nil {
-			log.Printf("Error parsing multipart form: %v", err)
+			slog.WarnContext(r.Context(), "invalid upload form", "error", err)
 			http.Error(w, "Error parsing form", http.StatusBadRequest)
 			return
 		}
@@ -34,14 +40,14 @@ func UploadHandler(s *services.LibraryService) http.HandlerFunc {
 		version := r.FormValue("version")
 		_, err = semver.NewVersion(version)
 		if err != nil {
-			log.Printf("Invalid version: %v", err)
+			slog.WarnContext(r.Context(), "invalid upload version", "version", version, "error", err)
 			http.Error(w, "Invalid version", http.StatusBadRequest)
 			return
 		}
 
 		file, header, err := r.FormFile("file")
 		if err != nil {
-			log.Printf("Error retrieving file: %v", err)
+			slog.WarnContext(r.Context(), "upload without file", "error", err)
 			http.Error(w, "Error retrieving file", http.StatusBadRequest)
 			return
 		}
@@ -56,31 +62,21 @@ func UploadHandler(s *services.LibraryService) http.HandlerFunc {
 			}
 		}
 
-		log.Printf("Uploading file: %s, name: %s, version: %s", header.Filename, name, version)
+		slog.InfoContext(r.Context(), "uploading library", "library", name, "version", version, "file", header.Filename)
 
-		// Create a buffer to store our zipped file
-		zipBuffer := new(bytes.Buffer)
-		zipWriter := zip.NewWriter(zipBuffer)
-
-		// Create a new file inside the zip archive
-		zipFile, err := zipWriter.Create(header.Filename)
-		if err != nil {
-			log.Printf("Error creating zip file: %v", err)
-			http.Error(w, "Error creating zip file", http.StatusInternalServerError)
-			return
-		}
-
-		// Copy the uploaded file data to the zip file
-		_, err = io.Copy(zipFile, file)
-		if err != nil {
-			log.Printf("Error copying file to zip: %v", err)
-			http.Error(w, "Error copying file to zip", http.StatusInternalServerError)
-			return
+		// Archives are stored as uploaded so that publisher signatures over
+		// them stay valid; anything else is wrapped in a new zip archive.
+		var archive io.Reader = file
+		if _, err := zip.NewReader(file, header.Size); err != nil {
+			zipBuffer, err := wrapInZip(header.Filename, file)
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to create zip archive", "error", err)
+				http.Error(w, "Error creating zip file", http.StatusInternalServerError)
+				return
+			}
+			archive = zipBuffer
 		}
 
-		// Close the zip writer
-		zipWriter.Close()
-
 		// Now upload the zipped file with the modification time
 		description := r.FormValue("description")
 		author := r.FormValue("author")
@@ -90,28 +86,106 @@ func UploadHandler(s *services.LibraryService) http.HandlerFunc {
 		var dependencies map[string]string
 		err = json.Unmarshal([]byte(dependenciesJSON), &dependencies)
 		if err != nil {
-			log.Printf("Error parsing dependencies: %v", err)
+			slog.WarnContext(r.Context(), "invalid upload dependencies", "error", err)
 			http.Error(w, "Error parsing dependencies", http.StatusBadRequest)
 			return
 		}
 
-		err = s.Upload(name, version, description, author, repoURL, dependencies, zipBuffer, modTime)
+		signature := r.FormValue("signature")
+		signingKey := r.FormValue("signingKey")
+
+		library, err := s.Upload(r.Context(), actorFromRequest(r), name, version, description, author, repoURL, dependencies, archive, modTime, signature, signingKey)
 		if err != nil {
 			if strings.Contains(err.Error(), "library version already exists") {
-				log.Printf("Attempt to overwrite existing version: %v", err)
+				slog.WarnContext(r.Context(), "rejected overwrite of existing version", "library", name, "version", version)
 				http.Error(w, fmt.Sprintf("Error: %v", err), http.StatusConflict)
 				return
 			}
-			log.Printf("Error uploading file: %v", err)
+			var validationErr *venus.ValidationError
+			if errors.As(err, &validationErr) {
+				slog.WarnContext(r.Context(), "rejected invalid library", "library", name, "version", version, "problems", len(validationErr.Problems))
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"error":    "library validation failed",
+					"problems": validationErr.Problems,
+				})
+				return
+			}
+			if errors.Is(err, services.ErrInvalidSignature) {
+				slog.WarnContext(r.Context(), "rejected upload with bad signature", "library", name, "version", version, "error", err)
+				http.Error(w, fmt.Sprintf("Error: %v", err), http.StatusBadRequest)
+				return
+			}
+			slog.ErrorContext(r.Context(), "failed to upload library", "library", name, "version", version, "error", err)
 			http.Error(w, fmt.Sprintf("Error uploading file: %v", err), http.StatusInternalServerError)
 			return
 		}
 
+		// Files whose checksum footer doesn't match were edited outside
+		// the Venus editor and will fail to load on the instrument.
+		var warnings []venus.Problem
+		for _, f := range library.Files {
+			if f.HasFooter && !f.ChecksumValid {
+				warnings = append(warnings, venus.Problem{File: f.Path, Message: "checksum footer does not match file content"})
+			}
+		}
+		if len(warnings) > 0 {
+			slog.WarnContext(r.Context(), "library uploaded with invalid checksum footers", "library", name, "version", version, "files", len(warnings))
+		}
+
 		w.WriteHeader(http.StatusCreated)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Library uploaded successfully"})
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message":  "Library uploaded successfully",
+			"warnings": warnings,
+		})
+	}
+}
+
+func FilesHandler(s *services.LibraryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.URL.Query().Get("name")
+		version := r.URL.Query().Get("version")
+
+		if name == "" || version == "" {
+			http.Error(w, "Name and version are required", http.StatusBadRequest)
+			return
+		}
+
+		files, err := s.GetFiles(r.Context(), name, version)
+		if err != nil {
+			slog.WarnContext(r.Context(), "failed to list files", "library", name, "version", version, "error", err)
+			http.Error(w, fmt.Sprintf("Error listing files: %v", err), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(files)
 	}
 }
 
+func wrapInZip(filename string, r io.Reader) (*bytes.Buffer, error) {
+	zipBuffer := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(zipBuffer)
+
+	zipFile, err := zipWriter.Create(filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(zipFile, r); err != nil {
+		return nil, err
+	}
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return zipBuffer, nil
+}
+
 func DownloadHandler(s *services.LibraryService) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -131,26 +205,35 @@ func DownloadHandler(s *services.LibraryService) http.HandlerFunc {
 			version = "latest"
 		}
 
-		fileContent, modTime, hash, err := s.Download(name, version)
+		fileContent, modTime, library, err := s.Download(r.Context(), name, version)
 		if err != nil {
-			log.Printf("Error downloading file: %v", err)
+			slog.ErrorContext(r.Context(), "failed to download library", "library", name, "version", version, "error", err)
 			http.Error(w, fmt.Sprintf("Error downloading file: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.zip", name, version))
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s-%s.zip", name, library.Version.String()))
 		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Length", strconv.Itoa(len(fileContent)))
+		w.Header().Set("X-Library-Version", library.Version.String())
+		if len(library.Dependencies) > 0 {
+			deps, _ := json.Marshal(library.Dependencies)
+			w.Header().Set("X-Library-Dependencies", string(deps))
+		}
 		w.Header().Set("X-File-ModTime", fmt.Sprintf("%d", modTime.Unix()))
-		w.Header().Set("X-File-Hash", hash)
+		w.Header().Set("X-File-Hash", library.Hash)
+		if library.Signature != "" {
+			w.Header().Set("X-File-Signature", library.Signature)
+			w.Header().Set("X-File-Signing-Key", library.SigningKey)
+		}
 
 		_, err = w.Write(fileContent)
 		if err != nil {
-			log.Printf("Error writing file content to response: %v", err)
-			http.Error(w, "Error sending file", http.StatusInternalServerError)
+			slog.WarnContext(r.Context(), "failed to send library", "library", name, "version", library.Version.String(), "error", err)
 			return
 		}
 
-		log.Printf("File %s-%s.zip downloaded successfully", name, version)
+		slog.InfoContext(r.Context(), "library downloaded", "library", name, "version", library.Version.String())
 	}
 }
 
@@ -167,7 +250,7 @@ func SearchHandler(s *services.LibraryService) http.HandlerFunc {
 			return
 		}
 
-		results, err := s.Search(query)
+		results, err := s.Search(r.Context(), query)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
@@ -191,9 +274,9 @@ func ResolveDependenciesHandler(s *services.LibraryService) http.HandlerFunc {
 			return
 		}
 
-		dependencies, err := s.ResolveLibraryDependencies(name, version)
+		dependencies, err := s.ResolveLibraryDependencies(r.Context(), name, version)
 		if err != nil {
-			log.Printf("Error resolving dependencies: %v", err)
+			slog.ErrorContext(r.Context(), "failed to resolve dependencies", "library", name, "version", version, "error", err)
 			http.Error(w, fmt.Sprintf("Error resolving dependencies: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -202,3 +285,183 @@ func ResolveDependenciesHandler(s *services.LibraryService) http.HandlerFunc {
 		json.NewEncoder(w).Encode(dependencies)
 	}
 }
+
+func ProvidersHandler(s *services.LibraryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		file := r.URL.Query().Get("file")
+		if file == "" {
+			http.Error(w, "Missing file parameter", http.StatusBadRequest)
+			return
+		}
+
+		providers, err := s.FindProviders(r.Context(), file)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to find providers", "include", file, "error", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(providers)
+	}
+}
+
+func VersionsHandler(s *services.LibraryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+
+		versions, err := s.Versions(r.Context(), name)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to list versions", "library", name, "error", err)
+			http.Error(w, fmt.Sprintf("Error listing versions: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if len(versions) == 0 {
+			http.Error(w, fmt.Sprintf("Library %s not found", name), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(versions)
+	}
+}
+
+func InfoHandler(s *services.LibraryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		name := r.URL.Query().Get("name")
+		version := r.URL.Query().Get("version")
+
+		if name == "" {
+			http.Error(w, "Name is required", http.StatusBadRequest)
+			return
+		}
+
+		if version == "" {
+			version = "latest"
+		}
+
+		library, err := s.Info(r.Context(), name, version)
+		if err != nil {
+			slog.WarnContext(r.Context(), "failed to get library info", "library", name, "version", version, "error", err)
+			http.Error(w, fmt.Sprintf("Error getting library info: %v", err), http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(library)
+	}
+}
+
+func LibrariesHandler(s *services.LibraryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		var since time.Time
+		if v := r.URL.Query().Get("since"); v != "" {
+			var err error
+			since, err = time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, "Invalid since parameter, expected an RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+		}
+
+		libraries, err := s.List(r.Context(), since)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to list libraries", "error", err)
+			http.Error(w, fmt.Sprintf("Error listing libraries: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if libraries == nil {
+			libraries = []models.Library{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(libraries)
+	}
+}
+
+// actorFromRequest identifies who made a request for the audit log: the
+// identity of its verified client certificate, or anonymous.
+func actorFromRequest(r *http.Request) audit.Actor {
+	address := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(address); err == nil {
+		address = host
+	}
+	user := audit.Anonymous
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		if id := certs.Identity(r.TLS.VerifiedChains[0][0]); id != "" {
+			user = id
+		}
+	}
+	return audit.Actor{User: user, Address: address}
+}
+
+func AuditHandler(s *services.LibraryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := audit.Filter{
+			User:    query.Get("user"),
+			Action:  query.Get("action"),
+			Library: query.Get("library"),
+		}
+		for param, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+			if v := query.Get(param); v != "" {
+				parsed, err := time.Parse(time.RFC3339, v)
+				if err != nil {
+					http.Error(w, fmt.Sprintf("Invalid %s parameter, expected an RFC 3339 time", param), http.StatusBadRequest)
+					return
+				}
+				*t = parsed
+			}
+		}
+		if v := query.Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 0 {
+				http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+			filter.Limit = limit
+		}
+
+		entries, err := s.AuditLog(r.Context(), filter)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to read audit log", "error", err)
+			http.Error(w, fmt.Sprintf("Error reading audit log: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if entries == nil {
+			entries = []audit.Entry{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(entries)
+	}
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestActorFromRequest(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/upload", nil)
+	r.RemoteAddr = "10.1.4.27:51234"
+	if actor := actorFromRequest(r); actor.User != "anonymous" || actor.Address != "10.1.4.27" {
+		t.Errorf("Expected an anonymous actor at 10.1.4.27, got %+v", actor)
+	}
+
+	// Only verified certificates identify the user.
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "alice"}}
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	if actor := actorFromRequest(r); actor.User != "anonymous" {
+		t.Errorf("Expected an unverified certificate to be ignored, got %+v", actor)
+	}
+	r.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	if actor := actorFromRequest(r); actor.User != "alice" {
+		t.Errorf("Expected the certificate's user alice, got %+v", actor)
+	}
+}
+
+func TestRequireAdmin(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.SetAdmins([]string{"alice"})
+	handler := requireAdmin(s, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for _, tt := range []struct {
+		user string
+		want int
+	}{
+		{"", http.StatusForbidden},
+		{"bob", http.StatusForbidden},
+		{"alice", http.StatusNoContent},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/webhooks", nil)
+		if tt.user != "" {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: tt.user}}
+			r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}, VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		w := httptest.NewRecorder()
+		handler(w, r)
+		if w.Code != tt.want {
+			t.Errorf("Expected status %d for user %q, got %d", tt.want, tt.user, w.Code)
+		}
+	}
+}
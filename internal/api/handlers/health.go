@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/iamgp/hvr/internal/services"
+)
+
+// healthStatus is the response of the health endpoints.
+type healthStatus struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// HealthHandler reports whether the database and file store work, with
+// status 200 when they do and 503 when either doesn't.
+func HealthHandler(s *services.LibraryService) http.HandlerFunc {
+	return ReadyHandler(s, nil)
+}
+
+// ReadyHandler is HealthHandler that also reports 503 once draining is set,
+// so load balancers stop sending requests to a server that is shutting
+// down.
+func ReadyHandler(s *services.LibraryService, draining *atomic.Bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		status := healthStatus{Status: "ok", Checks: make(map[string]string)}
+		for name, err := range s.Health(r.Context()) {
+			if err != nil {
+				slog.WarnContext(r.Context(), "health check failed", "check", name, "error", err)
+				status.Status = "unavailable"
+				status.Checks[name] = err.Error()
+				continue
+			}
+			status.Checks[name] = "ok"
+		}
+		if draining != nil && draining.Load() {
+			status.Status = "shutting down"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if status.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		json.NewEncoder(w).Encode(status)
+	}
+}
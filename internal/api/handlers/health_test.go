@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/iamgp/hvr/internal/metrics"
+	"github.com/iamgp/hvr/internal/services"
+	"github.com/iamgp/hvr/internal/storage"
+)
+
+func checkHealth(t *testing.T, h http.Handler, wantStatus int) healthStatus {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != wantStatus {
+		t.Errorf("Expected status %d, got %d: %s", wantStatus, rec.Code, rec.Body)
+	}
+	var status healthStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatalf("Failed to parse health status: %v", err)
+	}
+	return status
+}
+
+func TestHealth(t *testing.T) {
+	dir := t.TempDir()
+	db, err := storage.NewSQLiteDatabase(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer db.Close()
+	storeDir := filepath.Join(dir, "library_files")
+	fileStore, err := storage.NewLocalFileStore(storeDir)
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+	s := services.NewLibraryService(db, fileStore)
+
+	var draining atomic.Bool
+	status := checkHealth(t, ReadyHandler(s, &draining), http.StatusOK)
+	if status.Status != "ok" || status.Checks["database"] != "ok" || status.Checks["storage"] != "ok" {
+		t.Errorf("Expected every check to pass, got %+v", status)
+	}
+
+	draining.Store(true)
+	if status := checkHealth(t, ReadyHandler(s, &draining), http.StatusServiceUnavailable); status.Status != "shutting down" {
+		t.Errorf("Expected a draining server not to be ready, got %+v", status)
+	}
+	checkHealth(t, HealthHandler(s), http.StatusOK)
+
+	if err := os.RemoveAll(storeDir); err != nil {
+		t.Fatalf("Failed to remove file store: %v", err)
+	}
+	status = checkHealth(t, HealthHandler(s), http.StatusServiceUnavailable)
+	if status.Checks["storage"] == "ok" || status.Checks["database"] != "ok" {
+		t.Errorf("Expected only the storage check to fail, got %+v", status)
+	}
+
+	db.Close()
+	if status := checkHealth(t, HealthHandler(s), http.StatusServiceUnavailable); status.Checks["database"] == "ok" {
+		t.Errorf("Expected the database check to fail once it is closed, got %+v", status)
+	}
+}
+
+func TestRouterOperationalEndpoints(t *testing.T) {
+	s, _ := newTestServer(t)
+	var draining atomic.Bool
+	registry := metrics.NewRegistry()
+	registry.NewGauge("hvr_test", "A test gauge.")
+	router := NewRouter(s, RouterOptions{Draining: &draining, Metrics: registry.Handler()})
+
+	draining.Store(true)
+	checkHealth(t, router, http.StatusOK)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected /readyz to fail while draining, got %d", rec.Code)
+	}
+
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "hvr_test") {
+		t.Errorf("Expected /metrics to serve the registry, got %d: %s", rec.Code, rec.Body)
+	}
+}
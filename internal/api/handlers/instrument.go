@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/iamgp/hvr/internal/metrics"
+)
+
+// HTTPMetrics count and time the requests served by a router.
+type HTTPMetrics struct {
+	requests      *metrics.CounterVec
+	duration      *metrics.HistogramVec
+	requestBytes  *metrics.CounterVec
+	responseBytes *metrics.CounterVec
+}
+
+// NewHTTPMetrics registers the request metrics in r.
+func NewHTTPMetrics(r *metrics.Registry) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests:      r.NewCounterVec("hvr_http_requests_total", "HTTP requests by route, method and status.", "route", "method", "status"),
+		duration:      r.NewHistogramVec("hvr_http_request_duration_seconds", "Time to serve HTTP requests by route, method and status.", metrics.DefaultBuckets, "route", "method", "status"),
+		requestBytes:  r.NewCounterVec("hvr_http_request_bytes_total", "Bytes of HTTP request bodies read by route, such as uploaded archives.", "route"),
+		responseBytes: r.NewCounterVec("hvr_http_response_bytes_total", "Bytes of HTTP response bodies written by route, such as downloaded archives.", "route"),
+	}
+}
+
+// Instrument records every request served by mux in m. Requests are labeled
+// with the pattern they matched, so paths with IDs or names in them don't
+// each get their own series.
+func Instrument(mux *http.ServeMux, m *HTTPMetrics) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		_, route := mux.Handler(r)
+		if route == "" {
+			route = "unmatched"
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		mux.ServeHTTP(rec, r)
+
+		status := strconv.Itoa(rec.status)
+		method := methodLabel(r.Method)
+		m.requests.With(route, method, status).Inc()
+		m.duration.With(route, method, status).Observe(time.Since(start).Seconds())
+		m.requestBytes.With(route).Add(float64(body.n))
+		m.responseBytes.With(route).Add(float64(rec.n))
+	})
+}
+
+// methodLabel keeps arbitrary methods from creating new series.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete, http.MethodPatch, http.MethodOptions:
+		return method
+	}
+	return "other"
+}
+
+// statusRecorder remembers the status and counts the body bytes of a
+// response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	n           int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status, r.wroteHeader = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(b)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iamgp/hvr/internal/metrics"
+)
+
+func TestInstrument(t *testing.T) {
+	s, server := newTestServer(t)
+	publish(t, s, "lib-a", "1.0.0", nil)
+
+	registry := metrics.NewRegistry()
+	router := NewRouter(s, RouterOptions{})
+	server.Config.Handler = Instrument(router, NewHTTPMetrics(registry))
+
+	get(t, server.URL+"/download?name=lib-a&version=1.0.0")
+	get(t, server.URL+"/download?name=lib-a&version=2.0.0")
+	get(t, server.URL+"/feeds/libraries/lib-a.atom")
+
+	var b strings.Builder
+	if err := registry.Write(&b); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+	out := b.String()
+	for _, want := range []string{
+		`hvr_http_requests_total{route="/download",method="GET",status="200"} 1`,
+		`hvr_http_requests_total{route="/download",method="GET",status="500"} 1`,
+		`hvr_http_requests_total{route="/feeds/",method="GET",status="200"} 1`,
+		`hvr_http_request_duration_seconds_count{route="/download",method="GET",status="200"} 1`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected %s in:\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `hvr_http_response_bytes_total{route="/download"} 0`) {
+		t.Error("Expected download bytes to be counted")
+	}
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/iamgp/hvr/internal/logging"
+)
+
+// LogRequests gives every request served by next an ID and logs one access
+// line for it. An ID sent by the client in X-Request-ID is kept so
+// that a request can be followed from the client through proxies; otherwise
+// a new one is made. The ID is returned in the X-Request-ID response header
+// and carried by the request context, so everything logged while serving
+// the request includes it. Passing health checks are only logged at debug
+// level, since load balancers and monitoring send them every few seconds.
+func LogRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		id := r.Header.Get(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, id)
+		ctx := logging.WithRequestID(r.Context(), id)
+		r = r.WithContext(ctx)
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		actor := actorFromRequest(r)
+		level := slog.LevelInfo
+		if (r.URL.Path == "/healthz" || r.URL.Path == "/readyz") && rec.status == http.StatusOK {
+			level = slog.LevelDebug
+		}
+		slog.Log(ctx, level, "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"bytes", rec.n,
+			"duration", time.Since(start),
+			"user", actor.User,
+			"remote", actor.Address,
+		)
+	})
+}
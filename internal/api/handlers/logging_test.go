@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/iamgp/hvr/internal/logging"
+	"github.com/iamgp/hvr/internal/upstream"
+)
+
+// captureLogs sends the default logger's JSON records to the returned
+// buffer for the rest of the test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	logger, err := logging.New(buf, "json", "info")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	previous := slog.Default()
+	slog.SetDefault(logger)
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return buf
+}
+
+func logRecords(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Failed to parse log line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogRequests(t *testing.T) {
+	s, server := newTestServer(t)
+	publish(t, s, "lib-a", "1.0.0", nil)
+	buf := captureLogs(t)
+	server.Config.Handler = LogRequests(NewRouter(s, RouterOptions{}))
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/download?name=lib-a&version=1.0.0", nil)
+	req.Header.Set(logging.RequestIDHeader, "client-1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to download: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get(logging.RequestIDHeader); got != "client-1" {
+		t.Errorf("Expected the client's request ID to be echoed, got %q", got)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, server.URL+"/versions?name=lib-a", nil)
+	req.Header.Set(logging.RequestIDHeader, "bad id")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to list versions: %v", err)
+	}
+	resp.Body.Close()
+	generated := resp.Header.Get(logging.RequestIDHeader)
+	if generated == "" || generated == "bad id" {
+		t.Errorf("Expected an invalid request ID to be replaced, got %q", generated)
+	}
+
+	var access []map[string]interface{}
+	var downloaded bool
+	for _, record := range logRecords(t, buf) {
+		if record["msg"] == "request" {
+			access = append(access, record)
+		}
+		if record["msg"] == "library downloaded" && record["request_id"] == "client-1" {
+			downloaded = true
+		}
+	}
+	if !downloaded {
+		t.Errorf("Expected the download to be logged with its request ID:\n%s", buf)
+	}
+	if len(access) != 2 {
+		t.Fatalf("Expected 2 access log lines, got %d:\n%s", len(access), buf)
+	}
+	first := access[0]
+	if first["request_id"] != "client-1" || first["method"] != "GET" || first["path"] != "/download" ||
+		first["status"] != float64(http.StatusOK) || first["user"] != "anonymous" {
+		t.Errorf("Unexpected access log line: %v", first)
+	}
+	if n, _ := first["bytes"].(float64); n == 0 {
+		t.Errorf("Expected the response bytes to be logged: %v", first)
+	}
+	if access[1]["request_id"] != generated {
+		t.Errorf("Expected access log request ID %q, got %v", generated, access[1]["request_id"])
+	}
+}
+
+func TestProxyForwardsRequestID(t *testing.T) {
+	central, centralServer := newTestServer(t)
+	publish(t, central, "lib-a", "1.0.0", nil)
+	centralServer.Config.Handler = LogRequests(NewRouter(central, RouterOptions{}))
+
+	site, siteServer := newTestServer(t)
+	site.SetUpstream(upstream.NewClient(centralServer.URL))
+	siteServer.Config.Handler = LogRequests(NewRouter(site, RouterOptions{}))
+	buf := captureLogs(t)
+
+	req, _ := http.NewRequest(http.MethodGet, siteServer.URL+"/download?name=lib-a&version=1.0.0", nil)
+	req.Header.Set(logging.RequestIDHeader, "trace-me")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to download: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	// The site's download and the info and download requests it sent
+	// upstream are all logged with the client's request ID.
+	paths := make(map[string]int)
+	for _, record := range logRecords(t, buf) {
+		if record["msg"] != "request" {
+			continue
+		}
+		if record["request_id"] != "trace-me" {
+			t.Errorf("Expected every request to carry the request ID, got %v", record)
+		}
+		path, _ := record["path"].(string)
+		paths[path]++
+	}
+	if paths["/download"] != 2 || paths["/info"] == 0 {
+		t.Errorf("Expected the proxied requests to be logged upstream, got %v:\n%s", paths, buf)
+	}
+}
@@ -0,0 +1,301 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/models"
+	"github.com/iamgp/hvr/internal/services"
+	"github.com/iamgp/hvr/internal/storage"
+	"github.com/iamgp/hvr/internal/upstream"
+)
+
+func newTestServer(t *testing.T) (*services.LibraryService, *httptest.Server) {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := storage.NewSQLiteDatabase(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	fileStore, err := storage.NewLocalFileStore(filepath.Join(dir, "library_files"))
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	s := services.NewLibraryService(db, fileStore)
+	server := httptest.NewServer(NewRouter(s, RouterOptions{}))
+	t.Cleanup(server.Close)
+	return s, server
+}
+
+func publish(t *testing.T, s *services.LibraryService, name, version string, deps map[string]string) {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	f, _ := w.Create(name + ".hsl")
+	f.Write([]byte("// " + name + " " + version + "\n"))
+	w.Close()
+
+	if _, err := s.Upload(context.Background(), audit.Actor{User: "test"}, name, version, "", "", "", deps, buf, time.Now(), "", ""); err != nil {
+		t.Fatalf("Failed to publish %s %s: %v", name, version, err)
+	}
+}
+
+func get(t *testing.T, url string) (*http.Response, []byte) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Failed to GET %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, body
+}
+
+func TestProxyServesUpstreamLibraries(t *testing.T) {
+	central, centralServer := newTestServer(t)
+	publish(t, central, "lib-b", "1.0.0", nil)
+	publish(t, central, "lib-a", "1.0.0", map[string]string{"lib-b": "^1.0.0"})
+
+	site, siteServer := newTestServer(t)
+	site.SetUpstream(upstream.NewClient(centralServer.URL))
+
+	resp, body := get(t, siteServer.URL+"/download?name=lib-a&version=1.0.0")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected lib-a to be proxied, got %s: %s", resp.Status, body)
+	}
+	_, upstreamBody := get(t, centralServer.URL+"/download?name=lib-a&version=1.0.0")
+	if !bytes.Equal(body, upstreamBody) {
+		t.Errorf("Expected the proxied archive to match upstream")
+	}
+
+	resp, body = get(t, siteServer.URL+"/resolve?name=lib-a&version=1.0.0")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected dependencies to resolve through the proxy, got %s: %s", resp.Status, body)
+	}
+	var resolved []models.Library
+	if err := json.Unmarshal(body, &resolved); err != nil {
+		t.Fatalf("Failed to decode resolve response: %v", err)
+	}
+	if len(resolved) != 1 || resolved[0].Name != "lib-b" {
+		t.Errorf("Expected lib-b to be resolved, got %+v", resolved)
+	}
+
+	// The proxy keeps serving what it has cached while upstream is down.
+	centralServer.Close()
+	for _, path := range []string{
+		"/download?name=lib-a&version=1.0.0",
+		"/download?name=lib-a",
+		"/download?name=lib-b&version=1.0.0",
+		"/resolve?name=lib-a&version=1.0.0",
+	} {
+		if resp, body := get(t, siteServer.URL+path); resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected %s to be served from the proxy cache, got %s: %s", path, resp.Status, body)
+		}
+	}
+}
+
+func TestProxyPrefersNewerUpstreamVersion(t *testing.T) {
+	central, centralServer := newTestServer(t)
+	publish(t, central, "lib-a", "1.0.0", nil)
+
+	site, siteServer := newTestServer(t)
+	site.SetUpstream(upstream.NewClient(centralServer.URL))
+
+	get(t, siteServer.URL+"/download?name=lib-a")
+	publish(t, central, "lib-a", "1.1.0", nil)
+
+	resp, body := get(t, siteServer.URL+"/download?name=lib-a")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Failed to download latest lib-a: %s: %s", resp.Status, body)
+	}
+	if v := resp.Header.Get("X-Library-Version"); v != "1.1.0" {
+		t.Errorf("Expected latest to follow upstream to 1.1.0, got %s", v)
+	}
+
+	resp, body = get(t, siteServer.URL+"/versions?name=lib-a")
+	var versions []string
+	json.Unmarshal(body, &versions)
+	if resp.StatusCode != http.StatusOK || len(versions) != 2 || versions[0] != "1.1.0" {
+		t.Errorf("Expected versions [1.1.0 1.0.0], got %s: %s", resp.Status, body)
+	}
+}
+
+func TestProxyKeepsLocalPublishesLocal(t *testing.T) {
+	_, centralServer := newTestServer(t)
+	site, siteServer := newTestServer(t)
+	site.SetUpstream(upstream.NewClient(centralServer.URL))
+
+	publish(t, site, "site-lib", "1.0.0", nil)
+
+	if resp, body := get(t, siteServer.URL+"/download?name=site-lib&version=1.0.0"); resp.StatusCode != http.StatusOK {
+		t.Errorf("Expected the local library to be served, got %s: %s", resp.Status, body)
+	}
+	if resp, _ := get(t, centralServer.URL+"/info?name=site-lib"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the local library not to reach upstream, got %s", resp.Status)
+	}
+}
+
+func TestProxyRejectsTamperedArchive(t *testing.T) {
+	central, centralServer := newTestServer(t)
+	publish(t, central, "lib-a", "1.0.0", nil)
+
+	// An upstream whose archives don't match the hashes it advertises.
+	tampering := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/download" {
+			w.Write([]byte("not the archive"))
+			return
+		}
+		http.Redirect(w, r, centralServer.URL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	}))
+	defer tampering.Close()
+
+	site, siteServer := newTestServer(t)
+	site.SetUpstream(upstream.NewClient(tampering.URL))
+
+	resp, body := get(t, siteServer.URL+"/download?name=lib-a&version=1.0.0")
+	if resp.StatusCode == http.StatusOK {
+		t.Fatalf("Expected a tampered upstream archive to be rejected")
+	}
+	if !strings.Contains(string(body), "has hash") {
+		t.Errorf("Expected a hash mismatch error, got %s", body)
+	}
+}
+
+func TestProxyFetchesEachVersionOnce(t *testing.T) {
+	central, centralServer := newTestServer(t)
+	publish(t, central, "lib-a", "1.0.0", nil)
+	publish(t, central, "lib-b", "1.0.0", nil)
+
+	// An upstream that holds back downloads of lib-a until released.
+	started, release := make(chan struct{}, 10), make(chan struct{})
+	var mu sync.Mutex
+	downloads := make(map[string]int)
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/download" {
+			name := r.URL.Query().Get("name")
+			mu.Lock()
+			downloads[name]++
+			mu.Unlock()
+			if name == "lib-a" {
+				started <- struct{}{}
+				<-release
+			}
+		}
+		http.Redirect(w, r, centralServer.URL+r.URL.RequestURI(), http.StatusTemporaryRedirect)
+	}))
+	defer slow.Close()
+
+	site, siteServer := newTestServer(t)
+	site.SetUpstream(upstream.NewClient(slow.URL))
+
+	var wg sync.WaitGroup
+	statuses := make([]int, 3)
+	for i := range statuses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			resp, err := http.Get(siteServer.URL + "/download?name=lib-a&version=1.0.0")
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+			statuses[i] = resp.StatusCode
+		}(i)
+	}
+	<-started
+
+	// A different version is fetched while lib-a is still downloading.
+	done := make(chan *http.Response)
+	go func() {
+		resp, _ := http.Get(siteServer.URL + "/download?name=lib-b&version=1.0.0")
+		done <- resp
+	}()
+	select {
+	case resp := <-done:
+		if resp == nil || resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected lib-b to be proxied, got %v", resp)
+		} else {
+			resp.Body.Close()
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("Expected lib-b not to wait for the download of lib-a")
+	}
+
+	close(release)
+	wg.Wait()
+	for i, status := range statuses {
+		if status != http.StatusOK {
+			t.Errorf("Expected download %d of lib-a to succeed, got %d", i, status)
+		}
+	}
+	if downloads["lib-a"] != 1 {
+		t.Errorf("Expected lib-a to be downloaded from upstream once, got %d", downloads["lib-a"])
+	}
+}
+
+func TestProxyUsesLocalDataDuringOutage(t *testing.T) {
+	central, centralServer := newTestServer(t)
+	publish(t, central, "lib-b", "1.0.0", nil)
+	publish(t, central, "lib-a", "1.0.0", map[string]string{"lib-b": "^1.0.0"})
+
+	// A WAN link to the central registry that stops answering when down.
+	var down atomic.Bool
+	var hung atomic.Int64
+	wan := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			hung.Add(1)
+			<-r.Context().Done()
+			return
+		}
+		centralServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer wan.Close()
+
+	site, siteServer := newTestServer(t)
+	client := upstream.NewClient(wan.URL)
+	client.SetTimeout(200 * time.Millisecond)
+	site.SetUpstream(client)
+
+	for _, path := range []string{"/download?name=lib-a&version=1.0.0", "/resolve?name=lib-a&version=1.0.0"} {
+		if resp, body := get(t, siteServer.URL+path); resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected %s to be proxied, got %s: %s", path, resp.Status, body)
+		}
+	}
+
+	down.Store(true)
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		for _, path := range []string{
+			"/resolve?name=lib-a&version=1.0.0",
+			"/download?name=lib-a",
+			"/download?name=lib-b&version=1.0.0",
+			"/versions?name=lib-b",
+		} {
+			if resp, body := get(t, siteServer.URL+path); resp.StatusCode != http.StatusOK {
+				t.Errorf("Expected %s to be served from local data, got %s: %s", path, resp.Status, body)
+			}
+		}
+	}
+	if n := hung.Load(); n != 1 {
+		t.Errorf("Expected the upstream to be asked once during the outage, got %d", n)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected requests during the outage not to wait for the upstream, took %s", elapsed)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/iamgp/hvr/internal/services"
+)
+
+// RouterOptions are the parts of the server the operational endpoints of
+// NewRouter report on.
+type RouterOptions struct {
+	// Draining makes /readyz fail once it is set. It may be nil.
+	Draining *atomic.Bool
+	// Metrics serves /metrics. The endpoint is left out when it is nil.
+	Metrics http.Handler
+}
+
+// NewRouter returns the registry's HTTP API backed by s.
+func NewRouter(s *services.LibraryService, opts RouterOptions) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", indexHandler)
+	mux.HandleFunc("/healthz", HealthHandler(s))
+	mux.HandleFunc("/readyz", ReadyHandler(s, opts.Draining))
+	if opts.Metrics != nil {
+		mux.Handle("/metrics", opts.Metrics)
+	}
+	mux.HandleFunc("/upload", UploadHandler(s))
+	mux.HandleFunc("/download", DownloadHandler(s))
+	mux.HandleFunc("/search", SearchHandler(s))
+	mux.HandleFunc("/resolve", ResolveDependenciesHandler(s))
+	mux.HandleFunc("/files", FilesHandler(s))
+	mux.HandleFunc("/providers", ProvidersHandler(s))
+	mux.HandleFunc("/versions", VersionsHandler(s))
+	mux.HandleFunc("/info", InfoHandler(s))
+	mux.HandleFunc("/libraries", LibrariesHandler(s))
+	mux.HandleFunc("/feeds/", FeedHandler(s))
+	mux.HandleFunc("/api/v1/audit", AuditHandler(s))
+	mux.HandleFunc("/api/v1/webhooks", requireAdmin(s, WebhooksHandler(s)))
+	mux.HandleFunc("/api/v1/webhooks/", requireAdmin(s, WebhookHandler(s)))
+	mux.HandleFunc("/api/v1/webhooks/deliveries", requireAdmin(s, DeliveriesHandler(s)))
+	mux.HandleFunc("/api/v1/webhooks/deliveries/", requireAdmin(s, RedeliverHandler(s)))
+	return mux
+}
+
+func indexHandler(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "Welcome to Hamilton Venus Registry!")
+}
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/iamgp/hvr/internal/services"
+	"github.com/iamgp/hvr/internal/webhook"
+)
+
+// requireAdmin only lets requests from administrators through to next.
+// Webhooks make the registry send requests to URLs of the caller's choosing
+// with every version published, so managing them needs the verified client
+// certificate of one of the users set with SetAdmins.
+func requireAdmin(s *services.LibraryService, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !s.IsAdmin(actorFromRequest(r)) {
+			http.Error(w, "Managing webhooks requires the client certificate of an administrator", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// WebhooksHandler lists webhooks on GET and registers one on POST. The
+// response to a POST is the only place the webhook's secret is returned.
+func WebhooksHandler(s *services.LibraryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			hooks, err := s.Webhooks(r.Context())
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to list webhooks", "error", err)
+				http.Error(w, fmt.Sprintf("Error listing webhooks: %v", err), http.StatusInternalServerError)
+				return
+			}
+			if hooks == nil {
+				hooks = []webhook.Hook{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(hooks)
+
+		case http.MethodPost:
+			var hook webhook.Hook
+			if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid webhook: %v", err), http.StatusBadRequest)
+				return
+			}
+			created, err := s.CreateWebhook(r.Context(), actorFromRequest(r), webhook.Hook{
+				URL:     hook.URL,
+				Secret:  hook.Secret,
+				Library: hook.Library,
+				Events:  hook.Events,
+			})
+			if errors.Is(err, webhook.ErrInvalid) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if err != nil {
+				slog.ErrorContext(r.Context(), "failed to create webhook", "error", err)
+				http.Error(w, fmt.Sprintf("Error creating webhook: %v", err), http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(created)
+
+		default:
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// WebhookHandler removes the webhook at /api/v1/webhooks/{id} on DELETE.
+func WebhookHandler(s *services.LibraryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/api/v1/webhooks/"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid webhook ID", http.StatusBadRequest)
+			return
+		}
+
+		err = s.DeleteWebhook(r.Context(), actorFromRequest(r), id)
+		if errors.Is(err, webhook.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("Webhook %d not found", id), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to delete webhook", "webhook", id, "error", err)
+			http.Error(w, fmt.Sprintf("Error deleting webhook: %v", err), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// DeliveriesHandler returns the webhook delivery log, newest first,
+// filtered by the webhook, status and limit parameters.
+func DeliveriesHandler(s *services.LibraryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		query := r.URL.Query()
+		filter := webhook.DeliveryFilter{Status: query.Get("status")}
+		if v := query.Get("webhook"); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid webhook parameter", http.StatusBadRequest)
+				return
+			}
+			filter.WebhookID = id
+		}
+		if v := query.Get("limit"); v != "" {
+			limit, err := strconv.Atoi(v)
+			if err != nil || limit < 0 {
+				http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+				return
+			}
+			filter.Limit = limit
+		}
+
+		deliveries, err := s.Deliveries(r.Context(), filter)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to read webhook deliveries", "error", err)
+			http.Error(w, fmt.Sprintf("Error reading webhook deliveries: %v", err), http.StatusInternalServerError)
+			return
+		}
+		if deliveries == nil {
+			deliveries = []webhook.Delivery{}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(deliveries)
+	}
+}
+
+// RedeliverHandler queues a past delivery again on POST to
+// /api/v1/webhooks/deliveries/{id}/redeliver.
+func RedeliverHandler(s *services.LibraryService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, "/api/v1/webhooks/deliveries/")
+		idStr, ok := strings.CutSuffix(rest, "/redeliver")
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if !ok || err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		d, err := s.Redeliver(r.Context(), id)
+		if errors.Is(err, webhook.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("Delivery %d: %v", id, err), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(r.Context(), "failed to redeliver", "delivery", id, "error", err)
+			http.Error(w, fmt.Sprintf("Error redelivering: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(d)
+	}
+}
@@ -0,0 +1,145 @@
+// Package audit defines the records of the registry's append-only audit
+// trail.
+//
+// Every entry carries the hash of the entry before it and a hash over its
+// own content and that previous hash, so changing, removing or reordering
+// recorded entries breaks the chain and is found by Verify.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionUpload = "library.upload" // a library version was published
+	ActionCache  = "library.cache"  // a proxy stored a version fetched from upstream
+	ActionImport = "library.import" // a version was imported from a bundle
+
+	ActionWebhookCreate = "webhook.create" // a webhook was registered
+	ActionWebhookDelete = "webhook.delete" // a webhook was removed
+)
+
+// Anonymous is the user recorded for requests that are not authenticated.
+const Anonymous = "anonymous"
+
+// Actor is who made a change and from where.
+type Actor struct {
+	User    string `json:"user"`
+	Address string `json:"address,omitempty"`
+}
+
+// LocalActor is the user running a maintenance command on the server
+// itself.
+func LocalActor() Actor {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return Actor{User: name, Address: "local:" + host}
+}
+
+// Entry is one record of the audit log.
+type Entry struct {
+	ID      int64     `json:"id"`
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Address string    `json:"address,omitempty"`
+	Action  string    `json:"action"`
+	// Target names what changed, such as "lib-a@1.0.0".
+	Target string `json:"target"`
+	// Before and After are the JSON states of the target around the
+	// change, null when it didn't exist.
+	Before   json.RawMessage `json:"before"`
+	After    json.RawMessage `json:"after"`
+	PrevHash string          `json:"prev_hash"`
+	Hash     string          `json:"hash"`
+}
+
+// NewEntry returns an entry for a change by actor. before and after are
+// encoded as JSON; nil encodes as null.
+func NewEntry(actor Actor, action, target string, before, after interface{}) (*Entry, error) {
+	b, err := json.Marshal(before)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit state: %w", err)
+	}
+	a, err := json.Marshal(after)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit state: %w", err)
+	}
+	return &Entry{
+		Time:    time.Now().UTC(),
+		User:    actor.User,
+		Address: actor.Address,
+		Action:  action,
+		Target:  target,
+		Before:  b,
+		After:   a,
+	}, nil
+}
+
+// ComputeHash returns the hash of the entry's content and PrevHash. ID and
+// Hash are not covered.
+func (e *Entry) ComputeHash() string {
+	// The field order is fixed by the struct, so the hash can be
+	// recomputed from a stored entry.
+	data, _ := json.Marshal(struct {
+		Time     string          `json:"time"`
+		User     string          `json:"user"`
+		Address  string          `json:"address"`
+		Action   string          `json:"action"`
+		Target   string          `json:"target"`
+		Before   json.RawMessage `json:"before"`
+		After    json.RawMessage `json:"after"`
+		PrevHash string          `json:"prev_hash"`
+	}{e.Time.UTC().Format(time.RFC3339Nano), e.User, e.Address, e.Action, e.Target, orNull(e.Before), orNull(e.After), e.PrevHash})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Seal links the entry to the entry before it and sets its hash.
+func (e *Entry) Seal(prevHash string) {
+	e.PrevHash = prevHash
+	e.Hash = e.ComputeHash()
+}
+
+// Verify checks that entries, in order, form an unbroken chain starting
+// after the entry with hash prevHash ("" for the start of the log).
+func Verify(entries []Entry, prevHash string) error {
+	for _, e := range entries {
+		if e.PrevHash != prevHash {
+			return fmt.Errorf("audit entry %d does not follow the entry before it: chain broken", e.ID)
+		}
+		if hash := e.ComputeHash(); hash != e.Hash {
+			return fmt.Errorf("audit entry %d has been modified: hash %s, recorded %s", e.ID, hash, e.Hash)
+		}
+		prevHash = e.Hash
+	}
+	return nil
+}
+
+func orNull(m json.RawMessage) json.RawMessage {
+	if len(m) == 0 {
+		return json.RawMessage("null")
+	}
+	return m
+}
+
+// Filter selects audit entries. Zero fields match everything.
+type Filter struct {
+	User   string
+	Action string
+	// Library matches entries whose target is any version of it.
+	Library string
+	Since   time.Time
+	Until   time.Time
+	// Limit keeps only the most recent entries.
+	Limit int
+}
@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+)
+
+func chain(t *testing.T, n int) []Entry {
+	t.Helper()
+	var entries []Entry
+	prev := ""
+	for i := 0; i < n; i++ {
+		e, err := NewEntry(Actor{User: "alice", Address: "10.0.0.1"}, ActionUpload, "lib-a@1.0.0", nil, map[string]string{"hash": "abc & <def>"})
+		if err != nil {
+			t.Fatalf("Failed to create entry: %v", err)
+		}
+		e.ID = int64(i + 1)
+		e.Seal(prev)
+		prev = e.Hash
+		entries = append(entries, *e)
+	}
+	return entries
+}
+
+func TestVerify(t *testing.T) {
+	entries := chain(t, 3)
+	if err := Verify(entries, ""); err != nil {
+		t.Fatalf("Expected an intact chain, got %v", err)
+	}
+
+	modified := chain(t, 3)
+	modified[1].User = "mallory"
+	if err := Verify(modified, ""); err == nil || !strings.Contains(err.Error(), "entry 2 has been modified") {
+		t.Errorf("Expected the modified entry to be found, got %v", err)
+	}
+
+	removed := append(chain(t, 3)[:1:1], entries[2])
+	if err := Verify(removed, ""); err == nil || !strings.Contains(err.Error(), "chain broken") {
+		t.Errorf("Expected the removed entry to break the chain, got %v", err)
+	}
+}
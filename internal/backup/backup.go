@@ -0,0 +1,253 @@
+// Package backup takes consistent snapshots of a registry's database and
+// library archives and restores them.
+//
+// A snapshot directory holds a copy of the database, the archives it
+// references below library_files, and backup.json describing the snapshot.
+package backup
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/iamgp/hvr/internal/models"
+	"github.com/iamgp/hvr/internal/storage"
+)
+
+const (
+	// DBName is the name of the database in a snapshot.
+	DBName = "hvpm.db"
+	// FilesDir is the directory holding the archives in a snapshot.
+	FilesDir = "library_files"
+	// InfoName is the name of the snapshot description.
+	InfoName = "backup.json"
+
+	stageSuffix  = ".restore"
+	backupSuffix = ".pre-restore"
+)
+
+// Info describes a snapshot.
+type Info struct {
+	Created   time.Time `json:"created"`
+	Libraries int       `json:"libraries"`
+	Bytes     int64     `json:"bytes"`
+}
+
+// Create writes a snapshot of db and of the archives below filesDir that it
+// references to dest, which must not exist yet. The database is copied
+// first, in one step, and only the archives recorded in that copy are
+// taken, so the snapshot never holds rows without archives even while
+// uploads continue.
+func Create(db *storage.SQLiteDatabase, filesDir, dest string) (*Info, error) {
+	if _, err := os.Stat(dest); err == nil {
+		return nil, fmt.Errorf("%s already exists", dest)
+	}
+	if err := os.MkdirAll(dest, 0755); err != nil {
+		return nil, err
+	}
+
+	info, err := create(db, filesDir, dest)
+	if err != nil {
+		os.RemoveAll(dest)
+		return nil, err
+	}
+	return info, nil
+}
+
+func create(db *storage.SQLiteDatabase, filesDir, dest string) (*Info, error) {
+	info := &Info{Created: time.Now().UTC()}
+
+	snapshotPath := filepath.Join(dest, DBName)
+	if err := db.Backup(snapshotPath); err != nil {
+		return nil, err
+	}
+
+	libraries, err := listLibraries(snapshotPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, lib := range libraries {
+		rel, err := archivePath(filesDir, lib)
+		if err != nil {
+			return nil, err
+		}
+		size, err := copyArchive(lib.FilePath, filepath.Join(dest, FilesDir, rel), lib.Hash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to back up %s %s: %w", lib.Name, lib.Version, err)
+		}
+		info.Libraries++
+		info.Bytes += size
+	}
+
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dest, InfoName), data, 0644); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// Restore replaces the database at dbPath and the archives below filesDir
+// with the snapshot in src. The snapshot is copied next to the live data and
+// checked first: the database must pass the SQLite integrity check and every
+// archive it records must be present and match its hash. Only then is the
+// live data moved aside, with a .pre-restore suffix, and the snapshot moved
+// into its place. The server must not be running.
+func Restore(src, dbPath, filesDir string) (*Info, error) {
+	data, err := os.ReadFile(filepath.Join(src, InfoName))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a registry backup: %w", src, err)
+	}
+	var info Info
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", InfoName, err)
+	}
+
+	stageDB := dbPath + stageSuffix
+	stageFiles := filesDir + stageSuffix
+	os.Remove(stageDB)
+	os.RemoveAll(stageFiles)
+	cleanup := func() {
+		os.Remove(stageDB)
+		os.RemoveAll(stageFiles)
+	}
+
+	if err := stage(src, stageDB, filesDir, stageFiles); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("backup %s failed validation: %w", src, err)
+	}
+
+	if err := swap(stageDB, dbPath); err != nil {
+		cleanup()
+		return nil, err
+	}
+	if err := swap(stageFiles, filesDir); err != nil {
+		// Put the previous database back so data and archives match.
+		os.Rename(dbPath, stageDB)
+		os.Rename(dbPath+backupSuffix, dbPath)
+		cleanup()
+		return nil, err
+	}
+	return &info, nil
+}
+
+// stage copies and checks the snapshot in src, writing the database to
+// stageDB and the archives below stageFiles.
+func stage(src, stageDB, filesDir, stageFiles string) error {
+	if _, err := copyArchive(filepath.Join(src, DBName), stageDB, ""); err != nil {
+		return fmt.Errorf("failed to copy database: %w", err)
+	}
+
+	db, err := storage.NewSQLiteDatabase(stageDB)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	if err := db.Check(); err != nil {
+		return err
+	}
+
+	libraries, err := db.List(time.Time{})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(stageFiles, 0755); err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, lib := range libraries {
+		rel, err := archivePath(filesDir, lib)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if _, err := copyArchive(filepath.Join(src, FilesDir, rel), filepath.Join(stageFiles, rel), lib.Hash); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", lib.Name, lib.Version, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// swap moves staged into the place of live, keeping the previous live copy
+// with a .pre-restore suffix.
+func swap(staged, live string) error {
+	previous := live + backupSuffix
+	if err := os.RemoveAll(previous); err != nil {
+		return err
+	}
+	if err := os.Rename(live, previous); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to move %s aside: %w", live, err)
+	}
+	if err := os.Rename(staged, live); err != nil {
+		os.Rename(previous, live)
+		return fmt.Errorf("failed to move restored data into place: %w", err)
+	}
+	return nil
+}
+
+func listLibraries(dbPath string) ([]models.Library, error) {
+	db, err := storage.NewSQLiteDatabase(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	return db.List(time.Time{})
+}
+
+// archivePath returns the path of a library's archive relative to the file
+// store directory.
+func archivePath(filesDir string, lib models.Library) (string, error) {
+	rel, err := filepath.Rel(filepath.Clean(filesDir), filepath.Clean(lib.FilePath))
+	if err != nil || !filepath.IsLocal(rel) {
+		return "", fmt.Errorf("archive of %s %s is outside %s: %s", lib.Name, lib.Version, filesDir, lib.FilePath)
+	}
+	return rel, nil
+}
+
+// copyArchive copies a file, keeping its modification time, and checks it
+// against the expected SHA-256 unless hash is empty.
+func copyArchive(src, dst, hash string) (int64, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer in.Close()
+	stat, err := in.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return 0, err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return 0, err
+	}
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, h), in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if sum := hex.EncodeToString(h.Sum(nil)); hash != "" && sum != hash {
+		return 0, fmt.Errorf("%s has hash %s, expected %s", src, sum, hash)
+	}
+	return size, os.Chtimes(dst, time.Now(), stat.ModTime())
+}
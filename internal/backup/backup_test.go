@@ -0,0 +1,125 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/services"
+	"github.com/iamgp/hvr/internal/storage"
+)
+
+type registry struct {
+	dir, dbPath, filesDir string
+	db                    *storage.SQLiteDatabase
+	service               *services.LibraryService
+}
+
+func newRegistry(t *testing.T) *registry {
+	t.Helper()
+	r := &registry{dir: t.TempDir()}
+	r.dbPath = filepath.Join(r.dir, "hvpm.db")
+	r.filesDir = filepath.Join(r.dir, "library_files")
+	r.open(t)
+	return r
+}
+
+func (r *registry) open(t *testing.T) {
+	t.Helper()
+	db, err := storage.NewSQLiteDatabase(r.dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	fileStore, err := storage.NewLocalFileStore(r.filesDir)
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+	r.db = db
+	r.service = services.NewLibraryService(db, fileStore)
+	t.Cleanup(func() { db.Close() })
+}
+
+func (r *registry) publish(t *testing.T, name, version string) {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	f, _ := w.Create(name + ".hsl")
+	f.Write([]byte("// " + name + " " + version + "\n"))
+	w.Close()
+
+	if _, err := r.service.Upload(context.Background(), audit.Actor{User: "test"}, name, version, "", "", "", nil, buf, time.Now(), "", ""); err != nil {
+		t.Fatalf("Failed to publish %s %s: %v", name, version, err)
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	r := newRegistry(t)
+	r.publish(t, "lib-a", "1.0.0")
+	r.publish(t, "lib-b", "2.0.0")
+
+	dest := filepath.Join(t.TempDir(), "snapshot")
+	info, err := Create(r.db, r.filesDir, dest)
+	if err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	if info.Libraries != 2 {
+		t.Errorf("Expected 2 library versions in the backup, got %d", info.Libraries)
+	}
+	if _, err := Create(r.db, r.filesDir, dest); err == nil {
+		t.Errorf("Expected an existing backup directory to be refused")
+	}
+
+	// Changes after the snapshot are undone by restoring it.
+	r.publish(t, "lib-c", "1.0.0")
+	r.db.Close()
+
+	if _, err := Restore(dest, r.dbPath, r.filesDir); err != nil {
+		t.Fatalf("Failed to restore: %v", err)
+	}
+	r.open(t)
+
+	content, _, lib, err := r.service.Download(context.Background(), "lib-a", "1.0.0")
+	if err != nil {
+		t.Fatalf("Failed to download restored library: %v", err)
+	}
+	if len(content) == 0 || lib.Hash == "" {
+		t.Errorf("Expected the restored archive to be served")
+	}
+	if _, err := r.db.Get("lib-c", "1.0.0"); err == nil {
+		t.Errorf("Expected lib-c, published after the backup, to be gone")
+	}
+	if _, err := os.Stat(r.dbPath + backupSuffix); err != nil {
+		t.Errorf("Expected the previous database to be kept: %v", err)
+	}
+}
+
+func TestRestoreRejectsCorruptBackup(t *testing.T) {
+	r := newRegistry(t)
+	r.publish(t, "lib-a", "1.0.0")
+
+	dest := filepath.Join(t.TempDir(), "snapshot")
+	if _, err := Create(r.db, r.filesDir, dest); err != nil {
+		t.Fatalf("Failed to back up: %v", err)
+	}
+	os.WriteFile(filepath.Join(dest, FilesDir, "lib-a", "1.0.0.zip"), []byte("corrupt"), 0644)
+
+	r.publish(t, "lib-b", "1.0.0")
+	_, err := Restore(dest, r.dbPath, r.filesDir)
+	if err == nil || !strings.Contains(err.Error(), "failed validation") {
+		t.Fatalf("Expected the corrupt backup to be rejected, got %v", err)
+	}
+
+	// The live data is untouched.
+	if _, err := r.db.Get("lib-b", "1.0.0"); err != nil {
+		t.Errorf("Expected the live database to be kept: %v", err)
+	}
+	if _, err := os.Stat(r.dbPath + stageSuffix); !os.IsNotExist(err) {
+		t.Errorf("Expected the staged copy to be removed")
+	}
+}
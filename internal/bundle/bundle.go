@@ -0,0 +1,263 @@
+// Package bundle reads and writes registry bundles: tar archives holding
+// library archives together with everything needed to verify and register
+// them in another registry, for transfers between networks with no route
+// between them.
+//
+// A bundle contains manifest.json, describing every library version, and
+// one blob per archive at blobs/sha256/<hash>.
+package bundle
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// Format identifies bundle manifests.
+	Format = "hvr-bundle"
+	// FormatVersion is the manifest version written by this package.
+	FormatVersion = 1
+	// ManifestName is the name of the manifest inside the bundle.
+	ManifestName = "manifest.json"
+
+	blobPrefix = "blobs/sha256/"
+)
+
+// Manifest describes the contents of a bundle.
+type Manifest struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Created   time.Time `json:"created"`
+	Libraries []Library `json:"libraries"`
+}
+
+// Library describes one library version in a bundle.
+type Library struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Description  string            `json:"description,omitempty"`
+	Author       string            `json:"author,omitempty"`
+	RepoURL      string            `json:"repo_url,omitempty"`
+	Hash         string            `json:"hash"`
+	Size         int64             `json:"size"`
+	ModTime      time.Time         `json:"mod_time"`
+	PublishedAt  time.Time         `json:"published_at"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	// Resolved maps each dependency to the version it resolved to on the
+	// exporting registry.
+	Resolved   map[string]string `json:"resolved,omitempty"`
+	Signature  string            `json:"signature,omitempty"`
+	SigningKey string            `json:"signing_key,omitempty"`
+}
+
+// BlobPath returns the path of the archive with the given SHA-256 inside a
+// bundle.
+func BlobPath(hash string) string {
+	return blobPrefix + hash
+}
+
+// Write writes a bundle with the given manifest to w. blob returns the
+// archive of each library, which must match its hash and size.
+func Write(w io.Writer, m *Manifest, blob func(Library) ([]byte, error)) error {
+	m.Format = Format
+	m.Version = FormatVersion
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeFile(tw, ManifestName, data, m.Created); err != nil {
+		return err
+	}
+
+	written := make(map[string]bool)
+	for _, lib := range m.Libraries {
+		if written[lib.Hash] {
+			continue
+		}
+		content, err := blob(lib)
+		if err != nil {
+			return fmt.Errorf("failed to read %s %s: %w", lib.Name, lib.Version, err)
+		}
+		if hash := hashBytes(content); hash != lib.Hash || int64(len(content)) != lib.Size {
+			return fmt.Errorf("archive of %s %s has hash %s, expected %s", lib.Name, lib.Version, hash, lib.Hash)
+		}
+		if err := writeFile(tw, BlobPath(lib.Hash), content, lib.ModTime); err != nil {
+			return err
+		}
+		written[lib.Hash] = true
+	}
+	return tw.Close()
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  modTime,
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := tw.Write(data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// Bundle is an opened and verified bundle.
+type Bundle struct {
+	Manifest *Manifest
+	dir      string
+}
+
+// Open reads the bundle at path, checking every blob against its SHA-256
+// and every library in the manifest against its blob. The blobs are
+// unpacked into a temporary directory that Close removes.
+func Open(path string) (*Bundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir, err := os.MkdirTemp("", "hvr-bundle-")
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{dir: dir}
+	if err := b.read(f); err != nil {
+		b.Close()
+		return nil, fmt.Errorf("invalid bundle %s: %w", path, err)
+	}
+	return b, nil
+}
+
+func (b *Bundle) read(r io.Reader) error {
+	sizes := make(map[string]int64)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return fmt.Errorf("unexpected entry %s", hdr.Name)
+		}
+
+		switch {
+		case hdr.Name == ManifestName:
+			if b.Manifest != nil {
+				return errors.New("duplicate manifest")
+			}
+			var m Manifest
+			if err := json.NewDecoder(tr).Decode(&m); err != nil {
+				return fmt.Errorf("failed to decode manifest: %w", err)
+			}
+			b.Manifest = &m
+		case strings.HasPrefix(hdr.Name, blobPrefix):
+			hash := strings.TrimPrefix(hdr.Name, blobPrefix)
+			if !validHash(hash) {
+				return fmt.Errorf("unexpected entry %s", hdr.Name)
+			}
+			size, err := b.extract(hash, tr)
+			if err != nil {
+				return err
+			}
+			sizes[hash] = size
+		default:
+			return fmt.Errorf("unexpected entry %s", hdr.Name)
+		}
+	}
+
+	m := b.Manifest
+	if m == nil {
+		return errors.New("no manifest")
+	}
+	if m.Format != Format {
+		return fmt.Errorf("unknown format %q", m.Format)
+	}
+	if m.Version > FormatVersion {
+		return fmt.Errorf("bundle format version %d is newer than the supported version %d", m.Version, FormatVersion)
+	}
+
+	seen := make(map[string]bool)
+	for _, lib := range m.Libraries {
+		key := lib.Name + "@" + lib.Version
+		if seen[key] {
+			return fmt.Errorf("%s %s is listed twice", lib.Name, lib.Version)
+		}
+		seen[key] = true
+
+		size, ok := sizes[lib.Hash]
+		if !ok {
+			return fmt.Errorf("archive of %s %s is missing", lib.Name, lib.Version)
+		}
+		if size != lib.Size {
+			return fmt.Errorf("archive of %s %s is %d bytes, expected %d", lib.Name, lib.Version, size, lib.Size)
+		}
+	}
+	return nil
+}
+
+// extract writes a blob to the bundle directory and checks it against the
+// hash it is named after.
+func (b *Bundle) extract(hash string, r io.Reader) (int64, error) {
+	out, err := os.Create(filepath.Join(b.dir, hash))
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, h), r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read blob %s: %w", hash, err)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != hash {
+		return 0, fmt.Errorf("blob %s has hash %s", hash, sum)
+	}
+	return size, nil
+}
+
+// Blob returns the archive with the given SHA-256.
+func (b *Bundle) Blob(hash string) ([]byte, error) {
+	if !validHash(hash) {
+		return nil, fmt.Errorf("invalid hash %q", hash)
+	}
+	return os.ReadFile(filepath.Join(b.dir, hash))
+}
+
+// Close removes the unpacked blobs.
+func (b *Bundle) Close() error {
+	return os.RemoveAll(b.dir)
+}
+
+func hashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil && strings.ToLower(hash) == hash
+}
@@ -0,0 +1,118 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+func writeBundle(t *testing.T, blobs map[string][]byte) (string, *Manifest) {
+	t.Helper()
+	m := &Manifest{Created: time.Now().UTC()}
+	for name, content := range blobs {
+		m.Libraries = append(m.Libraries, Library{Name: name, Version: "1.0.0", Hash: hashBytes(content), Size: int64(len(content))})
+	}
+
+	path := filepath.Join(t.TempDir(), "bundle.tar")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	defer f.Close()
+	err = Write(f, m, func(lib Library) ([]byte, error) { return blobs[lib.Name], nil })
+	if err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+	return path, m
+}
+
+func TestWriteAndOpen(t *testing.T) {
+	path, _ := writeBundle(t, map[string][]byte{"lib-a": []byte("archive a"), "lib-b": []byte("archive b")})
+
+	b, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer b.Close()
+
+	if b.Manifest.Format != Format || len(b.Manifest.Libraries) != 2 {
+		t.Fatalf("Unexpected manifest: %+v", b.Manifest)
+	}
+	content, err := b.Blob(hashBytes([]byte("archive a")))
+	if err != nil || string(content) != "archive a" {
+		t.Errorf("Expected the archive of lib-a, got %q, %v", content, err)
+	}
+}
+
+func TestOpenRejectsTamperedBlob(t *testing.T) {
+	path, _ := writeBundle(t, map[string][]byte{"lib-a": []byte("archive a")})
+
+	// Rewrite the bundle with the blob content changed but its name kept.
+	data, _ := os.ReadFile(path)
+	tr := tar.NewReader(bytes.NewReader(data))
+	out := new(bytes.Buffer)
+	tw := tar.NewWriter(out)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		content, _ := io.ReadAll(tr)
+		if strings.HasPrefix(hdr.Name, blobPrefix) {
+			content = []byte("archive A")
+		}
+		tw.WriteHeader(hdr)
+		tw.Write(content)
+	}
+	tw.Close()
+	os.WriteFile(path, out.Bytes(), 0644)
+
+	if _, err := Open(path); err == nil || !strings.Contains(err.Error(), "has hash") {
+		t.Errorf("Expected a hash mismatch, got %v", err)
+	}
+}
+
+func TestWriteRejectsWrongArchive(t *testing.T) {
+	m := &Manifest{Libraries: []Library{{Name: "lib-a", Version: "1.0.0", Hash: hashBytes([]byte("a")), Size: 1}}}
+	err := Write(io.Discard, m, func(Library) ([]byte, error) { return []byte("b"), nil })
+	if err == nil {
+		t.Errorf("Expected an archive that doesn't match its hash to be rejected")
+	}
+}
+
+func TestParseSelectors(t *testing.T) {
+	selectors, err := ParseSelectors("plate-*, logging@^2.0.0")
+	if err != nil {
+		t.Fatalf("Failed to parse selectors: %v", err)
+	}
+
+	tests := []struct {
+		name, version string
+		want          bool
+	}{
+		{"plate-utils", "1.0.0", true},
+		{"logging", "2.1.0", true},
+		{"logging", "1.9.0", false},
+		{"other", "1.0.0", false},
+	}
+	for _, tt := range tests {
+		v := semver.MustParse(tt.version)
+		got := selectors[0].Match(tt.name, v) || selectors[1].Match(tt.name, v)
+		if got != tt.want {
+			t.Errorf("Match(%s %s) = %v, expected %v", tt.name, tt.version, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"", "lib@not-a-version", "[", "@1.0.0"} {
+		if _, err := ParseSelectors(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+}
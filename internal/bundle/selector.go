@@ -0,0 +1,56 @@
+package bundle
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+)
+
+// Selector picks library versions by name and version. It is written as
+// pattern[@constraint], where pattern is a glob matched against the library
+// name and constraint a semver constraint; without a constraint every
+// version matches.
+type Selector struct {
+	Pattern    string
+	Constraint *semver.Constraints
+}
+
+// ParseSelectors parses a comma-separated list of selectors, such as
+// "plate-*,logging@^2.0.0".
+func ParseSelectors(s string) ([]Selector, error) {
+	var selectors []Selector
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		sel := Selector{Pattern: item}
+		if i := strings.Index(item, "@"); i >= 0 {
+			sel.Pattern = item[:i]
+			c, err := semver.NewConstraint(item[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("invalid version constraint in %q: %w", item, err)
+			}
+			sel.Constraint = c
+		}
+		if _, err := path.Match(sel.Pattern, ""); err != nil || sel.Pattern == "" {
+			return nil, fmt.Errorf("invalid library pattern in %q", item)
+		}
+		selectors = append(selectors, sel)
+	}
+	if len(selectors) == 0 {
+		return nil, fmt.Errorf("no libraries selected")
+	}
+	return selectors, nil
+}
+
+// Match reports whether the selector picks the given library version.
+func (s Selector) Match(name string, version *semver.Version) bool {
+	if ok, _ := path.Match(s.Pattern, name); !ok {
+		return false
+	}
+	return s.Constraint == nil || s.Constraint.Check(version)
+}
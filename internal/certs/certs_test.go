@@ -0,0 +1,158 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// issue creates a certificate for cn signed by parent, or self-signed when
+// parent is nil.
+func issue(t *testing.T, cn string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCert{cert: cert, key: key}
+}
+
+// write stores the certificate and key as PEM files named after name.
+func (c *testCert) write(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatalf("Failed to encode key: %v", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw}), 0600); err != nil {
+		t.Fatalf("Failed to write certificate: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	return certFile, keyFile
+}
+
+func TestMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "Test CA", nil, true)
+	caFile, _ := ca.write(t, dir, "ca")
+	serverCert, serverKey := issue(t, "registry-1", ca, false).write(t, dir, "server")
+	clientCert, clientKey := issue(t, "alice", ca, false).write(t, dir, "client")
+
+	reloader, err := NewReloader(serverCert, serverKey, caFile)
+	if err != nil {
+		t.Fatalf("Failed to load server certificate: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(Identity(r.TLS.VerifiedChains[0][0])))
+	}))
+	server.TLS = reloader.TLSConfig(true)
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(caFile, certFile, keyFile string) (string, string, error) {
+		cfg, err := ClientConfig(caFile, certFile, keyFile)
+		if err != nil {
+			t.Fatalf("Failed to create client config: %v", err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: cfg}}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return "", "", err
+		}
+		defer resp.Body.Close()
+		body := make([]byte, 64)
+		n, _ := resp.Body.Read(body)
+		return string(body[:n]), resp.TLS.PeerCertificates[0].Subject.CommonName, nil
+	}
+
+	user, serverName, err := get(caFile, clientCert, clientKey)
+	if err != nil {
+		t.Fatalf("Failed to connect with a client certificate: %v", err)
+	}
+	if user != "alice" || serverName != "registry-1" {
+		t.Errorf("Expected user alice on registry-1, got %q on %q", user, serverName)
+	}
+	if _, _, err := get(caFile, "", ""); err == nil {
+		t.Error("Expected a client without a certificate to be refused")
+	}
+
+	// A renewed server certificate is used after Reload, and unreadable
+	// files keep the current one.
+	issue(t, "registry-2", ca, false).write(t, dir, "server")
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("Failed to reload: %v", err)
+	}
+	if _, serverName, err = get(caFile, clientCert, clientKey); err != nil || serverName != "registry-2" {
+		t.Errorf("Expected the renewed certificate, got %q, %v", serverName, err)
+	}
+	os.WriteFile(serverCert, []byte("garbage"), 0600)
+	if err := reloader.Reload(); err == nil {
+		t.Error("Expected reloading a broken certificate to fail")
+	}
+	if _, serverName, err = get(caFile, clientCert, clientKey); err != nil || serverName != "registry-2" {
+		t.Errorf("Expected the previous certificate to stay in use, got %q, %v", serverName, err)
+	}
+}
+
+func TestClientConfig(t *testing.T) {
+	if cfg, err := ClientConfig("", "", ""); cfg != nil || err != nil {
+		t.Errorf("Expected no config without settings, got %v, %v", cfg, err)
+	}
+	if _, err := ClientConfig("", "client.crt", ""); err == nil {
+		t.Error("Expected an error for a certificate without a key")
+	}
+	if _, err := ClientConfig(filepath.Join(t.TempDir(), "missing.pem"), "", ""); err == nil {
+		t.Error("Expected an error for a missing CA bundle")
+	}
+}
+
+func TestIdentity(t *testing.T) {
+	if id := Identity(&x509.Certificate{Subject: pkix.Name{CommonName: "alice"}, EmailAddresses: []string{"a@example.com"}}); id != "alice" {
+		t.Errorf("Expected the common name, got %q", id)
+	}
+	if id := Identity(&x509.Certificate{EmailAddresses: []string{"bob@example.com"}}); id != "bob@example.com" {
+		t.Errorf("Expected the email address, got %q", id)
+	}
+}
@@ -5,14 +5,20 @@ import (
 
 	"github.com/Masterminds/semver/v3"
 	"github.com/iamgp/hvr/internal/models"
-	"github.com/iamgp/hvr/internal/storage"
 )
 
+// Source provides the library versions the resolver chooses from.
+// *storage.SQLiteDatabase is a Source.
+type Source interface {
+	GetAllVersions(name string) ([]*semver.Version, error)
+	Get(name, version string) (models.Library, error)
+}
+
 type Resolver struct {
-	db *storage.SQLiteDatabase
+	db Source
 }
 
-func NewResolver(db *storage.SQLiteDatabase) *Resolver {
+func NewResolver(db Source) *Resolver {
 	return &Resolver{db: db}
 }
 
@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(&buf, "json", "warn")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	ctx := WithRequestID(context.Background(), "abc123")
+	logger.InfoContext(ctx, "hidden")
+	logger.WarnContext(ctx, "shown", "library", "lib-a")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 record at level warn, got %d:\n%s", len(lines), buf.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Failed to parse record: %v", err)
+	}
+	if record["msg"] != "shown" || record["request_id"] != "abc123" || record["library"] != "lib-a" {
+		t.Errorf("Unexpected record: %v", record)
+	}
+
+	buf.Reset()
+	logger.With("component", "test").Warn("no request")
+	if strings.Contains(buf.String(), "request_id") {
+		t.Errorf("Expected no request ID without one in the context: %s", buf.String())
+	}
+
+	if _, err := New(&buf, "xml", "info"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+	if _, err := New(&buf, "text", "loud"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	for id, want := range map[string]bool{
+		NewRequestID():           true,
+		"client-1.2_3:4":         true,
+		"":                       false,
+		"has space":              false,
+		"line\nbreak":            false,
+		strings.Repeat("a", 129): false,
+	} {
+		if got := ValidRequestID(id); got != want {
+			t.Errorf("ValidRequestID(%q) = %v, expected %v", id, got, want)
+		}
+	}
+}
@@ -0,0 +1,349 @@
+// Package metrics keeps server metrics and writes them in the Prometheus
+// text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Registry holds a set of metrics.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	scrape  []func()
+}
+
+type metric interface {
+	write(w io.Writer) error
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// OnScrape registers f to be called before the metrics are written, to
+// update values that are only worth computing when they are read.
+func (r *Registry) OnScrape(f func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.scrape = append(r.scrape, f)
+}
+
+// Write writes every metric in the registry to w.
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	scrape := append([]func(){}, r.scrape...)
+	r.mu.Unlock()
+
+	for _, f := range scrape {
+		f()
+	}
+
+	for _, m := range metrics {
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves the registry for Prometheus to scrape.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// value is a float64 that can be updated concurrently.
+type value struct {
+	bits uint64
+}
+
+func (v *value) load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&v.bits))
+}
+
+func (v *value) store(f float64) {
+	atomic.StoreUint64(&v.bits, math.Float64bits(f))
+}
+
+func (v *value) add(f float64) {
+	for {
+		old := atomic.LoadUint64(&v.bits)
+		if atomic.CompareAndSwapUint64(&v.bits, old, math.Float64bits(math.Float64frombits(old)+f)) {
+			return
+		}
+	}
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	name, help string
+	v          value
+}
+
+// NewGauge registers a gauge.
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	r.register(g)
+	return g
+}
+
+// Set sets the gauge to f.
+func (g *Gauge) Set(f float64) { g.v.store(f) }
+
+// Add adds f, which may be negative, to the gauge.
+func (g *Gauge) Add(f float64) { g.v.add(f) }
+
+// Value returns the current value of the gauge.
+func (g *Gauge) Value() float64 { return g.v.load() }
+
+func (g *Gauge) write(w io.Writer) error {
+	return writeSample(w, g.name, g.help, "gauge", g.v.load())
+}
+
+// Counter is a value that only goes up.
+type Counter struct {
+	name, help string
+	v          value
+}
+
+// NewCounter registers a counter.
+func (r *Registry) NewCounter(name, help string) *Counter {
+	c := &Counter{name: name, help: help}
+	r.register(c)
+	return c
+}
+
+// Inc adds one to the counter.
+func (c *Counter) Inc() { c.v.add(1) }
+
+// Add adds f to the counter. Negative values are ignored.
+func (c *Counter) Add(f float64) {
+	if f > 0 {
+		c.v.add(f)
+	}
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() float64 { return c.v.load() }
+
+func (c *Counter) write(w io.Writer) error {
+	return writeSample(w, c.name, c.help, "counter", c.v.load())
+}
+
+// CounterVec is a set of counters told apart by label values.
+type CounterVec struct {
+	name, help string
+	vec        vec[*Counter]
+}
+
+// NewCounterVec registers a counter with the given label names.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, vec: newVec(labels, func() *Counter { return &Counter{} })}
+	r.register(c)
+	return c
+}
+
+// With returns the counter for the label values, in the order the labels
+// were given.
+func (c *CounterVec) With(values ...string) *Counter { return c.vec.with(values) }
+
+func (c *CounterVec) write(w io.Writer) error {
+	if err := writeHeader(w, c.name, c.help, "counter"); err != nil {
+		return err
+	}
+	return c.vec.each(func(labels string, counter *Counter) error {
+		return writeValue(w, c.name, labels, counter.v.load())
+	})
+}
+
+// DefaultBuckets are histogram buckets for durations in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     value
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+// Observe records one observation.
+func (h *Histogram) Observe(f float64) {
+	if i := sort.SearchFloat64s(h.buckets, f); i < len(h.buckets) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+	h.sum.add(f)
+	atomic.AddUint64(&h.count, 1)
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 { return atomic.LoadUint64(&h.count) }
+
+// Sum returns the sum of all observations.
+func (h *Histogram) Sum() float64 { return h.sum.load() }
+
+func (h *Histogram) writeSamples(w io.Writer, name, labels string) error {
+	var cumulative uint64
+	for i, upper := range h.buckets {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		if err := writeValue(w, name+"_bucket", joinLabels(labels, `le="`+formatValue(upper)+`"`), float64(cumulative)); err != nil {
+			return err
+		}
+	}
+	count := float64(h.Count())
+	if err := writeValue(w, name+"_bucket", joinLabels(labels, `le="+Inf"`), count); err != nil {
+		return err
+	}
+	if err := writeValue(w, name+"_sum", labels, h.sum.load()); err != nil {
+		return err
+	}
+	return writeValue(w, name+"_count", labels, count)
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds,
+// in increasing order.
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	return r.NewHistogramVec(name, help, buckets).With()
+}
+
+// HistogramVec is a set of histograms told apart by label values.
+type HistogramVec struct {
+	name, help string
+	vec        vec[*Histogram]
+}
+
+// NewHistogramVec registers a histogram with the given upper bucket
+// bounds, in increasing order, and label names.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{name: name, help: help, vec: newVec(labels, func() *Histogram { return newHistogram(buckets) })}
+	r.register(h)
+	return h
+}
+
+// With returns the histogram for the label values, in the order the labels
+// were given.
+func (h *HistogramVec) With(values ...string) *Histogram { return h.vec.with(values) }
+
+func (h *HistogramVec) write(w io.Writer) error {
+	if err := writeHeader(w, h.name, h.help, "histogram"); err != nil {
+		return err
+	}
+	return h.vec.each(func(labels string, hist *Histogram) error {
+		return hist.writeSamples(w, h.name, labels)
+	})
+}
+
+// vec keeps one metric per combination of label values.
+type vec[M any] struct {
+	labels []string
+	create func() M
+
+	mu       sync.Mutex
+	children map[string]M
+}
+
+func newVec[M any](labels []string, create func() M) vec[M] {
+	return vec[M]{labels: labels, create: create, children: make(map[string]M)}
+}
+
+func (v *vec[M]) with(values []string) M {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(v.labels)))
+	}
+	pairs := make([]string, len(values))
+	for i, value := range values {
+		pairs[i] = v.labels[i] + `="` + escapeLabel(value) + `"`
+	}
+	key := strings.Join(pairs, ",")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	m, ok := v.children[key]
+	if !ok {
+		m = v.create()
+		v.children[key] = m
+	}
+	return m
+}
+
+// each calls f for every child in label order.
+func (v *vec[M]) each(f func(labels string, m M) error) error {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	children := make(map[string]M, len(v.children))
+	for k, m := range v.children {
+		children[k] = m
+	}
+	v.mu.Unlock()
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		if err := f(k, children[k]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func joinLabels(a, b string) string {
+	if a == "" {
+		return b
+	}
+	return a + "," + b
+}
+
+func writeSample(w io.Writer, name, help, typ string, v float64) error {
+	if err := writeHeader(w, name, help, typ); err != nil {
+		return err
+	}
+	return writeValue(w, name, "", v)
+}
+
+func writeHeader(w io.Writer, name, help, typ string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	return err
+}
+
+func writeValue(w io.Writer, name, labels string, v float64) error {
+	if labels != "" {
+		name += "{" + labels + "}"
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", name, formatValue(v))
+	return err
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,76 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryHandler(t *testing.T) {
+	r := NewRegistry()
+	g := r.NewGauge("test_gauge", "A gauge.")
+	c := r.NewCounter("test_total", "A counter.")
+	g.Set(2.5)
+	g.Add(-1)
+	c.Inc()
+	c.Add(2)
+	c.Add(-5)
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	want := `# HELP test_gauge A gauge.
+# TYPE test_gauge gauge
+test_gauge 1.5
+# HELP test_total A counter.
+# TYPE test_total counter
+test_total 3
+`
+	if got := rec.Body.String(); got != want {
+		t.Errorf("Unexpected output:\n%s\nexpected:\n%s", got, want)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %s", ct)
+	}
+}
+
+func TestLabeledMetrics(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests.", "route", "status")
+	latency := r.NewHistogramVec("test_seconds", "Latency.", []float64{0.1, 1}, "route")
+	scrapes := r.NewGauge("test_scrapes", "Scrapes.")
+	r.OnScrape(func() { scrapes.Add(1) })
+
+	requests.With("/b", "200").Inc()
+	requests.With("/a", "404").Inc()
+	requests.With("/b", "200").Inc()
+	requests.With(`/"x"`, "500").Inc()
+	latency.With("/a").Observe(0.05)
+	latency.With("/a").Observe(0.1)
+	latency.With("/a").Observe(3)
+
+	var b strings.Builder
+	if err := r.Write(&b); err != nil {
+		t.Fatalf("Failed to write metrics: %v", err)
+	}
+
+	want := `# HELP test_requests_total Requests.
+# TYPE test_requests_total counter
+test_requests_total{route="/\"x\"",status="500"} 1
+test_requests_total{route="/a",status="404"} 1
+test_requests_total{route="/b",status="200"} 2
+# HELP test_seconds Latency.
+# TYPE test_seconds histogram
+test_seconds_bucket{route="/a",le="0.1"} 2
+test_seconds_bucket{route="/a",le="1"} 2
+test_seconds_bucket{route="/a",le="+Inf"} 3
+test_seconds_sum{route="/a"} 3.15
+test_seconds_count{route="/a"} 3
+# HELP test_scrapes Scrapes.
+# TYPE test_scrapes gauge
+test_scrapes 1
+`
+	if got := b.String(); got != want {
+		t.Errorf("Unexpected output:\n%s\nexpected:\n%s", got, want)
+	}
+}
@@ -1,6 +1,10 @@
 package models
 
-import "github.com/Masterminds/semver/v3"
+import (
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+)
 
 type Library struct {
 	Name         string            `json:"name"`
@@ -11,4 +15,37 @@ type Library struct {
 	FilePath     string            `json:"file_path"`
 	Hash         string            `json:"hash"`
 	Dependencies map[string]string `json:"dependencies"`
+	Signature    string            `json:"signature,omitempty"`
+	SigningKey   string            `json:"signing_key,omitempty"`
+	// PublishedAt is when the version was published to this registry. It
+	// is zero for versions published before it was recorded.
+	PublishedAt time.Time `json:"published_at"`
+	// Changelog holds the release notes for the version, taken from the
+	// CHANGELOG file of its archive.
+	Changelog string `json:"changelog,omitempty"`
+	// Files lists the archive contents. It is written by Save but only
+	// loaded on request, see SQLiteDatabase.GetFiles.
+	Files []LibraryFile `json:"files,omitempty"`
+}
+
+// LibraryFile describes a single file inside a library archive.
+type LibraryFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+
+	// The remaining fields come from the Hamilton checksum footer of Venus
+	// files and are empty when the file has none.
+	HasFooter     bool   `json:"has_footer"`
+	Author        string `json:"author,omitempty"`
+	Valid         string `json:"valid,omitempty"`
+	Time          string `json:"time,omitempty"`
+	Checksum      string `json:"checksum,omitempty"`
+	ChecksumValid bool   `json:"checksum_valid"`
+}
+
+// FileMatch names a library version whose archive contains Path.
+type FileMatch struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Path    string `json:"path"`
 }
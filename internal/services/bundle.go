@@ -0,0 +1,305 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/bundle"
+	"github.com/iamgp/hvr/internal/dependency"
+	"github.com/iamgp/hvr/internal/models"
+)
+
+// Export writes a bundle of the library versions picked by selectors to w,
+// together with the versions they resolve their dependencies to when
+// withDependencies is set. Dependencies are listed before the libraries that
+// need them.
+func (s *LibraryService) Export(w io.Writer, selectors []bundle.Selector, withDependencies bool) (*bundle.Manifest, error) {
+	all, err := s.db.List(time.Time{})
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]models.Library)
+	var queue []models.Library
+	for _, lib := range all {
+		for _, sel := range selectors {
+			if sel.Match(lib.Name, lib.Version) {
+				selected[libraryKey(lib.Name, lib.Version.String())] = lib
+				queue = append(queue, lib)
+				break
+			}
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no library versions match the selection")
+	}
+
+	// Only local content is exported, even from a proxy.
+	resolver := dependency.NewResolver(s.db)
+	resolved := make(map[string]map[string]string)
+	for len(queue) > 0 {
+		lib := queue[0]
+		queue = queue[1:]
+
+		deps, err := resolver.ResolveDependencies(lib)
+		if err != nil {
+			return nil, fmt.Errorf("cannot resolve dependencies of %s %s: %w", lib.Name, lib.Version, err)
+		}
+		edges := make(map[string]string)
+		for _, dep := range deps {
+			if _, direct := lib.Dependencies[dep.Name]; direct {
+				edges[dep.Name] = dep.Version.String()
+			}
+			key := libraryKey(dep.Name, dep.Version.String())
+			if _, ok := selected[key]; !ok && withDependencies {
+				selected[key] = dep
+				queue = append(queue, dep)
+			}
+		}
+		resolved[libraryKey(lib.Name, lib.Version.String())] = edges
+	}
+
+	manifest := &bundle.Manifest{Created: time.Now().UTC()}
+	paths := make(map[string]string)
+	for _, key := range dependencyOrder(selected, resolved) {
+		lib := selected[key]
+		content, modTime, err := s.fileStore.Get(lib.FilePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s %s: %w", lib.Name, lib.Version, err)
+		}
+		if hash := hashContent(content); hash != lib.Hash {
+			return nil, fmt.Errorf("stored archive of %s %s has hash %s, expected %s", lib.Name, lib.Version, hash, lib.Hash)
+		}
+
+		manifest.Libraries = append(manifest.Libraries, bundle.Library{
+			Name:         lib.Name,
+			Version:      lib.Version.String(),
+			Description:  lib.Description,
+			Author:       lib.Author,
+			RepoURL:      lib.RepoURL,
+			Hash:         lib.Hash,
+			Size:         int64(len(content)),
+			ModTime:      modTime.UTC(),
+			PublishedAt:  lib.PublishedAt,
+			Dependencies: lib.Dependencies,
+			Resolved:     resolved[key],
+			Signature:    lib.Signature,
+			SigningKey:   lib.SigningKey,
+		})
+		paths[key] = lib.FilePath
+	}
+
+	err = bundle.Write(w, manifest, func(lib bundle.Library) ([]byte, error) {
+		content, _, err := s.fileStore.Get(paths[libraryKey(lib.Name, lib.Version)])
+		return content, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// dependencyOrder sorts library keys so that every library comes after the
+// versions it resolved its dependencies to.
+func dependencyOrder(libraries map[string]models.Library, resolved map[string]map[string]string) []string {
+	keys := make([]string, 0, len(libraries))
+	for key := range libraries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := libraries[keys[i]], libraries[keys[j]]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Version.LessThan(b.Version)
+	})
+
+	var ordered []string
+	visited := make(map[string]bool)
+	var visit func(key string)
+	visit = func(key string) {
+		if visited[key] {
+			return
+		}
+		visited[key] = true
+
+		deps := make([]string, 0, len(resolved[key]))
+		for name, version := range resolved[key] {
+			deps = append(deps, libraryKey(name, version))
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if _, ok := libraries[dep]; ok {
+				visit(dep)
+			}
+		}
+		ordered = append(ordered, key)
+	}
+	for _, key := range keys {
+		visit(key)
+	}
+	return ordered
+}
+
+// ImportStatus reports what Import did, or would do, with one library
+// version of a bundle.
+type ImportStatus struct {
+	Name    string
+	Version string
+	// Present is set when the registry already had the version.
+	Present bool
+}
+
+// Import adds the library versions of a bundle that the registry doesn't
+// have yet. Versions it already has are skipped after checking their hash, so
+// importing a bundle twice is harmless; versions it has with a different
+// hash are reported and skipped. Every archive is verified before anything
+// is stored, so a bundle with a damaged or wrongly signed archive imports
+// nothing. With check set, the bundle is only verified.
+func (s *LibraryService) Import(actor audit.Actor, b *bundle.Bundle, check bool) ([]ImportStatus, error) {
+	var statuses []ImportStatus
+	var pending []pendingImport
+	var errs, conflicts []error
+	for _, entry := range b.Manifest.Libraries {
+		status, p, err := s.prepareImport(b, entry)
+		if err != nil {
+			err = fmt.Errorf("%s %s: %w", entry.Name, entry.Version, err)
+			if errors.Is(err, errImportConflict) {
+				conflicts = append(conflicts, err)
+			} else {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		statuses = append(statuses, status)
+		if p != nil {
+			pending = append(pending, *p)
+		}
+	}
+	if len(errs) > 0 {
+		return statuses, fmt.Errorf("%d of %d library versions failed verification, nothing was imported:\n%w", len(errs), len(b.Manifest.Libraries), errors.Join(errs...))
+	}
+	if check {
+		return statuses, nil
+	}
+
+	errs = conflicts
+	for _, p := range pending {
+		if err := s.storeImport(actor, b, p); err != nil {
+			errs = append(errs, fmt.Errorf("%s %s: %w", p.library.Name, p.library.Version, err))
+		}
+	}
+	if len(errs) > 0 {
+		return statuses, fmt.Errorf("failed to import %d of %d library versions:\n%w", len(errs), len(b.Manifest.Libraries), errors.Join(errs...))
+	}
+	return statuses, nil
+}
+
+// errImportConflict is returned for bundle versions the registry already has
+// with a different hash.
+var errImportConflict = errors.New("registry already has this version")
+
+// pendingImport is a verified library version of a bundle waiting to be
+// stored.
+type pendingImport struct {
+	library models.Library
+	modTime time.Time
+}
+
+// prepareImport verifies a library version of a bundle. It returns nil
+// instead of a pending import when the registry already has the version.
+func (s *LibraryService) prepareImport(b *bundle.Bundle, entry bundle.Library) (ImportStatus, *pendingImport, error) {
+	status := ImportStatus{Name: entry.Name, Version: entry.Version}
+
+	version, err := semver.NewVersion(entry.Version)
+	if err != nil {
+		return status, nil, fmt.Errorf("invalid version: %w", err)
+	}
+
+	if existing, err := s.db.Get(entry.Name, version.String()); err == nil {
+		if existing.Hash != entry.Hash {
+			return status, nil, fmt.Errorf("%w with hash %s, bundle has %s", errImportConflict, existing.Hash, entry.Hash)
+		}
+		status.Present = true
+		return status, nil, nil
+	}
+
+	content, err := b.Blob(entry.Hash)
+	if err != nil {
+		return status, nil, err
+	}
+
+	library := models.Library{
+		Name:         entry.Name,
+		Version:      version,
+		Description:  entry.Description,
+		Author:       entry.Author,
+		RepoURL:      entry.RepoURL,
+		Hash:         entry.Hash,
+		Dependencies: entry.Dependencies,
+		Signature:    entry.Signature,
+		SigningKey:   entry.SigningKey,
+		PublishedAt:  entry.PublishedAt,
+	}
+	if library.PublishedAt.IsZero() {
+		library.PublishedAt = time.Now().UTC()
+	}
+	library.Files, err = verifyArchive(library, content)
+	if err != nil {
+		return status, nil, err
+	}
+	return status, &pendingImport{library: library, modTime: entry.ModTime}, nil
+}
+
+// storeImport stores a verified library version, reading its archive from
+// the bundle again rather than keeping every archive in memory.
+func (s *LibraryService) storeImport(actor audit.Actor, b *bundle.Bundle, p pendingImport) error {
+	content, err := b.Blob(p.library.Hash)
+	if err != nil {
+		return err
+	}
+	if hash := hashContent(content); hash != p.library.Hash {
+		return fmt.Errorf("archive changed since it was verified: hash %s, expected %s", hash, p.library.Hash)
+	}
+	_, err = s.store(context.Background(), actor, audit.ActionImport, p.library, content, p.modTime)
+	return err
+}
+
+// verifyArchive checks an archive received from another registry against
+// the hash and signature recorded for it and lists its files. Unlike
+// uploads, it is not validated again.
+func verifyArchive(library models.Library, content []byte) ([]models.LibraryFile, error) {
+	if hash := hashContent(content); hash != library.Hash {
+		return nil, fmt.Errorf("archive of %s %s has hash %s, expected %s", library.Name, library.Version, hash, library.Hash)
+	}
+	if library.Signature != "" || library.SigningKey != "" {
+		if err := verifySignature(content, library.Signature, library.SigningKey); err != nil {
+			return nil, fmt.Errorf("archive of %s %s: %w", library.Name, library.Version, err)
+		}
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return nil, fmt.Errorf("archive of %s %s is not a valid zip archive: %w", library.Name, library.Version, err)
+	}
+	return archiveFiles(archive)
+}
+
+func hashContent(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+func libraryKey(name, version string) string {
+	return name + "@" + version
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/bundle"
+	"github.com/iamgp/hvr/internal/storage"
+)
+
+func newTestService(t *testing.T) *LibraryService {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := storage.NewSQLiteDatabase(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	fileStore, err := storage.NewLocalFileStore(filepath.Join(dir, "library_files"))
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+	return NewLibraryService(db, fileStore)
+}
+
+func publish(t *testing.T, s *LibraryService, name, version string, deps map[string]string, content string) {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	f, _ := w.Create(name + ".hsl")
+	f.Write([]byte(content))
+	w.Close()
+
+	if _, err := s.Upload(context.Background(), audit.Actor{User: "test"}, name, version, "", "", "", deps, buf, time.Now(), "", ""); err != nil {
+		t.Fatalf("Failed to publish %s %s: %v", name, version, err)
+	}
+}
+
+func exportBundle(t *testing.T, s *LibraryService, selection string, withDependencies bool) (string, *bundle.Manifest) {
+	t.Helper()
+	selectors, err := bundle.ParseSelectors(selection)
+	if err != nil {
+		t.Fatalf("Failed to parse selectors: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "bundle.tar")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("Failed to create bundle: %v", err)
+	}
+	defer f.Close()
+
+	m, err := s.Export(f, selectors, withDependencies)
+	if err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	return path, m
+}
+
+func TestExportImport(t *testing.T) {
+	source := newTestService(t)
+	publish(t, source, "lib-c", "1.0.0", nil, "// c\n")
+	publish(t, source, "lib-b", "1.0.0", map[string]string{"lib-c": "^1.0.0"}, "// b\n")
+	publish(t, source, "lib-a", "1.0.0", map[string]string{"lib-b": "^1.0.0"}, "// a\n")
+	publish(t, source, "other", "1.0.0", nil, "// other\n")
+
+	path, manifest := exportBundle(t, source, "lib-a", true)
+	var names []string
+	for _, lib := range manifest.Libraries {
+		names = append(names, lib.Name)
+	}
+	if strings.Join(names, ",") != "lib-c,lib-b,lib-a" {
+		t.Errorf("Expected lib-a and its dependencies, dependencies first, got %v", names)
+	}
+	if manifest.Libraries[2].Resolved["lib-b"] != "1.0.0" {
+		t.Errorf("Expected the resolved dependency edge lib-a -> lib-b 1.0.0, got %v", manifest.Libraries[2].Resolved)
+	}
+
+	b, err := bundle.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer b.Close()
+
+	target := newTestService(t)
+	if _, err := target.Import(audit.Actor{User: "test"}, b, true); err != nil {
+		t.Fatalf("Failed to check bundle: %v", err)
+	}
+	if _, err := target.db.Get("lib-a", "1.0.0"); err == nil {
+		t.Fatalf("Expected --check not to import anything")
+	}
+
+	statuses, err := target.Import(audit.Actor{User: "test"}, b, false)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if len(statuses) != 3 || statuses[0].Present {
+		t.Fatalf("Expected 3 imported versions, got %+v", statuses)
+	}
+
+	content, _, lib, err := target.Download(context.Background(), "lib-a", "1.0.0")
+	if err != nil {
+		t.Fatalf("Failed to download imported library: %v", err)
+	}
+	if lib.Hash != manifest.Libraries[2].Hash || hashContent(content) != lib.Hash {
+		t.Errorf("Expected the imported archive to keep its hash")
+	}
+	if published, _ := source.db.Get("lib-a", "1.0.0"); !lib.PublishedAt.Equal(published.PublishedAt) {
+		t.Errorf("Expected the publish time %v to be kept, got %v", published.PublishedAt, lib.PublishedAt)
+	}
+	if files, _ := target.GetFiles(context.Background(), "lib-a", "1.0.0"); len(files) != 1 {
+		t.Errorf("Expected the file listing to be recorded, got %+v", files)
+	}
+
+	// Importing again changes nothing.
+	statuses, err = target.Import(audit.Actor{User: "test"}, b, false)
+	if err != nil {
+		t.Fatalf("Failed to import again: %v", err)
+	}
+	for _, st := range statuses {
+		if !st.Present {
+			t.Errorf("Expected %s %s to be present already", st.Name, st.Version)
+		}
+	}
+}
+
+func TestImportReportsConflicts(t *testing.T) {
+	source := newTestService(t)
+	publish(t, source, "lib-a", "1.0.0", nil, "// source\n")
+	publish(t, source, "lib-b", "1.0.0", nil, "// b\n")
+	path, _ := exportBundle(t, source, "*", false)
+
+	b, err := bundle.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer b.Close()
+
+	target := newTestService(t)
+	publish(t, target, "lib-a", "1.0.0", nil, "// target\n")
+
+	_, err = target.Import(audit.Actor{User: "test"}, b, false)
+	if err == nil || !strings.Contains(err.Error(), "lib-a 1.0.0: registry already has this version") {
+		t.Fatalf("Expected a conflict for lib-a, got %v", err)
+	}
+	if _, err := target.db.Get("lib-b", "1.0.0"); err != nil {
+		t.Errorf("Expected lib-b to be imported despite the conflict: %v", err)
+	}
+}
+
+func TestImportVerifiesEverythingFirst(t *testing.T) {
+	source := newTestService(t)
+	publish(t, source, "lib-c", "1.0.0", nil, "// c\n")
+	publish(t, source, "lib-b", "1.0.0", map[string]string{"lib-c": "^1.0.0"}, "// b\n")
+	publish(t, source, "lib-a", "1.0.0", map[string]string{"lib-b": "^1.0.0"}, "// a\n")
+	path, _ := exportBundle(t, source, "lib-a", true)
+
+	b, err := bundle.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open bundle: %v", err)
+	}
+	defer b.Close()
+	last := &b.Manifest.Libraries[len(b.Manifest.Libraries)-1]
+	last.Signature = "dGFtcGVyZWQ="
+
+	target := newTestService(t)
+	_, err = target.Import(audit.Actor{User: "test"}, b, false)
+	if err == nil || !strings.Contains(err.Error(), last.Name+" "+last.Version) {
+		t.Fatalf("Expected the tampered signature of %s to be rejected, got %v", last.Name, err)
+	}
+	if libraries, _ := target.List(context.Background(), time.Time{}); len(libraries) != 0 {
+		t.Errorf("Expected nothing to be imported, got %d versions", len(libraries))
+	}
+}
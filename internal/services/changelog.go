@@ -0,0 +1,116 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxChangelog caps the release notes kept for a version.
+const maxChangelog = 16 << 10
+
+// changelogNames are the file names release notes are read from,
+// compared case-insensitively.
+var changelogNames = []string{"changelog.md", "changelog.txt", "changelog", "changes.md", "history.md"}
+
+// releaseNotes returns the section about version from the changelog in
+// an archive. The changelog is the CHANGELOG file closest to the archive
+// root. Its section is the one under the first heading that names the
+// version, such as "## [1.2.0] - 2024-03-01" or "# v1.2.0". The section
+// ends at the next heading of the same or a higher level. It returns ""
+// when the archive has no changelog or the changelog has no section for
+// version.
+func releaseNotes(content []byte, version string) string {
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return ""
+	}
+
+	var changelog *zip.File
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() || !isChangelog(f.Name) {
+			continue
+		}
+		if changelog == nil || strings.Count(f.Name, "/") < strings.Count(changelog.Name, "/") {
+			changelog = f
+		}
+	}
+	if changelog == nil {
+		return ""
+	}
+
+	text, err := readArchiveFile(changelog)
+	if err != nil {
+		return ""
+	}
+	return changelogSection(string(text), version)
+}
+
+func isChangelog(name string) bool {
+	base := strings.ToLower(path.Base(name))
+	for _, n := range changelogNames {
+		if base == n {
+			return true
+		}
+	}
+	return false
+}
+
+func changelogSection(text, version string) string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	start, level := -1, 0
+	for i, line := range lines {
+		l, title := heading(line)
+		if l == 0 {
+			continue
+		}
+		if start >= 0 && l <= level {
+			return truncateNotes(strings.TrimSpace(strings.Join(lines[start:i], "\n")))
+		}
+		if start < 0 && namesVersion(title, version) {
+			start, level = i+1, l
+		}
+	}
+	if start < 0 {
+		return ""
+	}
+	return truncateNotes(strings.TrimSpace(strings.Join(lines[start:], "\n")))
+}
+
+// heading returns the level and text of a Markdown heading line, or 0 when
+// the line is no heading.
+func heading(line string) (int, string) {
+	level := 0
+	for level < len(line) && line[level] == '#' {
+		level++
+	}
+	if level == 0 || level == len(line) || line[level] != ' ' {
+		return 0, ""
+	}
+	return level, line[level+1:]
+}
+
+func namesVersion(title, version string) bool {
+	for _, word := range strings.FieldsFunc(title, func(r rune) bool {
+		return r == ' ' || r == '[' || r == ']' || r == '(' || r == ')' || r == ':'
+	}) {
+		if strings.TrimPrefix(word, "v") == version {
+			return true
+		}
+	}
+	return false
+}
+
+func truncateNotes(notes string) string {
+	if len(notes) <= maxChangelog {
+		return notes
+	}
+	n := maxChangelog
+	for n > 0 && !utf8.RuneStart(notes[n]) {
+		n--
+	}
+	return notes[:n] + "\n..."
+}
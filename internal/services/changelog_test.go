@@ -0,0 +1,21 @@
+package services
+
+import "testing"
+
+func TestChangelogSection(t *testing.T) {
+	changelog := "# Changelog\r\n\r\n## [Unreleased]\r\n\r\n- Work in progress\r\n\r\n## [1.2.0] - 2024-03-01\r\n\r\n### Fixed\r\n\r\n- Tip pickup\r\n\r\n## v1.1.0\r\n\r\n- Older\r\n"
+
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{"1.2.0", "### Fixed\n\n- Tip pickup"},
+		{"1.1.0", "- Older"},
+		{"1.0.0", ""},
+	}
+	for _, tt := range tests {
+		if got := changelogSection(changelog, tt.version); got != tt.want {
+			t.Errorf("changelogSection(%s) = %q, want %q", tt.version, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/storage"
+)
+
+// Kinds of problem reported by Fsck.
+const (
+	ProblemMissing = "missing" // the archive of a row doesn't exist
+	ProblemCorrupt = "corrupt" // the archive doesn't match the row's hash
+	ProblemInvalid = "invalid" // the row itself can't be used
+)
+
+// FsckProblem is a library version whose record or archive is damaged.
+type FsckProblem struct {
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Version string `json:"version"`
+	Path    string `json:"path,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p FsckProblem) String() string {
+	return fmt.Sprintf("%s %s: %s: %s", p.Name, p.Version, p.Kind, p.Message)
+}
+
+// FsckReport is the result of checking the file store against the
+// database.
+type FsckReport struct {
+	Started  time.Time     `json:"started"`
+	Duration time.Duration `json:"duration"`
+	// Checked and Bytes count the archives that were read and hashed.
+	Checked  int           `json:"checked"`
+	Bytes    int64         `json:"bytes"`
+	Problems []FsckProblem `json:"problems"`
+	// Orphans are files in the store that no library version refers to.
+	Orphans []storage.StoredFile `json:"orphans"`
+	// Removed lists the orphans deleted by garbage collection.
+	Removed []string `json:"removed"`
+	// AuditEntries counts the audit log entries whose hash chain was
+	// checked, and AuditError says where the chain is broken, if it is.
+	AuditEntries int    `json:"audit_entries"`
+	AuditError   string `json:"audit_error,omitempty"`
+}
+
+// Fsck re-hashes every stored archive against the database, reports rows
+// whose archive is missing or corrupt, and lists files in the store that no
+// row refers to, such as those left by uploads that failed after the archive
+// was saved. With gc set, orphans last modified more than grace ago are
+// deleted. Uploads through this service can't race the deletion, but the
+// grace leaves alone those of other processes, such as an import, whose
+// archives may carry an old modification time from the client. It also
+// checks the hash chain of the audit log.
+func (s *LibraryService) Fsck(gc bool, grace time.Duration) (*FsckReport, error) {
+	report := &FsckReport{Started: time.Now()}
+
+	// The store is listed first so that an archive saved in between has its
+	// record read too.
+	files, err := s.fileStore.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the file store: %w", err)
+	}
+	records, err := s.db.Records()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read library records: %w", err)
+	}
+
+	referenced := make(map[string]bool, len(records))
+	for _, r := range records {
+		referenced[filepath.Clean(r.FilePath)] = true
+		if problem := s.checkRecord(r, report); problem != nil {
+			report.Problems = append(report.Problems, *problem)
+		}
+	}
+
+	kept := files[:0:0]
+	var expired []storage.StoredFile
+	for _, f := range files {
+		if referenced[filepath.Clean(f.Path)] {
+			kept = append(kept, f)
+			continue
+		}
+		report.Orphans = append(report.Orphans, f)
+		if gc && report.Started.Sub(f.ModTime) > grace {
+			expired = append(expired, f)
+			continue
+		}
+		kept = append(kept, f)
+	}
+	if len(expired) > 0 {
+		removed, err := s.removeOrphans(expired)
+		if err != nil {
+			return nil, err
+		}
+		report.Removed = removed
+		for _, f := range expired {
+			if !slices.Contains(removed, f.Path) {
+				kept = append(kept, f)
+			}
+		}
+	}
+	s.statsMu.Lock()
+	s.setStoreStats(kept)
+	s.statsMu.Unlock()
+
+	entries, err := s.db.AuditLog(audit.Filter{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the audit log: %w", err)
+	}
+	report.AuditEntries = len(entries)
+	if err := audit.Verify(entries, ""); err != nil {
+		report.AuditError = err.Error()
+	}
+
+	report.Duration = time.Since(report.Started)
+	return report, nil
+}
+
+// removeOrphans deletes the given orphans, except those an upload has
+// written a record for since they were found, and returns their paths.
+func (s *LibraryService) removeOrphans(orphans []storage.StoredFile) ([]string, error) {
+	s.storeMu.Lock()
+	defer s.storeMu.Unlock()
+
+	records, err := s.db.Records()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read library records: %w", err)
+	}
+	referenced := make(map[string]bool, len(records))
+	for _, r := range records {
+		referenced[filepath.Clean(r.FilePath)] = true
+	}
+
+	var removed []string
+	for _, f := range orphans {
+		if referenced[filepath.Clean(f.Path)] {
+			continue
+		}
+		if err := s.fileStore.Delete(f.Path); err != nil {
+			return nil, fmt.Errorf("failed to remove orphan %s: %w", f.Path, err)
+		}
+		removed = append(removed, f.Path)
+	}
+	return removed, nil
+}
+
+func (s *LibraryService) checkRecord(r storage.Record, report *FsckReport) *FsckProblem {
+	problem := &FsckProblem{Name: r.Name, Version: r.Version, Path: r.FilePath}
+
+	if _, err := semver.NewVersion(r.Version); err != nil {
+		problem.Kind, problem.Message = ProblemInvalid, fmt.Sprintf("invalid version: %v", err)
+		return problem
+	}
+	if r.FilePath == "" || r.Hash == "" {
+		problem.Kind, problem.Message = ProblemInvalid, "no archive path or hash recorded"
+		return problem
+	}
+
+	content, _, err := s.fileStore.Get(r.FilePath)
+	if os.IsNotExist(err) {
+		problem.Kind, problem.Message = ProblemMissing, "archive not found"
+		return problem
+	}
+	if err != nil {
+		problem.Kind, problem.Message = ProblemMissing, err.Error()
+		return problem
+	}
+
+	report.Checked++
+	report.Bytes += int64(len(content))
+	if hash := hashContent(content); hash != r.Hash {
+		problem.Kind, problem.Message = ProblemCorrupt, fmt.Sprintf("archive has hash %s, expected %s", hash, r.Hash)
+		return problem
+	}
+	return nil
+}
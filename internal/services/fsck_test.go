@@ -0,0 +1,175 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/storage"
+)
+
+func TestFsck(t *testing.T) {
+	s := newTestService(t)
+	publish(t, s, "lib-a", "1.0.0", nil, "// a\n")
+	publish(t, s, "lib-b", "1.0.0", nil, "// b\n")
+	publish(t, s, "lib-c", "1.0.0", nil, "// c\n")
+
+	b, _ := s.db.Get("lib-b", "1.0.0")
+	c, _ := s.db.Get("lib-c", "1.0.0")
+	os.WriteFile(b.FilePath, []byte("corrupt"), 0644)
+	os.Remove(c.FilePath)
+
+	// An archive left by an upload whose record was never written, and one
+	// from an upload that may still be in progress.
+	dir := filepath.Dir(filepath.Dir(b.FilePath))
+	old := filepath.Join(dir, "lib-d", "1.0.0.zip")
+	recent := filepath.Join(dir, "lib-e", "1.0.0.zip")
+	os.MkdirAll(filepath.Dir(old), 0755)
+	os.MkdirAll(filepath.Dir(recent), 0755)
+	os.WriteFile(old, []byte("orphan"), 0644)
+	os.WriteFile(recent, []byte("orphan"), 0644)
+	twoDaysAgo := time.Now().Add(-48 * time.Hour)
+	os.Chtimes(old, twoDaysAgo, twoDaysAgo)
+
+	report, err := s.Fsck(false, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to check storage: %v", err)
+	}
+	if report.Checked != 2 {
+		t.Errorf("Expected 2 archives to be hashed, got %d", report.Checked)
+	}
+	kinds := make(map[string]string)
+	for _, p := range report.Problems {
+		kinds[p.Name] = p.Kind
+	}
+	if len(kinds) != 2 || kinds["lib-b"] != ProblemCorrupt || kinds["lib-c"] != ProblemMissing {
+		t.Errorf("Expected lib-b corrupt and lib-c missing, got %+v", report.Problems)
+	}
+	if len(report.Orphans) != 2 || len(report.Removed) != 0 {
+		t.Errorf("Expected 2 orphans and nothing removed, got %+v", report)
+	}
+
+	report, err = s.Fsck(true, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to collect garbage: %v", err)
+	}
+	if len(report.Removed) != 1 || report.Removed[0] != old {
+		t.Errorf("Expected only the old orphan to be removed, got %v", report.Removed)
+	}
+	if _, err := os.Stat(filepath.Dir(old)); !os.IsNotExist(err) {
+		t.Errorf("Expected the empty library directory to be removed")
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("Expected the recent orphan to be kept: %v", err)
+	}
+
+	// The check leaves the file store totals cached for Stats, and only
+	// uploads make it walk the store again.
+	os.MkdirAll(filepath.Dir(old), 0755)
+	os.WriteFile(old, []byte("orphan"), 0644)
+	if stats, err := s.Stats(); err != nil || stats.StoredFiles != 3 || stats.Versions != 3 {
+		t.Errorf("Expected the cached 3 files and 3 versions, got %+v, %v", stats, err)
+	}
+	publish(t, s, "lib-f", "1.0.0", nil, "// f\n")
+	if stats, err := s.Stats(); err != nil || stats.StoredFiles != 5 || stats.Versions != 4 {
+		t.Errorf("Expected 5 files and 4 versions after an upload, got %+v, %v", stats, err)
+	}
+}
+
+// gcDuringSave runs garbage collection between an archive being saved and
+// its record being written.
+type gcDuringSave struct {
+	storage.FileStore
+	s  *LibraryService
+	gc chan *FsckReport
+}
+
+func (f *gcDuringSave) Save(name, version string, data io.Reader, modTime time.Time) (string, error) {
+	path, err := f.FileStore.Save(name, version, data, modTime)
+	if err != nil {
+		return "", err
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		report, _ := f.s.Fsck(true, 24*time.Hour)
+		f.gc <- report
+	}()
+	// Give the collection the chance to finish before the record is written.
+	select {
+	case <-done:
+	case <-time.After(200 * time.Millisecond):
+	}
+	return path, nil
+}
+
+func TestFsckSparesUploadsInProgress(t *testing.T) {
+	s := newTestService(t)
+	gc := &gcDuringSave{FileStore: s.fileStore, s: s, gc: make(chan *FsckReport, 1)}
+	s.fileStore = gc
+
+	// The client's modification time is long past the grace period.
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	f, _ := w.Create("lib-a.hsl")
+	f.Write([]byte("// a\n"))
+	w.Close()
+	lastYear := time.Now().AddDate(-1, 0, 0)
+	library, err := s.Upload(context.Background(), audit.Actor{User: "test"}, "lib-a", "1.0.0", "", "", "", nil, buf, lastYear, "", "")
+	if err != nil {
+		t.Fatalf("Failed to upload: %v", err)
+	}
+
+	report := <-gc.gc
+	if report == nil {
+		t.Fatalf("Failed to collect garbage")
+	}
+	if len(report.Removed) != 0 {
+		t.Errorf("Expected nothing to be removed, got %v", report.Removed)
+	}
+	if _, err := os.Stat(library.FilePath); err != nil {
+		t.Errorf("Expected the uploaded archive to be kept: %v", err)
+	}
+}
+
+func TestFsckVerifiesAuditLog(t *testing.T) {
+	s := newTestService(t)
+	publish(t, s, "lib-a", "1.0.0", nil, "// a\n")
+	publish(t, s, "lib-b", "1.0.0", nil, "// b\n")
+
+	report, err := s.Fsck(false, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to check storage: %v", err)
+	}
+	if report.AuditEntries != 2 || report.AuditError != "" {
+		t.Errorf("Expected 2 intact audit entries, got %d: %s", report.AuditEntries, report.AuditError)
+	}
+
+	// Edit an entry behind the registry's back.
+	a, _ := s.db.Get("lib-a", "1.0.0")
+	db, err := sql.Open("sqlite3", filepath.Join(filepath.Dir(filepath.Dir(filepath.Dir(a.FilePath))), "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	defer db.Close()
+	db.Exec("DROP TRIGGER audit_log_no_update")
+	if _, err := db.Exec("UPDATE audit_log SET user = 'mallory' WHERE id = 1"); err != nil {
+		t.Fatalf("Failed to edit the audit log: %v", err)
+	}
+
+	report, err = s.Fsck(false, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("Failed to check storage: %v", err)
+	}
+	if !strings.Contains(report.AuditError, "entry 1 has been modified") {
+		t.Errorf("Expected the edited entry to be reported, got %q", report.AuditError)
+	}
+}
@@ -0,0 +1,13 @@
+package services
+
+import "context"
+
+// Health checks that the database can be queried and that files can be
+// written to the file store. It returns the outcome of each check by name,
+// nil when the check passed.
+func (s *LibraryService) Health(ctx context.Context) map[string]error {
+	return map[string]error{
+		"database": s.db.WithContext(ctx).Ping(),
+		"storage":  s.fileStore.Check(),
+	}
+}
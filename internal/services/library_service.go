@@ -1,54 +1,138 @@
 package services
 
 import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/iamgp/hvr/internal/audit"
 	"github.com/iamgp/hvr/internal/dependency"
 	"github.com/iamgp/hvr/internal/models"
 	"github.com/iamgp/hvr/internal/storage"
+	"github.com/iamgp/hvr/internal/venus"
+	"github.com/iamgp/hvr/internal/webhook"
 )
 
+// ErrInvalidSignature is returned when an upload carries a signature that
+// does not match its archive.
+var ErrInvalidSignature = errors.New("invalid signature")
+
 type LibraryService struct {
 	db        *storage.SQLiteDatabase
 	fileStore storage.FileStore
-	resolver  *dependency.Resolver
+
+	// storeMu is held for reading from saving an archive until its record
+	// is written, and for writing while Fsck removes orphans, so garbage
+	// collection never takes an archive whose record is on its way.
+	storeMu sync.RWMutex
+
+	upstream   Upstream
+	upstreamMu sync.Mutex
+	fetching   map[string]*fetch
+
+	// upstreamDownUntil is when the upstream is asked again after it was
+	// unavailable.
+	upstreamDownUntil time.Time
+
+	notifier           Notifier
+	allowLocalWebhooks bool
+	admins             map[string]bool
+
+	observeResolve ResolveObserver
+
+	statsMu     sync.Mutex
+	storeStats  Stats
+	storeListed time.Time
+}
+
+// ResolveObserver is told how long each dependency resolution took and
+// whether it failed.
+type ResolveObserver func(d time.Duration, err error)
+
+// SetResolveObserver makes the service report dependency resolutions to o.
+func (s *LibraryService) SetResolveObserver(o ResolveObserver) {
+	s.observeResolve = o
+}
+
+// resolve resolves the dependencies of library, reporting the resolution
+// to the observer.
+func (s *LibraryService) resolve(ctx context.Context, library models.Library) ([]models.Library, error) {
+	start := time.Now()
+	resolved, err := s.resolver(ctx).ResolveDependencies(library)
+	if s.observeResolve != nil {
+		s.observeResolve(time.Since(start), err)
+	}
+	return resolved, err
 }
 
 func NewLibraryService(db *storage.SQLiteDatabase, fs storage.FileStore) *LibraryService {
 	return &LibraryService{
 		db:        db,
 		fileStore: fs,
-		resolver:  dependency.NewResolver(db),
 	}
 }
 
-func (s *LibraryService) Upload(name, versionStr, description, author, repoURL string, dependencies map[string]string, data io.Reader, modTime time.Time) error {
+// resolver returns a dependency resolver whose lookups run with ctx.
+func (s *LibraryService) resolver(ctx context.Context) *dependency.Resolver {
+	if s.upstream != nil {
+		return dependency.NewResolver(proxySource{s: s, ctx: ctx})
+	}
+	return dependency.NewResolver(s.db.WithContext(ctx))
+}
+
+// Upload validates and stores a new library version published by actor and
+// returns the stored record, including the per-file listing with checksum
+// footer results.
+func (s *LibraryService) Upload(ctx context.Context, actor audit.Actor, name, versionStr, description, author, repoURL string, dependencies map[string]string, data io.Reader, modTime time.Time, signature, signingKey string) (models.Library, error) {
 	version, err := semver.NewVersion(versionStr)
 	if err != nil {
-		return fmt.Errorf("invalid version: %w", err)
+		return models.Library{}, fmt.Errorf("invalid version: %w", err)
+	}
+
+	content, err := io.ReadAll(data)
+	if err != nil {
+		return models.Library{}, fmt.Errorf("failed to read upload: %w", err)
+	}
+
+	if signature != "" || signingKey != "" {
+		if err := verifySignature(content, signature, signingKey); err != nil {
+			return models.Library{}, err
+		}
 	}
 
 	// Check if the library version already exists
-	_, err = s.db.Get(name, version.String())
+	_, err = s.db.WithContext(ctx).Get(name, version.String())
 	if err == nil {
-		return fmt.Errorf("library version already exists: %s %s", name, version)
+		return models.Library{}, fmt.Errorf("library version already exists: %s %s", name, version)
 	}
 
-	// Calculate hash
-	hasher := sha256.New()
-	teeReader := io.TeeReader(data, hasher)
+	archive, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return models.Library{}, &venus.ValidationError{Problems: []venus.Problem{{Message: "upload is not a valid zip archive"}}}
+	}
+	if problems := s.validateArchive(ctx, archive, dependencies); len(problems) > 0 {
+		return models.Library{}, &venus.ValidationError{Problems: problems}
+	}
 
-	filePath, err := s.fileStore.Save(name, version.String(), teeReader, modTime)
+	files, err := archiveFiles(archive)
 	if err != nil {
-		return err
+		return models.Library{}, err
 	}
 
-	hash := hex.EncodeToString(hasher.Sum(nil))
+	// Calculate hash
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
 
 	library := models.Library{
 		Name:         name,
@@ -56,51 +140,316 @@ func (s *LibraryService) Upload(name, versionStr, description, author, repoURL s
 		Description:  description,
 		Author:       author,
 		RepoURL:      repoURL,
-		FilePath:     filePath,
 		Hash:         hash,
 		Dependencies: dependencies,
+		Signature:    signature,
+		SigningKey:   signingKey,
+		PublishedAt:  time.Now().UTC(),
+		Files:        files,
 	}
 
-	return s.db.Save(library)
+	return s.store(ctx, actor, audit.ActionUpload, library, content, modTime)
 }
 
-func (s *LibraryService) Download(name, versionStr string) ([]byte, time.Time, string, error) {
-	var library models.Library
-	var err error
+// store saves an archive and its record, auditing it as action by actor.
+func (s *LibraryService) store(ctx context.Context, actor audit.Actor, action string, library models.Library, content []byte, modTime time.Time) (models.Library, error) {
+	entry, err := audit.NewEntry(actor, action, libraryKey(library.Name, library.Version.String()), nil, auditState(library))
+	if err != nil {
+		return models.Library{}, err
+	}
 
-	if versionStr == "latest" {
-		library, err = s.db.GetLatest(name)
-	} else {
-		version, err := semver.NewVersion(versionStr)
+	s.storeMu.RLock()
+	defer s.storeMu.RUnlock()
+
+	filePath, err := s.fileStore.Save(library.Name, library.Version.String(), bytes.NewReader(content), modTime)
+	if err != nil {
+		return models.Library{}, err
+	}
+	s.statsMu.Lock()
+	s.storeListed = time.Time{}
+	s.statsMu.Unlock()
+
+	library.FilePath = filePath
+	library.Changelog = releaseNotes(content, library.Version.String())
+
+	// A proxy caching an upstream version doesn't publish anything new.
+	var event *webhook.Event
+	if action != audit.ActionCache {
+		if event, err = publishedEvent(actor, library); err != nil {
+			return models.Library{}, err
+		}
+	}
+	if err := s.db.WithContext(ctx).Save(library, entry, event); err != nil {
+		return models.Library{}, err
+	}
+	if event != nil {
+		s.wake()
+	}
+	return library, nil
+}
+
+// libraryState is how a library version is recorded in the audit log.
+type libraryState struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Description  string            `json:"description"`
+	Author       string            `json:"author"`
+	RepoURL      string            `json:"repo_url"`
+	Hash         string            `json:"hash"`
+	Dependencies map[string]string `json:"dependencies"`
+	Signature    string            `json:"signature,omitempty"`
+	SigningKey   string            `json:"signing_key,omitempty"`
+}
+
+func auditState(library models.Library) libraryState {
+	return libraryState{
+		Name:         library.Name,
+		Version:      library.Version.String(),
+		Description:  library.Description,
+		Author:       library.Author,
+		RepoURL:      library.RepoURL,
+		Hash:         library.Hash,
+		Dependencies: library.Dependencies,
+		Signature:    library.Signature,
+		SigningKey:   library.SigningKey,
+	}
+}
+
+// validateArchive runs the Venus library checks, resolving the declared
+// dependencies so includes of their files are accepted.
+func (s *LibraryService) validateArchive(ctx context.Context, archive *zip.Reader, dependencies map[string]string) []venus.Problem {
+	var problems []venus.Problem
+	var dependencyFiles []string
+
+	resolved, err := s.resolve(ctx, models.Library{Dependencies: dependencies})
+	if err != nil {
+		problems = append(problems, venus.Problem{Message: fmt.Sprintf("cannot resolve dependencies: %v", err)})
+	}
+	for _, dep := range resolved {
+		files, err := s.db.WithContext(ctx).GetFiles(dep.Name, dep.Version.String())
 		if err != nil {
-			return nil, time.Time{}, "", fmt.Errorf("invalid version: %w", err)
+			problems = append(problems, venus.Problem{Message: fmt.Sprintf("cannot list files of %s %s: %v", dep.Name, dep.Version, err)})
+			continue
+		}
+		for _, f := range files {
+			dependencyFiles = append(dependencyFiles, f.Path)
+		}
+	}
+
+	return append(problems, venus.ValidateArchive(archive, dependencyFiles)...)
+}
+
+// archiveFiles lists the files in an archive, checking the Hamilton checksum
+// footer of every Venus file.
+func archiveFiles(archive *zip.Reader) ([]models.LibraryFile, error) {
+	var files []models.LibraryFile
+	for _, f := range archive.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		file := models.LibraryFile{Path: f.Name, Size: int64(f.UncompressedSize64)}
+
+		if venus.HasFooter(f.Name) {
+			content, err := readArchiveFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", f.Name, err)
+			}
+			if check := venus.CheckFooter(content); check.Present {
+				file.HasFooter = true
+				file.Author = check.Footer.Author
+				file.Valid = check.Footer.Valid
+				file.Time = check.Footer.Time
+				file.Checksum = check.Footer.Checksum
+				file.ChecksumValid = check.Valid()
+			}
+		}
+
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func readArchiveFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// FindProviders returns, for each library that ships a file matching the
+// include path, the newest version containing it.
+func (s *LibraryService) FindProviders(ctx context.Context, include string) ([]models.FileMatch, error) {
+	matches, err := s.db.WithContext(ctx).FindFiles(venus.NormalizePath(include))
+	if err != nil {
+		return nil, err
+	}
+
+	newest := make(map[string]models.FileMatch)
+	for _, m := range matches {
+		current, ok := newest[m.Name]
+		if !ok || newerVersion(m.Version, current.Version) {
+			newest[m.Name] = m
 		}
-		library, err = s.db.Get(name, version.String())
 	}
 
+	result := make([]models.FileMatch, 0, len(newest))
+	for _, m := range newest {
+		result = append(result, m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func newerVersion(a, b string) bool {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+	if errA != nil || errB != nil {
+		return false
+	}
+	return va.GreaterThan(vb)
+}
+
+func (s *LibraryService) GetFiles(ctx context.Context, name, version string) ([]models.LibraryFile, error) {
+	db := s.db.WithContext(ctx)
+	if _, err := db.Get(name, version); err != nil {
+		return nil, err
+	}
+	return db.GetFiles(name, version)
+}
+
+// verifySignature checks that the publisher signature matches the uploaded
+// archive, so a signed version can never be stored with a broken signature.
+// Whether the key is trusted is decided by each client.
+func verifySignature(content []byte, signature, signingKey string) error {
+	pub, err := base64.StdEncoding.DecodeString(signingKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: malformed signing key", ErrInvalidSignature)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
 	if err != nil {
-		return nil, time.Time{}, "", err
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(pub), content, sig) {
+		return fmt.Errorf("%w: signature does not match the uploaded archive", ErrInvalidSignature)
+	}
+	return nil
+}
+
+func (s *LibraryService) Download(ctx context.Context, name, versionStr string) ([]byte, time.Time, models.Library, error) {
+	library, err := s.Info(ctx, name, versionStr)
+	if err != nil {
+		return nil, time.Time{}, models.Library{}, err
 	}
 
 	fileContent, modTime, err := s.fileStore.Get(library.FilePath)
 	if err != nil {
-		return nil, time.Time{}, "", err
+		return nil, time.Time{}, models.Library{}, err
 	}
 
-	return fileContent, modTime, library.Hash, nil
+	return fileContent, modTime, library, nil
+}
+
+// Info returns the record of a library version, or of the latest version
+// when versionStr is "latest".
+func (s *LibraryService) Info(ctx context.Context, name, versionStr string) (models.Library, error) {
+	if versionStr == "latest" {
+		return s.getLatest(ctx, name)
+	}
+
+	version, err := semver.NewVersion(versionStr)
+	if err != nil {
+		return models.Library{}, fmt.Errorf("invalid version: %w", err)
+	}
+	return s.getLibrary(ctx, name, version.String())
+}
+
+// Versions lists the published versions of a library, newest first.
+func (s *LibraryService) Versions(ctx context.Context, name string) ([]*semver.Version, error) {
+	versions, err := s.versions(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(sort.Reverse(semver.Collection(versions)))
+	return versions, nil
+}
+
+// List returns the locally stored library versions published at or after
+// since.
+func (s *LibraryService) List(ctx context.Context, since time.Time) ([]models.Library, error) {
+	return s.db.WithContext(ctx).List(since)
+}
+
+// Stats are the size of the registry.
+type Stats struct {
+	Libraries   int
+	Versions    int
+	StoredFiles int
+	StoredBytes int64
+}
+
+// storeStatsMaxAge is how long Stats reuses the file store totals before
+// walking the store again.
+const storeStatsMaxAge = 5 * time.Minute
+
+// Stats counts the libraries and versions in the registry and the files
+// and bytes in its file store. Walking the file store is slow for large
+// registries, so its totals are cached for storeStatsMaxAge.
+func (s *LibraryService) Stats() (Stats, error) {
+	var stats Stats
+	var err error
+	stats.Libraries, stats.Versions, err = s.db.Counts()
+	if err != nil {
+		return Stats{}, fmt.Errorf("failed to count libraries: %w", err)
+	}
+
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	if time.Since(s.storeListed) > storeStatsMaxAge {
+		files, err := s.fileStore.List()
+		if err != nil {
+			return Stats{}, fmt.Errorf("failed to list stored files: %w", err)
+		}
+		s.setStoreStats(files)
+	}
+	stats.StoredFiles = s.storeStats.StoredFiles
+	stats.StoredBytes = s.storeStats.StoredBytes
+	return stats, nil
+}
+
+// setStoreStats caches the file store totals of files. The caller holds
+// statsMu.
+func (s *LibraryService) setStoreStats(files []storage.StoredFile) {
+	s.storeStats = Stats{StoredFiles: len(files)}
+	for _, f := range files {
+		s.storeStats.StoredBytes += f.Size
+	}
+	s.storeListed = time.Now()
+}
+
+// Releases returns up to limit of the most recently published versions of
+// the library name, or of every library when name is empty.
+func (s *LibraryService) Releases(ctx context.Context, name string, limit int) ([]models.Library, error) {
+	return s.db.WithContext(ctx).Recent(name, limit)
+}
+
+// AuditLog returns the audit entries matching filter, oldest first.
+func (s *LibraryService) AuditLog(ctx context.Context, filter audit.Filter) ([]audit.Entry, error) {
+	return s.db.WithContext(ctx).AuditLog(filter)
 }
 
-func (s *LibraryService) Search(query string) ([]models.Library, error) {
-	return s.db.Search(query)
+func (s *LibraryService) Search(ctx context.Context, query string) ([]models.Library, error) {
+	return s.db.WithContext(ctx).Search(query)
 }
 
 // Implement methods for library management
 
-func (s *LibraryService) ResolveLibraryDependencies(name, version string) ([]models.Library, error) {
-	library, err := s.db.Get(name, version)
+func (s *LibraryService) ResolveLibraryDependencies(ctx context.Context, name, version string) ([]models.Library, error) {
+	library, err := s.getLibrary(ctx, name, version)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get library %s version %s: %w", name, version, err)
 	}
 
-	return s.resolver.ResolveDependencies(library)
+	return s.resolve(ctx, library)
 }
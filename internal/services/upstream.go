@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/models"
+	"github.com/iamgp/hvr/internal/upstream"
+)
+
+// Upstream is a registry that a proxy fetches libraries from when it doesn't
+// have them itself.
+type Upstream interface {
+	// Versions lists the published versions of a library.
+	Versions(ctx context.Context, name string) ([]*semver.Version, error)
+	// Info returns the record of a library version, or of the latest
+	// version when version is "latest".
+	Info(ctx context.Context, name, version string) (models.Library, error)
+	// Download returns the archive of a library version.
+	Download(ctx context.Context, name, version string) ([]byte, time.Time, error)
+	// URL identifies the upstream in the audit log.
+	URL() string
+}
+
+// upstreamRetryAfter is how long the proxy uses only local data once its
+// upstream was unavailable, so that requests during an outage don't each
+// wait for the upstream to time out.
+const upstreamRetryAfter = 30 * time.Second
+
+// errUpstreamSkipped is returned instead of asking an upstream that was
+// unavailable less than upstreamRetryAfter ago.
+var errUpstreamSkipped = fmt.Errorf("%w, using local data only", upstream.ErrUnavailable)
+
+// SetUpstream turns the service into a pull-through proxy for u: libraries
+// that aren't stored locally are fetched from u, verified and stored before
+// they are served. Uploads stay local.
+func (s *LibraryService) SetUpstream(u Upstream) {
+	s.upstream = u
+}
+
+// getLibrary returns a library version, fetching it from upstream when it
+// isn't stored locally.
+func (s *LibraryService) getLibrary(ctx context.Context, name, version string) (models.Library, error) {
+	library, err := s.db.WithContext(ctx).Get(name, version)
+	if err == nil || s.upstream == nil {
+		return library, err
+	}
+
+	library, upErr := s.fetchUpstream(ctx, name, version)
+	if upErr != nil {
+		s.checkUpstream(ctx, upErr)
+		return models.Library{}, fmt.Errorf("%v; upstream: %w", err, upErr)
+	}
+	return library, nil
+}
+
+// getLatest returns the newest version of a library. With an upstream the
+// newest upstream version is preferred; while upstream is unreachable the
+// newest local version is used.
+func (s *LibraryService) getLatest(ctx context.Context, name string) (models.Library, error) {
+	local, err := s.db.WithContext(ctx).GetLatest(name)
+	if s.upstream == nil {
+		return local, err
+	}
+
+	var info models.Library
+	upErr := s.upstreamAvailable()
+	if upErr == nil {
+		if info, upErr = s.upstream.Info(ctx, name, "latest"); upErr != nil {
+			s.checkUpstream(ctx, upErr)
+		}
+	}
+	if upErr != nil {
+		if err == nil {
+			if errors.Is(upErr, errUpstreamSkipped) {
+				return local, nil
+			}
+			slog.WarnContext(ctx, "upstream unavailable, serving local latest version",
+				"library", name, "version", local.Version.String(), "error", upErr)
+			return local, nil
+		}
+		return models.Library{}, fmt.Errorf("%v; upstream: %w", err, upErr)
+	}
+	if err == nil && !info.Version.GreaterThan(local.Version) {
+		return local, nil
+	}
+	return s.getLibrary(ctx, name, info.Version.String())
+}
+
+// versions lists the versions of a library known locally and upstream.
+func (s *LibraryService) versions(ctx context.Context, name string) ([]*semver.Version, error) {
+	versions, err := s.db.WithContext(ctx).GetAllVersions(name)
+	if err != nil || s.upstream == nil {
+		return versions, err
+	}
+
+	if err := s.upstreamAvailable(); err != nil {
+		return versions, nil
+	}
+	remote, err := s.upstream.Versions(ctx, name)
+	if err != nil {
+		s.checkUpstream(ctx, err)
+		slog.WarnContext(ctx, "upstream unavailable, listing local versions only", "library", name, "error", err)
+		return versions, nil
+	}
+
+	seen := make(map[string]bool, len(versions))
+	for _, v := range versions {
+		seen[v.String()] = true
+	}
+	for _, v := range remote {
+		if !seen[v.String()] {
+			versions = append(versions, v)
+		}
+	}
+	return versions, nil
+}
+
+// upstreamAvailable returns errUpstreamSkipped while the upstream is taken
+// to be down.
+func (s *LibraryService) upstreamAvailable() error {
+	s.upstreamMu.Lock()
+	defer s.upstreamMu.Unlock()
+	if time.Now().Before(s.upstreamDownUntil) {
+		return errUpstreamSkipped
+	}
+	return nil
+}
+
+// checkUpstream takes the upstream to be down for upstreamRetryAfter when
+// err says it was unavailable. Requests that were cancelled by their
+// client say nothing about the upstream.
+func (s *LibraryService) checkUpstream(ctx context.Context, err error) {
+	if !errors.Is(err, upstream.ErrUnavailable) || errors.Is(err, errUpstreamSkipped) || ctx.Err() != nil {
+		return
+	}
+	s.upstreamMu.Lock()
+	defer s.upstreamMu.Unlock()
+	if time.Now().After(s.upstreamDownUntil) {
+		slog.WarnContext(ctx, "upstream unavailable, using local data only", "retry_after", upstreamRetryAfter, "error", err)
+	}
+	s.upstreamDownUntil = time.Now().Add(upstreamRetryAfter)
+}
+
+// fetch is a download from upstream in progress. Requests for the same
+// library version wait for it instead of downloading it again.
+type fetch struct {
+	done    chan struct{}
+	library models.Library
+	err     error
+}
+
+// fetchUpstream downloads a library version from upstream, checks its hash
+// and signature against the upstream record and stores it locally. Only one
+// download of each version runs at a time; different versions are fetched
+// concurrently.
+func (s *LibraryService) fetchUpstream(ctx context.Context, name, version string) (models.Library, error) {
+	if err := s.upstreamAvailable(); err != nil {
+		return models.Library{}, err
+	}
+	key := name + "@" + version
+	s.upstreamMu.Lock()
+	if f, ok := s.fetching[key]; ok {
+		s.upstreamMu.Unlock()
+		select {
+		case <-f.done:
+			return f.library, f.err
+		case <-ctx.Done():
+			return models.Library{}, ctx.Err()
+		}
+	}
+	f := &fetch{done: make(chan struct{})}
+	if s.fetching == nil {
+		s.fetching = make(map[string]*fetch)
+	}
+	s.fetching[key] = f
+	s.upstreamMu.Unlock()
+
+	f.library, f.err = s.fetchOnce(ctx, name, version)
+
+	s.upstreamMu.Lock()
+	delete(s.fetching, key)
+	s.upstreamMu.Unlock()
+	close(f.done)
+	return f.library, f.err
+}
+
+func (s *LibraryService) fetchOnce(ctx context.Context, name, version string) (models.Library, error) {
+	// Another request may have fetched it just before this one started.
+	if library, err := s.db.WithContext(ctx).Get(name, version); err == nil {
+		return library, nil
+	}
+
+	info, err := s.upstream.Info(ctx, name, version)
+	if err != nil {
+		return models.Library{}, err
+	}
+	content, modTime, err := s.upstream.Download(ctx, name, info.Version.String())
+	if err != nil {
+		return models.Library{}, err
+	}
+
+	library := info
+	if library.PublishedAt.IsZero() {
+		library.PublishedAt = time.Now().UTC()
+	}
+	library.Files, err = verifyArchive(library, content)
+	if err != nil {
+		return models.Library{}, fmt.Errorf("upstream %w", err)
+	}
+	actor := audit.Actor{User: "proxy", Address: s.upstream.URL()}
+	if library, err = s.store(ctx, actor, audit.ActionCache, library, content, modTime); err != nil {
+		return models.Library{}, err
+	}
+
+	slog.InfoContext(ctx, "cached library from upstream", "library", name, "version", info.Version.String())
+	return library, nil
+}
+
+// proxySource lets the dependency resolver see upstream versions and fetch
+// the ones it picks.
+type proxySource struct {
+	s   *LibraryService
+	ctx context.Context
+}
+
+func (p proxySource) GetAllVersions(name string) ([]*semver.Version, error) {
+	return p.s.versions(p.ctx, name)
+}
+
+func (p proxySource) Get(name, version string) (models.Library, error) {
+	return p.s.getLibrary(p.ctx, name, version)
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/models"
+	"github.com/iamgp/hvr/internal/webhook"
+)
+
+// Notifier delivers the webhook events the service queues.
+type Notifier interface {
+	// Wake starts delivering queued events now.
+	Wake()
+}
+
+// SetNotifier makes the service tell n about the events it queues.
+func (s *LibraryService) SetNotifier(n Notifier) {
+	s.notifier = n
+}
+
+// SetAllowLocalWebhooks lets webhooks be registered for loopback and
+// link-local addresses.
+func (s *LibraryService) SetAllowLocalWebhooks(allow bool) {
+	s.allowLocalWebhooks = allow
+}
+
+// SetAdmins sets the users allowed to manage webhooks, as identified by
+// their client certificates.
+func (s *LibraryService) SetAdmins(users []string) {
+	s.admins = make(map[string]bool, len(users))
+	for _, u := range users {
+		s.admins[u] = true
+	}
+}
+
+// IsAdmin reports whether actor is one of the users set with SetAdmins.
+// Unauthenticated requests never are.
+func (s *LibraryService) IsAdmin(actor audit.Actor) bool {
+	return actor.User != audit.Anonymous && s.admins[actor.User]
+}
+
+// publishedEvent returns the webhook event announcing a new library
+// version.
+func publishedEvent(actor audit.Actor, library models.Library) (*webhook.Event, error) {
+	e, err := webhook.NewEvent(webhook.EventPublished, library.Name, library.Version.String(), actor, auditState(library))
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// wake tells the notifier that events were queued.
+func (s *LibraryService) wake() {
+	if s.notifier != nil {
+		s.notifier.Wake()
+	}
+}
+
+// CreateWebhook registers a webhook for actor. A signing secret is
+// generated when hook has none. The returned webhook includes the secret.
+func (s *LibraryService) CreateWebhook(ctx context.Context, actor audit.Actor, hook webhook.Hook) (webhook.Hook, error) {
+	if err := hook.Validate(s.allowLocalWebhooks); err != nil {
+		return webhook.Hook{}, err
+	}
+	if hook.Secret == "" {
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			return webhook.Hook{}, fmt.Errorf("failed to generate secret: %w", err)
+		}
+		hook.Secret = secret
+	}
+	hook.Created = time.Now().UTC()
+
+	entry, err := audit.NewEntry(actor, audit.ActionWebhookCreate, webhookTarget(hook), nil, withoutSecret(hook))
+	if err != nil {
+		return webhook.Hook{}, err
+	}
+	if err := s.db.WithContext(ctx).CreateWebhook(&hook, entry); err != nil {
+		return webhook.Hook{}, fmt.Errorf("failed to save webhook: %w", err)
+	}
+	return hook, nil
+}
+
+// DeleteWebhook removes a webhook for actor.
+func (s *LibraryService) DeleteWebhook(ctx context.Context, actor audit.Actor, id int64) error {
+	db := s.db.WithContext(ctx)
+	hook, err := db.GetWebhook(id)
+	if err != nil {
+		return err
+	}
+	entry, err := audit.NewEntry(actor, audit.ActionWebhookDelete, webhookTarget(hook), withoutSecret(hook), nil)
+	if err != nil {
+		return err
+	}
+	return db.DeleteWebhook(id, entry)
+}
+
+// Webhooks returns the registered webhooks without their secrets.
+func (s *LibraryService) Webhooks(ctx context.Context) ([]webhook.Hook, error) {
+	hooks, err := s.db.WithContext(ctx).Webhooks()
+	if err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		hooks[i] = withoutSecret(hooks[i])
+	}
+	return hooks, nil
+}
+
+// Deliveries returns the webhook deliveries matching filter, newest first.
+func (s *LibraryService) Deliveries(ctx context.Context, filter webhook.DeliveryFilter) ([]webhook.Delivery, error) {
+	return s.db.WithContext(ctx).Deliveries(filter)
+}
+
+// Redeliver queues the payload of a past delivery again, as a new delivery
+// to the same webhook.
+func (s *LibraryService) Redeliver(ctx context.Context, id int64) (webhook.Delivery, error) {
+	db := s.db.WithContext(ctx)
+	d, err := db.GetDelivery(id)
+	if err != nil {
+		return webhook.Delivery{}, err
+	}
+	if _, err := db.GetWebhook(d.WebhookID); err != nil {
+		return webhook.Delivery{}, fmt.Errorf("webhook %d: %w", d.WebhookID, err)
+	}
+
+	now := time.Now().UTC()
+	redelivery := []webhook.Delivery{{
+		WebhookID:   d.WebhookID,
+		EventID:     d.EventID,
+		Event:       d.Event,
+		Payload:     d.Payload,
+		Status:      webhook.StatusPending,
+		NextAttempt: now,
+		Created:     now,
+		Updated:     now,
+	}}
+	if err := db.AddDeliveries(redelivery); err != nil {
+		return webhook.Delivery{}, fmt.Errorf("failed to queue delivery: %w", err)
+	}
+	s.wake()
+	return redelivery[0], nil
+}
+
+func webhookTarget(hook webhook.Hook) string {
+	return "webhook:" + hook.URL
+}
+
+func withoutSecret(hook webhook.Hook) webhook.Hook {
+	hook.Secret = ""
+	return hook
+}
@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/webhook"
+)
+
+// receiver records the webhook requests it gets and answers with the next
+// queued status, or 200 when none is left.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	payloads [][]byte
+	headers  []http.Header
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.payloads = append(rc.payloads, body)
+	rc.headers = append(rc.headers, r.Header.Clone())
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newTestDispatcher(s *LibraryService) *webhook.Dispatcher {
+	d := webhook.NewDispatcher(s.db)
+	d.MaxAttempts = 3
+	d.Backoff = func(int) time.Duration { return 0 }
+	d.AllowLocal = true
+	s.SetNotifier(d)
+	s.SetAllowLocalWebhooks(true)
+	return d
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	s := newTestService(t)
+	d := newTestDispatcher(s)
+	rc := &receiver{}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	all, err := s.CreateWebhook(context.Background(), audit.Actor{User: "test"}, webhook.Hook{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	if all.Secret == "" {
+		t.Error("Expected a generated secret")
+	}
+	if _, err := s.CreateWebhook(context.Background(), audit.Actor{User: "test"}, webhook.Hook{URL: srv.URL, Library: "lib-b"}); err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	publish(t, s, "lib-a", "1.0.0", nil, "a")
+	if err := d.DeliverDue(); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+
+	if len(rc.payloads) != 1 {
+		t.Fatalf("Expected 1 delivery for lib-a, got %d", len(rc.payloads))
+	}
+	if !webhook.VerifySignature(all.Secret, rc.payloads[0], rc.headers[0].Get(webhook.HeaderSignature)) {
+		t.Error("Expected a valid signature")
+	}
+	if got := rc.headers[0].Get(webhook.HeaderEvent); got != webhook.EventPublished {
+		t.Errorf("Expected event %s, got %s", webhook.EventPublished, got)
+	}
+	var e webhook.Event
+	if err := json.Unmarshal(rc.payloads[0], &e); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if e.Library != "lib-a" || e.Version != "1.0.0" || e.Actor.User != "test" {
+		t.Errorf("Unexpected event: %+v", e)
+	}
+
+	publish(t, s, "lib-b", "1.0.0", nil, "b")
+	if err := d.DeliverDue(); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+	if len(rc.payloads) != 3 {
+		t.Errorf("Expected 2 deliveries for lib-b, got %d", len(rc.payloads)-1)
+	}
+
+	entries, err := s.AuditLog(context.Background(), audit.Filter{Action: audit.ActionWebhookCreate})
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("Expected 2 audited webhook creations, got %d", len(entries))
+	}
+}
+
+func TestWebhookRetryAndRedeliver(t *testing.T) {
+	s := newTestService(t)
+	d := newTestDispatcher(s)
+	rc := &receiver{statuses: []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusBadGateway}}
+	srv := httptest.NewServer(rc)
+	defer srv.Close()
+
+	hook, err := s.CreateWebhook(context.Background(), audit.Actor{User: "test"}, webhook.Hook{URL: srv.URL, Events: []string{webhook.EventPublished}})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	publish(t, s, "lib-a", "1.0.0", nil, "a")
+	if err := d.DeliverDue(); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+
+	deliveries, err := s.Deliveries(context.Background(), webhook.DeliveryFilter{WebhookID: hook.ID})
+	if err != nil {
+		t.Fatalf("Failed to read deliveries: %v", err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", len(deliveries))
+	}
+	failed := deliveries[0]
+	if failed.Status != webhook.StatusFailed || failed.Attempts != 3 || failed.ResponseCode != http.StatusBadGateway {
+		t.Errorf("Expected a failed delivery after 3 attempts, got %+v", failed)
+	}
+
+	redelivery, err := s.Redeliver(context.Background(), failed.ID)
+	if err != nil {
+		t.Fatalf("Failed to redeliver: %v", err)
+	}
+	if err := d.DeliverDue(); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+
+	deliveries, err = s.Deliveries(context.Background(), webhook.DeliveryFilter{Status: webhook.StatusDelivered})
+	if err != nil {
+		t.Fatalf("Failed to read deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].ID != redelivery.ID || deliveries[0].EventID != failed.EventID {
+		t.Errorf("Expected redelivery %d of event %s to succeed, got %+v", redelivery.ID, failed.EventID, deliveries)
+	}
+	if len(rc.payloads) != 4 || string(rc.payloads[3]) != string(rc.payloads[0]) {
+		t.Errorf("Expected the same payload to be sent 4 times, got %d requests", len(rc.payloads))
+	}
+}
+
+func TestWebhookRemoved(t *testing.T) {
+	s := newTestService(t)
+	d := newTestDispatcher(s)
+
+	hook, err := s.CreateWebhook(context.Background(), audit.Actor{User: "test"}, webhook.Hook{URL: "http://127.0.0.1:1/hook"})
+	if err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+	publish(t, s, "lib-a", "1.0.0", nil, "a")
+	if err := s.DeleteWebhook(context.Background(), audit.Actor{User: "test"}, hook.ID); err != nil {
+		t.Fatalf("Failed to delete webhook: %v", err)
+	}
+	if err := d.DeliverDue(); err != nil {
+		t.Fatalf("Failed to deliver: %v", err)
+	}
+
+	deliveries, err := s.Deliveries(context.Background(), webhook.DeliveryFilter{})
+	if err != nil {
+		t.Fatalf("Failed to read deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != webhook.StatusFailed {
+		t.Errorf("Expected the pending delivery to fail, got %+v", deliveries)
+	}
+	if _, err := s.Redeliver(context.Background(), deliveries[0].ID); err == nil {
+		t.Error("Expected redelivery to a removed webhook to fail")
+	}
+}
+
+func TestWebhookEventsQueuedWithSave(t *testing.T) {
+	s := newTestService(t)
+	s.SetAllowLocalWebhooks(true)
+	if _, err := s.CreateWebhook(context.Background(), audit.Actor{User: "test"}, webhook.Hook{URL: "http://127.0.0.1:1/hook"}); err != nil {
+		t.Fatalf("Failed to create webhook: %v", err)
+	}
+
+	// No dispatcher is running, so the delivery can only come from the
+	// transaction that saved the version.
+	publish(t, s, "lib-a", "1.0.0", nil, "a")
+	deliveries, err := s.Deliveries(context.Background(), webhook.DeliveryFilter{})
+	if err != nil {
+		t.Fatalf("Failed to read deliveries: %v", err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != webhook.StatusPending || deliveries[0].Event != webhook.EventPublished {
+		t.Errorf("Expected one pending delivery, got %+v", deliveries)
+	}
+}
+
+func TestCreateWebhookRefusesLocalURLs(t *testing.T) {
+	s := newTestService(t)
+	if _, err := s.CreateWebhook(context.Background(), audit.Actor{User: "test"}, webhook.Hook{URL: "http://169.254.169.254/latest"}); err == nil {
+		t.Error("Expected a link-local webhook URL to be refused")
+	}
+}
@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iamgp/hvr/internal/audit"
+)
+
+func createAuditTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			time TEXT NOT NULL,
+			user TEXT NOT NULL,
+			address TEXT NOT NULL DEFAULT '',
+			action TEXT NOT NULL,
+			target TEXT NOT NULL,
+			before TEXT NOT NULL,
+			after TEXT NOT NULL,
+			prev_hash TEXT NOT NULL,
+			hash TEXT NOT NULL
+		);
+		CREATE TRIGGER IF NOT EXISTS audit_log_no_update BEFORE UPDATE ON audit_log
+		BEGIN
+			SELECT RAISE(ABORT, 'audit log is append-only');
+		END;
+		CREATE TRIGGER IF NOT EXISTS audit_log_no_delete BEFORE DELETE ON audit_log
+		BEGIN
+			SELECT RAISE(ABORT, 'audit log is append-only');
+		END;
+	`)
+	return err
+}
+
+const auditColumns = "id, time, user, address, action, target, before, after, prev_hash, hash"
+
+// appendAudit chains an entry to the last one in the log and inserts it as
+// part of tx. Transactions take the write lock when they begin, so no other
+// writer can append in between.
+func appendAudit(ctx context.Context, tx *sql.Tx, e *audit.Entry) error {
+	var prevHash string
+	err := tx.QueryRowContext(ctx, "SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to read the audit log: %w", err)
+	}
+
+	// Stored times are parsed back for verification, so seal what is stored.
+	e.Time, _ = time.Parse(timeFormat, formatTime(e.Time))
+	e.Seal(prevHash)
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO audit_log (time, user, address, action, target, before, after, prev_hash, hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		formatTime(e.Time), e.User, e.Address, e.Action, e.Target, string(e.Before), string(e.After), e.PrevHash, e.Hash)
+	if err != nil {
+		return fmt.Errorf("failed to write the audit log: %w", err)
+	}
+	e.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// AuditLog returns the audit entries matching filter, oldest first.
+func (db *SQLiteDatabase) AuditLog(filter audit.Filter) ([]audit.Entry, error) {
+	defer db.timed("audit_log")()
+
+	var where []string
+	var args []interface{}
+	if filter.User != "" {
+		where = append(where, "user = ?")
+		args = append(args, filter.User)
+	}
+	if filter.Action != "" {
+		where = append(where, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.Library != "" {
+		where = append(where, "(target = ? OR substr(target, 1, ?) = ?)")
+		args = append(args, filter.Library, len(filter.Library)+1, filter.Library+"@")
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, formatTime(filter.Since))
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, formatTime(filter.Until))
+	}
+
+	query := "SELECT " + auditColumns + " FROM audit_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := db.db.QueryContext(db.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []audit.Entry
+	for rows.Next() {
+		var e audit.Entry
+		var t, before, after string
+		if err := rows.Scan(&e.ID, &t, &e.User, &e.Address, &e.Action, &e.Target, &before, &after, &e.PrevHash, &e.Hash); err != nil {
+			return nil, err
+		}
+		e.Time, err = time.Parse(timeFormat, t)
+		if err != nil {
+			return nil, fmt.Errorf("invalid time in audit entry %d: %w", e.ID, err)
+		}
+		e.Before, e.After = []byte(before), []byte(after)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Newest entries were selected so that Limit keeps the most recent;
+	// return them in log order.
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
@@ -1,21 +1,59 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/iamgp/hvr/internal/audit"
 	"github.com/iamgp/hvr/internal/models"
+	"github.com/iamgp/hvr/internal/webhook"
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type SQLiteDatabase struct {
-	db *sql.DB
+	db      *sql.DB
+	ctx     context.Context
+	observe QueryObserver
+}
+
+// QueryObserver is told how long each database operation took. ctx is the
+// context the database was bound to with WithContext.
+type QueryObserver func(ctx context.Context, operation string, d time.Duration)
+
+// SetQueryObserver makes the database report the duration of its
+// operations to o. Set it before calling WithContext.
+func (db *SQLiteDatabase) SetQueryObserver(o QueryObserver) {
+	db.observe = o
+}
+
+// WithContext returns a view of the database whose operations run with
+// ctx, so they are cancelled with it and reported with its request ID.
+func (db *SQLiteDatabase) WithContext(ctx context.Context) *SQLiteDatabase {
+	bound := *db
+	bound.ctx = ctx
+	return &bound
+}
+
+// timed starts timing an operation; call the returned function when it
+// is done.
+func (db *SQLiteDatabase) timed(operation string) func() {
+	if db.observe == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() { db.observe(db.ctx, operation, time.Since(start)) }
 }
 
 func NewSQLiteDatabase(dbPath string) (*SQLiteDatabase, error) {
-	db, err := sql.Open("sqlite3", dbPath)
+	// Transactions take the write lock up front, so that audit entries are
+	// chained in the order they are committed.
+	db, err := sql.Open("sqlite3", dbPath+"?_txlock=immediate")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -28,7 +66,11 @@ func NewSQLiteDatabase(dbPath string) (*SQLiteDatabase, error) {
 		return nil, fmt.Errorf("failed to create table: %w", err)
 	}
 
-	return &SQLiteDatabase{db: db}, nil
+	if err := migrate(db); err != nil {
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return &SQLiteDatabase{db: db, ctx: context.Background()}, nil
 }
 
 func createTable(db *sql.DB) error {
@@ -42,38 +84,161 @@ func createTable(db *sql.DB) error {
 			file_path TEXT,
 			hash TEXT,
 			dependencies TEXT,
+			signature TEXT NOT NULL DEFAULT '',
+			signing_key TEXT NOT NULL DEFAULT '',
+			published_at TEXT NOT NULL DEFAULT '',
+			changelog TEXT NOT NULL DEFAULT '',
 			PRIMARY KEY (name, version)
 		)
 	`)
-	return err
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		CREATE TABLE IF NOT EXISTS files (
+			name TEXT,
+			version TEXT,
+			path TEXT,
+			size INTEGER,
+			has_footer INTEGER NOT NULL DEFAULT 0,
+			author TEXT NOT NULL DEFAULT '',
+			valid TEXT NOT NULL DEFAULT '',
+			time TEXT NOT NULL DEFAULT '',
+			checksum TEXT NOT NULL DEFAULT '',
+			checksum_valid INTEGER NOT NULL DEFAULT 0,
+			PRIMARY KEY (name, version, path)
+		)
+	`)
+	if err != nil {
+		return err
+	}
+
+	if err := createAuditTable(db); err != nil {
+		return err
+	}
+
+	return createWebhookTables(db)
 }
 
-func (db *SQLiteDatabase) Save(library models.Library) error {
-	dependenciesJSON, err := json.Marshal(library.Dependencies)
+// migrate brings databases created by older versions up to the current schema.
+func migrate(db *sql.DB) error {
+	columns := []struct{ table, name, definition string }{
+		{"libraries", "signature", "TEXT NOT NULL DEFAULT ''"},
+		{"libraries", "signing_key", "TEXT NOT NULL DEFAULT ''"},
+		{"libraries", "published_at", "TEXT NOT NULL DEFAULT ''"},
+		{"libraries", "changelog", "TEXT NOT NULL DEFAULT ''"},
+		{"files", "has_footer", "INTEGER NOT NULL DEFAULT 0"},
+		{"files", "author", "TEXT NOT NULL DEFAULT ''"},
+		{"files", "valid", "TEXT NOT NULL DEFAULT ''"},
+		{"files", "time", "TEXT NOT NULL DEFAULT ''"},
+		{"files", "checksum", "TEXT NOT NULL DEFAULT ''"},
+		{"files", "checksum_valid", "INTEGER NOT NULL DEFAULT 0"},
+	}
+
+	for _, c := range columns {
+		exists, err := columnExists(db, c.table, c.name)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.name, c.definition)); err != nil {
+			return fmt.Errorf("failed to add column %s.%s: %w", c.table, c.name, err)
+		}
+	}
+	return nil
+}
+
+func columnExists(db *sql.DB, table, column string) (bool, error) {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
 	if err != nil {
-		return fmt.Errorf("failed to marshal dependencies: %w", err)
+		return false, err
 	}
+	defer rows.Close()
 
-	_, err = db.db.Exec("INSERT OR REPLACE INTO libraries (name, version, description, author, repo_url, file_path, hash, dependencies) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
-		library.Name, library.Version.String(), library.Description, library.Author, library.RepoURL, library.FilePath, library.Hash, string(dependenciesJSON))
-	return err
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, typ string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &typ, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
 }
 
-func (db *SQLiteDatabase) Get(name, version string) (models.Library, error) {
-	var library models.Library
-	var versionStr, dependenciesJSON string
-	err := db.db.QueryRow("SELECT name, version, description, author, repo_url, file_path, hash, dependencies FROM libraries WHERE name = ? AND version = ?",
-		name, version).Scan(&library.Name, &versionStr, &library.Description, &library.Author, &library.RepoURL, &library.FilePath, &library.Hash, &dependenciesJSON)
-	if err == sql.ErrNoRows {
-		return models.Library{}, fmt.Errorf("library %s version %s not found", name, version)
+const libraryColumns = "name, version, description, author, repo_url, file_path, hash, dependencies, signature, signing_key, published_at, changelog"
+
+// timeFormat is a fixed-width UTC layout, so stored times compare correctly
+// as strings. Rows written before publish times were recorded hold "".
+const timeFormat = "2006-01-02T15:04:05.000000000Z"
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
 	}
+	return t.UTC().Format(timeFormat)
+}
+
+// FindFiles returns every library version containing a file whose path is
+// suffix or ends with "/"+suffix, compared case-insensitively.
+func (db *SQLiteDatabase) FindFiles(suffix string) ([]models.FileMatch, error) {
+	defer db.timed("find_files")()
+
+	suffix = strings.ToLower(suffix)
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(suffix)
+
+	rows, err := db.db.QueryContext(db.ctx, `SELECT name, version, path FROM files WHERE lower(path) = ? OR lower(path) LIKE ? ESCAPE '\'`,
+		suffix, "%/"+escaped)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var matches []models.FileMatch
+	for rows.Next() {
+		var m models.FileMatch
+		if err := rows.Scan(&m.Name, &m.Version, &m.Path); err != nil {
+			return nil, err
+		}
+		matches = append(matches, m)
+	}
+	return matches, rows.Err()
+}
+
+const fileColumns = "path, size, has_footer, author, valid, time, checksum, checksum_valid"
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+var errInvalidVersion = errors.New("invalid version")
+
+// scanLibrary reads a row selected with libraryColumns.
+func scanLibrary(row rowScanner) (models.Library, error) {
+	var library models.Library
+	var versionStr, dependenciesJSON, publishedAt string
+	err := row.Scan(&library.Name, &versionStr, &library.Description, &library.Author, &library.RepoURL, &library.FilePath, &library.Hash, &dependenciesJSON,
+		&library.Signature, &library.SigningKey, &publishedAt, &library.Changelog)
 	if err != nil {
 		return models.Library{}, err
 	}
 
+	if publishedAt != "" {
+		library.PublishedAt, err = time.Parse(timeFormat, publishedAt)
+		if err != nil {
+			return models.Library{}, fmt.Errorf("invalid publish time %q: %w", publishedAt, err)
+		}
+	}
+
 	library.Version, err = semver.NewVersion(versionStr)
 	if err != nil {
-		return models.Library{}, fmt.Errorf("invalid version: %w", err)
+		return models.Library{}, fmt.Errorf("%w: %v", errInvalidVersion, err)
 	}
 
 	err = json.Unmarshal([]byte(dependenciesJSON), &library.Dependencies)
@@ -84,8 +249,95 @@ func (db *SQLiteDatabase) Get(name, version string) (models.Library, error) {
 	return library, nil
 }
 
+// Save stores a library version and, in the same transaction, appends entry
+// to the audit log and queues event for the webhooks that want it, unless
+// they are nil.
+func (db *SQLiteDatabase) Save(library models.Library, entry *audit.Entry, event *webhook.Event) error {
+	defer db.timed("save")()
+
+	dependenciesJSON, err := json.Marshal(library.Dependencies)
+	if err != nil {
+		return fmt.Errorf("failed to marshal dependencies: %w", err)
+	}
+
+	tx, err := db.db.BeginTx(db.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(db.ctx, "INSERT OR REPLACE INTO libraries ("+libraryColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		library.Name, library.Version.String(), library.Description, library.Author, library.RepoURL, library.FilePath, library.Hash, string(dependenciesJSON),
+		library.Signature, library.SigningKey, formatTime(library.PublishedAt), library.Changelog)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(db.ctx, "DELETE FROM files WHERE name = ? AND version = ?", library.Name, library.Version.String())
+	if err != nil {
+		return err
+	}
+	for _, f := range library.Files {
+		_, err = tx.ExecContext(db.ctx, "INSERT INTO files (name, version, "+fileColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			library.Name, library.Version.String(), f.Path, f.Size, f.HasFooter, f.Author, f.Valid, f.Time, f.Checksum, f.ChecksumValid)
+		if err != nil {
+			return fmt.Errorf("failed to save file %s: %w", f.Path, err)
+		}
+	}
+
+	if entry != nil {
+		if err := appendAudit(db.ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+	if event != nil {
+		if err := queueEvent(db.ctx, tx, event); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetFiles returns the archive listing recorded for a library version.
+func (db *SQLiteDatabase) GetFiles(name, version string) ([]models.LibraryFile, error) {
+	defer db.timed("get_files")()
+
+	rows, err := db.db.QueryContext(db.ctx, "SELECT "+fileColumns+" FROM files WHERE name = ? AND version = ? ORDER BY path", name, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []models.LibraryFile
+	for rows.Next() {
+		var f models.LibraryFile
+		if err := rows.Scan(&f.Path, &f.Size, &f.HasFooter, &f.Author, &f.Valid, &f.Time, &f.Checksum, &f.ChecksumValid); err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return files, rows.Err()
+}
+
+func (db *SQLiteDatabase) Get(name, version string) (models.Library, error) {
+	defer db.timed("get")()
+
+	library, err := scanLibrary(db.db.QueryRowContext(db.ctx, "SELECT "+libraryColumns+" FROM libraries WHERE name = ? AND version = ?", name, version))
+	if err == sql.ErrNoRows {
+		return models.Library{}, fmt.Errorf("library %s version %s not found", name, version)
+	}
+	if err != nil {
+		return models.Library{}, err
+	}
+
+	return library, nil
+}
+
 func (db *SQLiteDatabase) Search(query string) ([]models.Library, error) {
-	rows, err := db.db.Query("SELECT name, version FROM libraries WHERE name LIKE ?", "%"+query+"%")
+	defer db.timed("search")()
+
+	rows, err := db.db.QueryContext(db.ctx, "SELECT name, version FROM libraries WHERE name LIKE ?", "%"+query+"%")
 	if err != nil {
 		return nil, err
 	}
@@ -102,12 +354,110 @@ func (db *SQLiteDatabase) Search(query string) ([]models.Library, error) {
 	return libraries, rows.Err()
 }
 
+// List returns every library version published at or after since, ordered
+// by name and publish time. A zero since includes versions whose publish
+// time is unknown.
+func (db *SQLiteDatabase) List(since time.Time) ([]models.Library, error) {
+	defer db.timed("list")()
+
+	return db.queryLibraries("SELECT "+libraryColumns+" FROM libraries WHERE published_at >= ? ORDER BY name, published_at", formatTime(since))
+}
+
+// Recent returns up to limit versions, newest publish first, of the library
+// name or of every library when name is empty. Versions without a recorded
+// publish time are left out.
+func (db *SQLiteDatabase) Recent(name string, limit int) ([]models.Library, error) {
+	defer db.timed("recent")()
+
+	query := "SELECT " + libraryColumns + " FROM libraries WHERE published_at != ''"
+	var args []interface{}
+	if name != "" {
+		query += " AND name = ?"
+		args = append(args, name)
+	}
+	query += " ORDER BY published_at DESC, name LIMIT ?"
+	return db.queryLibraries(query, append(args, limit)...)
+}
+
+// queryLibraries runs a query selecting libraryColumns, skipping rows with
+// versions that don't parse.
+func (db *SQLiteDatabase) queryLibraries(query string, args ...interface{}) ([]models.Library, error) {
+	rows, err := db.db.QueryContext(db.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var libraries []models.Library
+	for rows.Next() {
+		library, err := scanLibrary(rows)
+		if errors.Is(err, errInvalidVersion) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		libraries = append(libraries, library)
+	}
+	return libraries, rows.Err()
+}
+
+// Counts returns the number of libraries and of library versions.
+func (db *SQLiteDatabase) Counts() (libraries, versions int, err error) {
+	defer db.timed("counts")()
+
+	err = db.db.QueryRowContext(db.ctx, "SELECT COUNT(DISTINCT name), COUNT(*) FROM libraries").Scan(&libraries, &versions)
+	return libraries, versions, err
+}
+
+// Record is the stored location and hash of one library version, read
+// without interpreting the rest of the row.
+type Record struct {
+	Name     string
+	Version  string
+	FilePath string
+	Hash     string
+}
+
+// Records returns the location and hash of every library version.
+func (db *SQLiteDatabase) Records() ([]Record, error) {
+	defer db.timed("records")()
+
+	rows, err := db.db.QueryContext(db.ctx, "SELECT name, version, file_path, hash FROM libraries ORDER BY name, version")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var r Record
+		var filePath, hash sql.NullString
+		if err := rows.Scan(&r.Name, &r.Version, &filePath, &hash); err != nil {
+			return nil, err
+		}
+		r.FilePath, r.Hash = filePath.String, hash.String
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// Ping checks that the database can be queried.
+func (db *SQLiteDatabase) Ping() error {
+	defer db.timed("ping")()
+
+	var n int
+	return db.db.QueryRowContext(db.ctx, "SELECT COUNT(*) FROM sqlite_master").Scan(&n)
+}
+
 func (db *SQLiteDatabase) Close() error {
 	return db.db.Close()
 }
 
 func (db *SQLiteDatabase) GetLatest(name string) (models.Library, error) {
-	rows, err := db.db.Query("SELECT name, version, description, author, repo_url, file_path, hash, dependencies FROM libraries WHERE name = ? ORDER BY version DESC", name)
+	defer db.timed("get_latest")()
+
+	rows, err := db.db.QueryContext(db.ctx, "SELECT "+libraryColumns+" FROM libraries WHERE name = ? ORDER BY version DESC", name)
 	if err != nil {
 		return models.Library{}, err
 	}
@@ -117,23 +467,17 @@ func (db *SQLiteDatabase) GetLatest(name string) (models.Library, error) {
 	var latestVersion *semver.Version
 
 	for rows.Next() {
-		var library models.Library
-		var versionStr, dependenciesJSON string
-		err := rows.Scan(&library.Name, &versionStr, &library.Description, &library.Author, &library.RepoURL, &library.FilePath, &library.Hash, &dependenciesJSON)
-		if err != nil {
-			return models.Library{}, err
+		library, err := scanLibrary(rows)
+		if errors.Is(err, errInvalidVersion) {
+			continue // Skip invalid versions
 		}
-
-		version, err := semver.NewVersion(versionStr)
 		if err != nil {
-			continue // Skip invalid versions
+			return models.Library{}, err
 		}
 
-		if latestVersion == nil || version.GreaterThan(latestVersion) {
-			latestVersion = version
+		if latestVersion == nil || library.Version.GreaterThan(latestVersion) {
+			latestVersion = library.Version
 			latestLibrary = library
-			latestLibrary.Version = version
-			json.Unmarshal([]byte(dependenciesJSON), &latestLibrary.Dependencies)
 		}
 	}
 
@@ -146,7 +490,9 @@ func (db *SQLiteDatabase) GetLatest(name string) (models.Library, error) {
 
 // Add this new method to the SQLiteDatabase struct
 func (db *SQLiteDatabase) GetAllVersions(name string) ([]*semver.Version, error) {
-	rows, err := db.db.Query("SELECT version FROM libraries WHERE name = ?", name)
+	defer db.timed("get_all_versions")()
+
+	rows, err := db.db.QueryContext(db.ctx, "SELECT version FROM libraries WHERE name = ?", name)
 	if err != nil {
 		return nil, err
 	}
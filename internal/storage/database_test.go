@@ -1,10 +1,15 @@
 package storage
 
 import (
+	"errors"
+	"io"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/iamgp/hvr/internal/audit"
 	"github.com/iamgp/hvr/internal/models"
 )
 
@@ -31,7 +36,7 @@ func TestSQLiteDatabase(t *testing.T) {
 		},
 	}
 
-	err = db.Save(lib)
+	err = db.Save(lib, nil, nil)
 	if err != nil {
 		t.Fatalf("Failed to save library: %v", err)
 	}
@@ -49,3 +54,172 @@ func TestSQLiteDatabase(t *testing.T) {
 		t.Errorf("Expected version to be '%s', got '%s'", lib.Version.String(), retrieved.Version.String())
 	}
 }
+
+func TestSQLiteDatabaseFiles(t *testing.T) {
+	dbPath := "test_files.db"
+	db, err := NewSQLiteDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer os.Remove(dbPath)
+	defer db.Close()
+
+	version, _ := semver.NewVersion("1.0.0")
+	lib := models.Library{
+		Name:    "venus-lib",
+		Version: version,
+		Files: []models.LibraryFile{
+			{Path: "VenusLib/VenusLib.hsl", Size: 120, HasFooter: true, Author: "admin", Checksum: "1a2b3c4d", ChecksumValid: true},
+			{Path: "VenusLib/README.txt", Size: 10},
+		},
+	}
+
+	if err := db.Save(lib, nil, nil); err != nil {
+		t.Fatalf("Failed to save library: %v", err)
+	}
+
+	files, err := db.GetFiles("venus-lib", "1.0.0")
+	if err != nil {
+		t.Fatalf("Failed to get files: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 files, got %d", len(files))
+	}
+	if files[1].Path != "VenusLib/VenusLib.hsl" || !files[1].ChecksumValid || files[1].Author != "admin" {
+		t.Errorf("Unexpected file record: %+v", files[1])
+	}
+}
+
+func TestSQLiteDatabaseList(t *testing.T) {
+	dbPath := "test_list.db"
+	db, err := NewSQLiteDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer os.Remove(dbPath)
+	defer db.Close()
+
+	published := time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC)
+	for _, lib := range []struct {
+		version string
+		at      time.Time
+	}{
+		{"1.0.0", time.Time{}},
+		{"1.1.0", published},
+		{"1.2.0", published.Add(time.Second)},
+	} {
+		v, _ := semver.NewVersion(lib.version)
+		if err := db.Save(models.Library{Name: "lib", Version: v, PublishedAt: lib.at}, nil, nil); err != nil {
+			t.Fatalf("Failed to save library: %v", err)
+		}
+	}
+
+	all, err := db.List(time.Time{})
+	if err != nil {
+		t.Fatalf("Failed to list libraries: %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("Expected 3 libraries, got %d", len(all))
+	}
+
+	recent, err := db.List(published)
+	if err != nil {
+		t.Fatalf("Failed to list libraries: %v", err)
+	}
+	if len(recent) != 2 || recent[0].Version.String() != "1.1.0" || !recent[0].PublishedAt.Equal(published) {
+		t.Errorf("Expected 1.1.0 and 1.2.0 published since %s, got %+v", published, recent)
+	}
+}
+
+func TestSQLiteDatabaseAuditLog(t *testing.T) {
+	dbPath := "test_audit.db"
+	db, err := NewSQLiteDatabase(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	defer os.Remove(dbPath)
+	defer db.Close()
+
+	for _, v := range []string{"1.0.0", "1.1.0"} {
+		lib := models.Library{Name: "lib-a", Version: semver.MustParse(v)}
+		entry, _ := audit.NewEntry(audit.Actor{User: "alice"}, audit.ActionUpload, "lib-a@"+v, nil, map[string]string{"version": v})
+		if err := db.Save(lib, entry, nil); err != nil {
+			t.Fatalf("Failed to save library: %v", err)
+		}
+	}
+	entry, _ := audit.NewEntry(audit.Actor{User: "bob"}, audit.ActionUpload, "lib-ab@1.0.0", nil, nil)
+	if err := db.Save(models.Library{Name: "lib-ab", Version: semver.MustParse("1.0.0")}, entry, nil); err != nil {
+		t.Fatalf("Failed to save library: %v", err)
+	}
+
+	entries, err := db.AuditLog(audit.Filter{})
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("Expected 3 entries, got %d", len(entries))
+	}
+	if err := audit.Verify(entries, ""); err != nil {
+		t.Errorf("Expected an intact chain, got %v", err)
+	}
+
+	if entries, _ := db.AuditLog(audit.Filter{Library: "lib-a"}); len(entries) != 2 {
+		t.Errorf("Expected 2 entries for lib-a, got %d", len(entries))
+	}
+	if entries, _ := db.AuditLog(audit.Filter{User: "alice", Limit: 1}); len(entries) != 1 || entries[0].Target != "lib-a@1.1.0" {
+		t.Errorf("Expected the latest entry by alice, got %+v", entries)
+	}
+
+	if _, err := db.db.Exec("UPDATE audit_log SET user = 'mallory' WHERE id = 1"); err == nil {
+		t.Errorf("Expected audit entries to be read-only")
+	}
+	if _, err := db.db.Exec("DELETE FROM audit_log"); err == nil {
+		t.Errorf("Expected audit entries not to be deletable")
+	}
+
+	// Edits that get past the triggers are found by the chain.
+	db.db.Exec("DROP TRIGGER audit_log_no_update")
+	db.db.Exec("UPDATE audit_log SET user = 'mallory' WHERE id = 1")
+	entries, _ = db.AuditLog(audit.Filter{})
+	if err := audit.Verify(entries, ""); err == nil {
+		t.Errorf("Expected the edited entry to break the chain")
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("connection reset") }
+
+func TestLocalFileStoreSave(t *testing.T) {
+	fs, err := NewLocalFileStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	modTime := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	path, err := fs.Save("lib-a", "1.0.0", strings.NewReader("archive"), modTime)
+	if err != nil {
+		t.Fatalf("Failed to save file: %v", err)
+	}
+	content, got, err := fs.Get(path)
+	if err != nil || string(content) != "archive" || !got.Equal(modTime) {
+		t.Errorf("Expected the saved archive with its modification time, got %q, %v, %v", content, got, err)
+	}
+
+	// An interrupted save leaves neither a partial archive nor a
+	// temporary file behind.
+	if _, err := fs.Save("lib-a", "2.0.0", io.MultiReader(strings.NewReader("part"), failingReader{}), modTime); err == nil {
+		t.Fatal("Expected the interrupted save to fail")
+	}
+	files, err := fs.List()
+	if err != nil {
+		t.Fatalf("Failed to list files: %v", err)
+	}
+	if len(files) != 1 || files[0].Path != path {
+		t.Errorf("Expected only %s in the store, got %+v", path, files)
+	}
+
+	if err := fs.Check(); err != nil {
+		t.Errorf("Expected the store check to pass, got %v", err)
+	}
+}
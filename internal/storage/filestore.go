@@ -11,6 +11,20 @@ import (
 type FileStore interface {
 	Save(name, version string, data io.Reader, modTime time.Time) (string, error)
 	Get(path string) ([]byte, time.Time, error)
+	// List returns every file in the store, with the paths Save returned
+	// for them.
+	List() ([]StoredFile, error)
+	// Delete removes a file from the store.
+	Delete(path string) error
+	// Check reports whether files can be written to the store.
+	Check() error
+}
+
+// StoredFile describes a file in a FileStore.
+type StoredFile struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
 }
 
 type LocalFileStore struct {
@@ -24,27 +38,46 @@ func NewLocalFileStore(baseDir string) (*LocalFileStore, error) {
 	return &LocalFileStore{baseDir: baseDir}, nil
 }
 
+// Save writes the archive to a temporary file and renames it into place, so
+// a server stopped mid-upload never leaves a partial archive under the
+// version's name. A temporary file left behind by a crash is an orphan that
+// fsck --gc removes.
 func (fs *LocalFileStore) Save(name, version string, data io.Reader, modTime time.Time) (string, error) {
 	filename := filepath.Join(fs.baseDir, name, version+".zip")
 	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
 		return "", err
 	}
-	file, err := os.Create(filename)
+	file, err := os.CreateTemp(filepath.Dir(filename), "."+version+".zip.*.tmp")
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
-	_, err = io.Copy(file, data)
-	if err != nil {
+	tmp := file.Name()
+	defer os.Remove(tmp) // fails once renamed
+
+	if _, err := io.Copy(file, data); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp, 0644); err != nil {
 		return "", err
 	}
 
 	// Set the modification time of the file
-	err = os.Chtimes(filename, time.Now(), modTime)
+	err = os.Chtimes(tmp, time.Now(), modTime)
 	if err != nil {
 		return "", fmt.Errorf("failed to set modification time: %w", err)
 	}
 
+	if err := os.Rename(tmp, filename); err != nil {
+		return "", err
+	}
 	return filename, nil
 }
 
@@ -67,3 +100,48 @@ func (fs *LocalFileStore) Get(path string) ([]byte, time.Time, error) {
 
 	return content, fileInfo.ModTime(), nil
 }
+
+func (fs *LocalFileStore) List() ([]StoredFile, error) {
+	var files []StoredFile
+	err := filepath.WalkDir(fs.baseDir, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, StoredFile{Path: path, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
+
+// Check writes and removes a file in the store's directory.
+func (fs *LocalFileStore) Check() error {
+	file, err := os.CreateTemp(fs.baseDir, ".check-*.tmp")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// Delete removes a file and, once it is empty, the library directory that
+// held it.
+func (fs *LocalFileStore) Delete(path string) error {
+	rel, err := filepath.Rel(filepath.Clean(fs.baseDir), filepath.Clean(path))
+	if err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("%s is not in the file store", path)
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); filepath.Clean(dir) != filepath.Clean(fs.baseDir) {
+		os.Remove(dir) // fails while the directory holds other versions
+	}
+	return nil
+}
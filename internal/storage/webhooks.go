@@ -0,0 +1,291 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/webhook"
+)
+
+func createWebhookTables(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			library TEXT NOT NULL DEFAULT '',
+			events TEXT NOT NULL DEFAULT '',
+			created TEXT NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id INTEGER NOT NULL,
+			event_id TEXT NOT NULL,
+			event TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			response_code INTEGER NOT NULL DEFAULT 0,
+			error TEXT NOT NULL DEFAULT '',
+			next_attempt TEXT NOT NULL,
+			created TEXT NOT NULL,
+			updated TEXT NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS webhook_deliveries_due ON webhook_deliveries (status, next_attempt);
+	`)
+	return err
+}
+
+const webhookColumns = "id, url, secret, library, events, created"
+
+const deliveryColumns = "id, webhook_id, event_id, event, payload, status, attempts, response_code, error, next_attempt, created, updated"
+
+// CreateWebhook registers a webhook, sets its ID and, in the same
+// transaction, appends entry to the audit log unless it is nil.
+func (db *SQLiteDatabase) CreateWebhook(hook *webhook.Hook, entry *audit.Entry) error {
+	defer db.timed("create_webhook")()
+	tx, err := db.db.BeginTx(db.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(db.ctx, "INSERT INTO webhooks (url, secret, library, events, created) VALUES (?, ?, ?, ?, ?)",
+		hook.URL, hook.Secret, hook.Library, strings.Join(hook.Events, ","), formatTime(hook.Created))
+	if err != nil {
+		return err
+	}
+	hook.ID, _ = res.LastInsertId()
+
+	if entry != nil {
+		if err := appendAudit(db.ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteWebhook removes a webhook and, in the same transaction, appends
+// entry to the audit log unless it is nil. Its delivery log is kept.
+func (db *SQLiteDatabase) DeleteWebhook(id int64, entry *audit.Entry) error {
+	defer db.timed("delete_webhook")()
+	tx, err := db.db.BeginTx(db.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(db.ctx, "DELETE FROM webhooks WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return webhook.ErrNotFound
+	}
+
+	if entry != nil {
+		if err := appendAudit(db.ctx, tx, entry); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetWebhook returns a webhook by ID.
+func (db *SQLiteDatabase) GetWebhook(id int64) (webhook.Hook, error) {
+	defer db.timed("get_webhook")()
+	hook, err := scanWebhook(db.db.QueryRowContext(db.ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return webhook.Hook{}, webhook.ErrNotFound
+	}
+	return hook, err
+}
+
+// Webhooks returns every registered webhook.
+func (db *SQLiteDatabase) Webhooks() ([]webhook.Hook, error) {
+	defer db.timed("webhooks")()
+	rows, err := db.db.QueryContext(db.ctx, "SELECT "+webhookColumns+" FROM webhooks ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hooks []webhook.Hook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+func scanWebhook(row rowScanner) (webhook.Hook, error) {
+	var h webhook.Hook
+	var events, created string
+	if err := row.Scan(&h.ID, &h.URL, &h.Secret, &h.Library, &events, &created); err != nil {
+		return webhook.Hook{}, err
+	}
+	if events != "" {
+		h.Events = strings.Split(events, ",")
+	}
+	var err error
+	h.Created, err = time.Parse(timeFormat, created)
+	if err != nil {
+		return webhook.Hook{}, fmt.Errorf("invalid time in webhook %d: %w", h.ID, err)
+	}
+	return h, nil
+}
+
+// AddDeliveries queues deliveries and sets their IDs.
+func (db *SQLiteDatabase) AddDeliveries(deliveries []webhook.Delivery) error {
+	defer db.timed("add_deliveries")()
+	tx, err := db.db.BeginTx(db.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertDeliveries(db.ctx, tx, deliveries); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// queueEvent queues e for every webhook that wants it as part of tx, so the
+// event is stored if and only if the change it announces is.
+func queueEvent(ctx context.Context, tx *sql.Tx, e *webhook.Event) error {
+	rows, err := tx.QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks ORDER BY id")
+	if err != nil {
+		return err
+	}
+	var hooks []webhook.Hook
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		hooks = append(hooks, hook)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	deliveries, err := webhook.NewDeliveries(*e, hooks)
+	if err != nil {
+		return err
+	}
+	if err := insertDeliveries(ctx, tx, deliveries); err != nil {
+		return fmt.Errorf("failed to queue webhook deliveries: %w", err)
+	}
+	return nil
+}
+
+func insertDeliveries(ctx context.Context, tx *sql.Tx, deliveries []webhook.Delivery) error {
+	for i := range deliveries {
+		d := &deliveries[i]
+		res, err := tx.ExecContext(ctx, "INSERT INTO webhook_deliveries (webhook_id, event_id, event, payload, status, attempts, response_code, error, next_attempt, created, updated) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			d.WebhookID, d.EventID, d.Event, string(d.Payload), d.Status, d.Attempts, d.ResponseCode, d.Error,
+			formatTime(d.NextAttempt), formatTime(d.Created), formatTime(d.Updated))
+		if err != nil {
+			return err
+		}
+		d.ID, _ = res.LastInsertId()
+	}
+	return nil
+}
+
+// UpdateDelivery records the outcome of a delivery attempt.
+func (db *SQLiteDatabase) UpdateDelivery(d webhook.Delivery) error {
+	defer db.timed("update_delivery")()
+	res, err := db.db.ExecContext(db.ctx, "UPDATE webhook_deliveries SET status = ?, attempts = ?, response_code = ?, error = ?, next_attempt = ?, updated = ? WHERE id = ?",
+		d.Status, d.Attempts, d.ResponseCode, d.Error, formatTime(d.NextAttempt), formatTime(d.Updated), d.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return webhook.ErrNotFound
+	}
+	return nil
+}
+
+// DueDeliveries returns up to limit pending deliveries whose next attempt
+// is at or before now, oldest first.
+func (db *SQLiteDatabase) DueDeliveries(now time.Time, limit int) ([]webhook.Delivery, error) {
+	defer db.timed("due_deliveries")()
+	return db.queryDeliveries("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE status = ? AND next_attempt <= ? ORDER BY next_attempt, id LIMIT ?",
+		webhook.StatusPending, formatTime(now), limit)
+}
+
+// GetDelivery returns a delivery by ID.
+func (db *SQLiteDatabase) GetDelivery(id int64) (webhook.Delivery, error) {
+	defer db.timed("get_delivery")()
+	deliveries, err := db.queryDeliveries("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id = ?", id)
+	if err != nil {
+		return webhook.Delivery{}, err
+	}
+	if len(deliveries) == 0 {
+		return webhook.Delivery{}, webhook.ErrNotFound
+	}
+	return deliveries[0], nil
+}
+
+// Deliveries returns the deliveries matching filter, newest first.
+func (db *SQLiteDatabase) Deliveries(filter webhook.DeliveryFilter) ([]webhook.Delivery, error) {
+	defer db.timed("deliveries")()
+	var where []string
+	var args []interface{}
+	if filter.WebhookID != 0 {
+		where = append(where, "webhook_id = ?")
+		args = append(args, filter.WebhookID)
+	}
+	if filter.Status != "" {
+		where = append(where, "status = ?")
+		args = append(args, filter.Status)
+	}
+
+	query := "SELECT " + deliveryColumns + " FROM webhook_deliveries"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+	return db.queryDeliveries(query, args...)
+}
+
+func (db *SQLiteDatabase) queryDeliveries(query string, args ...interface{}) ([]webhook.Delivery, error) {
+	rows, err := db.db.QueryContext(db.ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []webhook.Delivery
+	for rows.Next() {
+		var d webhook.Delivery
+		var payload, next, created, updated string
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.Event, &payload, &d.Status, &d.Attempts, &d.ResponseCode, &d.Error, &next, &created, &updated); err != nil {
+			return nil, err
+		}
+		d.Payload = []byte(payload)
+		for _, t := range []struct {
+			dst *time.Time
+			s   string
+		}{{&d.NextAttempt, next}, {&d.Created, created}, {&d.Updated, updated}} {
+			if *t.dst, err = time.Parse(timeFormat, t.s); err != nil {
+				return nil, fmt.Errorf("invalid time in webhook delivery %d: %w", d.ID, err)
+			}
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
@@ -0,0 +1,157 @@
+// Package upstream talks to another registry that a proxying server pulls
+// libraries from.
+package upstream
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/iamgp/hvr/internal/logging"
+	"github.com/iamgp/hvr/internal/models"
+)
+
+// DefaultTimeout is how long a client waits for the upstream to answer by
+// default.
+const DefaultTimeout = 10 * time.Second
+
+// ErrUnavailable is returned when the upstream can't be reached, doesn't
+// answer in time or fails with a server error.
+var ErrUnavailable = errors.New("upstream unavailable")
+
+// Client is an HTTP client for an upstream registry.
+type Client struct {
+	baseURL   string
+	http      *http.Client
+	transport *http.Transport
+	timeout   time.Duration
+}
+
+// NewClient returns a client for the registry at baseURL.
+func NewClient(baseURL string) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	c := &Client{
+		baseURL:   strings.TrimRight(baseURL, "/"),
+		http:      &http.Client{Transport: transport},
+		transport: transport,
+	}
+	c.SetTimeout(DefaultTimeout)
+	return c
+}
+
+// SetTLSConfig makes the client connect to the upstream with cfg, for
+// example to trust a private CA or present a client certificate.
+func (c *Client) SetTLSConfig(cfg *tls.Config) {
+	c.transport.TLSClientConfig = cfg
+}
+
+// SetTimeout sets how long the client waits for the upstream: for the
+// whole of a version or info lookup, and for the response to start when
+// downloading an archive. Archive transfers themselves are only limited by
+// the context of the request.
+func (c *Client) SetTimeout(d time.Duration) {
+	c.timeout = d
+	c.transport.ResponseHeaderTimeout = d
+}
+
+// URL returns the base URL of the upstream registry.
+func (c *Client) URL() string {
+	return c.baseURL
+}
+
+// Versions lists the published versions of a library.
+func (c *Client) Versions(ctx context.Context, name string) ([]*semver.Version, error) {
+	var versions []*semver.Version
+	if err := c.getJSON(ctx, "versions", url.Values{"name": {name}}, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// Info returns the record of a library version, or of the latest version
+// when version is "latest".
+func (c *Client) Info(ctx context.Context, name, version string) (models.Library, error) {
+	var library models.Library
+	if err := c.getJSON(ctx, "info", url.Values{"name": {name}, "version": {version}}, &library); err != nil {
+		return models.Library{}, err
+	}
+	if library.Version == nil {
+		return models.Library{}, fmt.Errorf("upstream returned no version for %s %s", name, version)
+	}
+	return library, nil
+}
+
+// Download returns the archive of a library version and its modification
+// time.
+func (c *Client) Download(ctx context.Context, name, version string) ([]byte, time.Time, error) {
+	resp, err := c.get(ctx, "download", url.Values{"name": {name}, "version": {version}})
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: failed to read archive: %w", ErrUnavailable, err)
+	}
+
+	modTime := time.Now()
+	if unix, err := strconv.ParseInt(resp.Header.Get("X-File-ModTime"), 10, 64); err == nil {
+		modTime = time.Unix(unix, 0)
+	}
+	return content, modTime, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, v interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	resp, err := c.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return fmt.Errorf("invalid upstream response from %s: %w", path, err)
+	}
+	return nil
+}
+
+// get requests path from upstream, passing on the request ID of ctx so a
+// proxied request can be followed across both registries' logs.
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := c.baseURL + "/" + path + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream request: %w", err)
+	}
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set(logging.RequestIDHeader, id)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		err := fmt.Errorf("upstream %s failed with status: %s, body: %s", path, resp.Status, strings.TrimSpace(string(body)))
+		if resp.StatusCode >= http.StatusInternalServerError {
+			err = fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+		return nil, err
+	}
+	return resp, nil
+}
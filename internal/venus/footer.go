@@ -0,0 +1,114 @@
+package venus
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"path"
+	"strings"
+)
+
+// Footer is the checksum line Venus appends to the files it writes:
+//
+//	// $$author=admin$$valid=0$$time=2021-03-04 10:11$$checksum=1a2b3c4d$$length=084$$
+type Footer struct {
+	Author   string
+	Valid    string
+	Time     string
+	Checksum string
+	Length   string
+
+	// checksumEnd is the offset just past "checksum=", the end of the
+	// region the checksum covers.
+	checksumEnd int
+}
+
+// FooterCheck is the result of checking a file's footer against its
+// content.
+type FooterCheck struct {
+	Footer   Footer
+	Present  bool
+	Computed string
+}
+
+// Valid reports whether the file has a footer whose checksum matches.
+func (c FooterCheck) Valid() bool {
+	return c.Present && strings.EqualFold(c.Footer.Checksum, c.Computed)
+}
+
+func (c FooterCheck) String() string {
+	switch {
+	case !c.Present:
+		return "no checksum footer"
+	case c.Valid():
+		return "checksum ok"
+	}
+	return fmt.Sprintf("checksum mismatch: footer says %s, content is %s", c.Footer.Checksum, c.Computed)
+}
+
+// HasFooter reports whether files named name are written by Venus with a
+// checksum footer.
+func HasFooter(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".hsl", ".hs_", ".med", ".smt", ".lay":
+		return true
+	}
+	return false
+}
+
+var footerStart = []byte("$$author=")
+
+// ParseFooter finds and parses the last checksum footer in content.
+func ParseFooter(content []byte) (Footer, bool) {
+	start := bytes.LastIndex(content, footerStart)
+	if start < 0 {
+		return Footer{}, false
+	}
+	line := content[start:]
+	if end := bytes.IndexAny(line, "\r\n"); end >= 0 {
+		line = line[:end]
+	}
+
+	var f Footer
+	for _, field := range strings.Split(string(line), "$$") {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "author":
+			f.Author = value
+		case "valid":
+			f.Valid = value
+		case "time":
+			f.Time = value
+		case "checksum":
+			f.Checksum = value
+		case "length":
+			f.Length = value
+		}
+	}
+
+	marker := bytes.Index(line, []byte("$$checksum="))
+	if marker < 0 {
+		return Footer{}, false
+	}
+	f.checksumEnd = start + marker + len("$$checksum=")
+	return f, true
+}
+
+// Checksum computes the footer checksum Venus would write for content: the
+// CRC-32 (IEEE) of everything up to and including "checksum=", as eight lower
+// case hex digits.
+func Checksum(content []byte, f Footer) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE(content[:f.checksumEnd]))
+}
+
+// CheckFooter parses the footer of content and recomputes its checksum.
+func CheckFooter(content []byte) FooterCheck {
+	f, ok := ParseFooter(content)
+	if !ok {
+		return FooterCheck{}
+	}
+	return FooterCheck{Footer: f, Present: true, Computed: Checksum(content, f)}
+}
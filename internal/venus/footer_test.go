@@ -0,0 +1,39 @@
+package venus
+
+import (
+	"fmt"
+	"hash/crc32"
+	"testing"
+)
+
+// withFooter appends a footer with a correct checksum to body, the way the
+// Venus editor saves files.
+func withFooter(body string) []byte {
+	prefix := body + "// $$author=labuser$$valid=0$$time=2024-05-01 09:30$$checksum="
+	sum := fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(prefix)))
+	return []byte(prefix + sum + "$$length=084$$\r\n")
+}
+
+func TestCheckFooter(t *testing.T) {
+	content := withFooter("namespace A {\r\n}\r\n")
+
+	check := CheckFooter(content)
+	if !check.Present {
+		t.Fatalf("Expected footer to be found")
+	}
+	if !check.Valid() {
+		t.Errorf("Expected valid checksum, got %s", check)
+	}
+	if check.Footer.Author != "labuser" || check.Footer.Time != "2024-05-01 09:30" || check.Footer.Valid != "0" {
+		t.Errorf("Unexpected footer fields: %+v", check.Footer)
+	}
+
+	edited := append([]byte("// edited outside Venus\r\n"), content...)
+	if CheckFooter(edited).Valid() {
+		t.Errorf("Expected checksum mismatch after editing")
+	}
+
+	if CheckFooter([]byte("namespace A {}\n")).Present {
+		t.Errorf("Expected no footer in plain file")
+	}
+}
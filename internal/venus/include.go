@@ -0,0 +1,123 @@
+package venus
+
+import (
+	"bufio"
+	"bytes"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Include is an #include directive found in an HSL file.
+type Include struct {
+	Path string
+	Line int
+}
+
+var includePattern = regexp.MustCompile(`^\s*#include\s+"([^"]+)"`)
+
+// ParseIncludes returns the #include directives in an HSL source file in the
+// order they appear. Paths are returned as written, with HSL string escapes
+// removed.
+func ParseIncludes(content []byte) []Include {
+	var includes []Include
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		m := includePattern.FindSubmatch(scanner.Bytes())
+		if m == nil {
+			continue
+		}
+		includes = append(includes, Include{
+			Path: strings.ReplaceAll(string(m[1]), `\\`, `\`),
+			Line: line,
+		})
+	}
+	return includes
+}
+
+// IsHSLFile reports whether name is an HSL source file that can contain
+// #include directives.
+func IsHSLFile(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".hsl", ".hs_", ".hsi":
+		return true
+	}
+	return false
+}
+
+// NormalizePath converts an archive or include path to the form used for
+// comparisons: forward slashes, lower case and no leading "./".
+func NormalizePath(p string) string {
+	p = strings.ReplaceAll(p, `\`, "/")
+	p = strings.TrimPrefix(p, "./")
+	return strings.ToLower(p)
+}
+
+// IsAbsoluteWindowsPath reports whether p is a drive-letter or UNC path.
+func IsAbsoluteWindowsPath(p string) bool {
+	if strings.HasPrefix(p, `\\`) || strings.HasPrefix(p, "//") {
+		return true
+	}
+	return len(p) >= 2 && p[1] == ':' && ((p[0] >= 'a' && p[0] <= 'z') || (p[0] >= 'A' && p[0] <= 'Z'))
+}
+
+// SystemIncludes are libraries installed with Venus itself, which packages
+// may include without declaring a dependency.
+var SystemIncludes = []string{
+	"hslmetedlib.hs_",
+	"hsltrclib.hsl",
+	"hslerrlib.hsl",
+	"hslstrlib.hsl",
+	"hslmthlib.hsl",
+	"hslfillib.hsl",
+	"hslseqlib.hsl",
+	"hsldevlib.hsl",
+	"hslutillib.hsl",
+}
+
+// IncludeResolver decides whether an include directive refers to a known
+// file.
+type IncludeResolver struct {
+	files map[string]bool
+}
+
+func NewIncludeResolver(files ...[]string) *IncludeResolver {
+	r := &IncludeResolver{files: make(map[string]bool)}
+	for _, list := range files {
+		for _, f := range list {
+			r.files[NormalizePath(f)] = true
+		}
+	}
+	return r
+}
+
+// Resolve returns the known file an include written in from refers to.
+// Includes are looked up relative to the including file first, then as a path
+// anywhere below a library folder, as Venus does when searching its Library
+// directory.
+func (r *IncludeResolver) Resolve(from, include string) (string, bool) {
+	inc := NormalizePath(include)
+
+	relative := path.Clean(path.Join(path.Dir(NormalizePath(from)), inc))
+	if r.files[relative] {
+		return relative, true
+	}
+	if r.files[inc] {
+		return inc, true
+	}
+	for f := range r.files {
+		if strings.HasSuffix(f, "/"+inc) {
+			return f, true
+		}
+	}
+	for _, sys := range SystemIncludes {
+		if path.Base(inc) == sys {
+			return sys, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,116 @@
+package venus
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+)
+
+// Problem is a single validation failure, located by file and line where
+// possible.
+type Problem struct {
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (p Problem) String() string {
+	switch {
+	case p.File != "" && p.Line > 0:
+		return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+	case p.File != "":
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+	return p.Message
+}
+
+// ValidationError is returned when an archive breaks Venus library
+// conventions.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+	return "library validation failed: " + strings.Join(msgs, "; ")
+}
+
+// ValidateArchive checks that an archive looks like a Venus library: it
+// contains HSL sources, has only relative paths, no editor leftovers, and
+// every #include resolves to a file in the archive, in dependencyFiles or in
+// Venus itself.
+func ValidateArchive(zr *zip.Reader, dependencyFiles []string) []Problem {
+	var problems []Problem
+	var names []string
+	hasHSL := false
+
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() {
+			continue
+		}
+		names = append(names, f.Name)
+
+		if IsAbsoluteWindowsPath(f.Name) || strings.HasPrefix(f.Name, "/") {
+			problems = append(problems, Problem{File: f.Name, Message: "absolute path in archive"})
+		} else if hasParentRef(f.Name) {
+			problems = append(problems, Problem{File: f.Name, Message: "path escapes the library folder"})
+		}
+
+		switch strings.ToLower(path.Ext(f.Name)) {
+		case ".bak", ".tmp":
+			problems = append(problems, Problem{File: f.Name, Message: "stray backup or temporary file"})
+		case ".hsl", ".hs_":
+			hasHSL = true
+		}
+	}
+
+	if !hasHSL {
+		problems = append(problems, Problem{Message: "archive contains no .hsl or .hs_ files"})
+	}
+
+	resolver := NewIncludeResolver(names, dependencyFiles)
+	for _, f := range zr.File {
+		if !IsHSLFile(f.Name) {
+			continue
+		}
+		content, err := readZipFile(f)
+		if err != nil {
+			problems = append(problems, Problem{File: f.Name, Message: fmt.Sprintf("cannot read file: %v", err)})
+			continue
+		}
+		for _, inc := range ParseIncludes(content) {
+			if IsAbsoluteWindowsPath(inc.Path) {
+				problems = append(problems, Problem{File: f.Name, Line: inc.Line, Message: fmt.Sprintf("absolute include path %q", inc.Path)})
+				continue
+			}
+			if _, ok := resolver.Resolve(f.Name, inc.Path); !ok {
+				problems = append(problems, Problem{File: f.Name, Line: inc.Line, Message: fmt.Sprintf("include %q not found in archive or dependencies", inc.Path)})
+			}
+		}
+	}
+
+	return problems
+}
+
+func hasParentRef(name string) bool {
+	for _, part := range strings.Split(strings.ReplaceAll(name, `\`, "/"), "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
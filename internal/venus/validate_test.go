@@ -0,0 +1,83 @@
+package venus
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func buildArchive(t *testing.T, files map[string]string) *zip.Reader {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for name, content := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create %s: %v", name, err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Failed to close archive: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatalf("Failed to open archive: %v", err)
+	}
+	return zr
+}
+
+func TestValidateArchiveAcceptsLibrary(t *testing.T) {
+	zr := buildArchive(t, map[string]string{
+		"MyLib/MyLib.hsl":     "#include \"HSLTrcLib.hsl\"\n#include \"MyLib\\\\Helpers.hs_\"\n#include \"Base.hsl\"\n",
+		"MyLib/Helpers.hs_":   "#include \"MyLib.hsl\"\n",
+		"MyLib/MyLib.bmp":     "",
+		"MyLib/docs/help.txt": "",
+	})
+
+	problems := ValidateArchive(zr, []string{"Base/Base.hsl"})
+	if len(problems) != 0 {
+		t.Errorf("Expected no problems, got %v", problems)
+	}
+}
+
+func TestValidateArchiveReportsProblems(t *testing.T) {
+	zr := buildArchive(t, map[string]string{
+		"MyLib.hsl":     "// header\n#include \"Missing.hsl\"\n#include \"C:\\\\Program Files\\\\HAMILTON\\\\Library\\\\X.hsl\"\n",
+		"MyLib.hsl.bak": "",
+		"trace.tmp":     "",
+	})
+
+	problems := ValidateArchive(zr, nil)
+
+	want := []string{
+		"MyLib.hsl:2: include \"Missing.hsl\" not found",
+		"MyLib.hsl:3: absolute include path",
+		"MyLib.hsl.bak: stray backup",
+		"trace.tmp: stray backup",
+	}
+	for _, w := range want {
+		found := false
+		for _, p := range problems {
+			if strings.HasPrefix(p.String(), w) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected a problem starting with %q, got %v", w, problems)
+		}
+	}
+	if len(problems) != len(want) {
+		t.Errorf("Expected %d problems, got %d: %v", len(want), len(problems), problems)
+	}
+}
+
+func TestValidateArchiveRequiresHSL(t *testing.T) {
+	zr := buildArchive(t, map[string]string{"README.md": "docs"})
+
+	problems := ValidateArchive(zr, nil)
+	if len(problems) != 1 || !strings.Contains(problems[0].Message, "no .hsl") {
+		t.Errorf("Expected a missing HSL problem, got %v", problems)
+	}
+}
@@ -0,0 +1,414 @@
+// Package webhook delivers registry events to HTTP endpoints.
+//
+// Every event is stored as one delivery per matching webhook before it is
+// sent, so deliveries survive restarts. Payloads are JSON, signed with
+// HMAC-SHA256 using the webhook's secret, and failed deliveries are retried
+// with exponential backoff.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/iamgp/hvr/internal/audit"
+)
+
+// Events a webhook can subscribe to.
+const (
+	EventPublished = "library.published"
+)
+
+// Events lists every event type.
+var Events = []string{EventPublished}
+
+// Delivery states.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-HVR-Event"
+	HeaderDelivery  = "X-HVR-Delivery"
+	HeaderSignature = "X-HVR-Signature"
+)
+
+var (
+	// ErrNotFound is returned for webhooks and deliveries that don't exist.
+	ErrNotFound = errors.New("not found")
+	// ErrInvalid is returned for webhooks that can't be registered.
+	ErrInvalid = errors.New("invalid webhook")
+)
+
+// Hook is a registered webhook endpoint.
+type Hook struct {
+	ID     int64  `json:"id"`
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"`
+	// Library limits the webhook to events about one library; empty means
+	// every library.
+	Library string `json:"library,omitempty"`
+	// Events limits the webhook to some event types; empty means all.
+	Events  []string  `json:"events,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// Validate checks a webhook before it is registered. Unless allowLocal is
+// set, URLs naming a loopback or link-local address are refused, so that
+// registering a webhook can't make the registry send requests to services
+// only reachable from its own host or to cloud metadata endpoints.
+func (h *Hook) Validate(allowLocal bool) error {
+	u, err := url.Parse(h.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: URL must start with http:// or https://", ErrInvalid)
+	}
+	if !allowLocal && localHost(u.Hostname()) {
+		return fmt.Errorf("%w: URL must not point to a loopback or link-local address", ErrInvalid)
+	}
+	for _, e := range h.Events {
+		if !knownEvent(e) {
+			return fmt.Errorf("%w: unknown event %q, expected one of %s", ErrInvalid, e, strings.Join(Events, ", "))
+		}
+	}
+	return nil
+}
+
+// Matches reports whether the webhook wants an event about library.
+func (h *Hook) Matches(event, library string) bool {
+	if h.Library != "" && h.Library != library {
+		return false
+	}
+	if len(h.Events) == 0 {
+		return true
+	}
+	for _, e := range h.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func knownEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// localHost reports whether host is localhost or a loopback, link-local or
+// unspecified IP address.
+func localHost(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && localIP(ip)
+}
+
+func localIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified()
+}
+
+// NewSecret returns a random signing secret.
+func NewSecret() (string, error) {
+	return randomHex(32)
+}
+
+// Event is something that happened in the registry. It is the JSON payload
+// of a delivery.
+type Event struct {
+	ID      string      `json:"id"`
+	Type    string      `json:"event"`
+	Time    time.Time   `json:"time"`
+	Library string      `json:"library"`
+	Version string      `json:"version,omitempty"`
+	Actor   audit.Actor `json:"actor"`
+	// Data describes the library version after the event.
+	Data interface{} `json:"data,omitempty"`
+}
+
+// NewEvent returns an event with a new ID.
+func NewEvent(typ, library, version string, actor audit.Actor, data interface{}) (Event, error) {
+	id, err := randomHex(16)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{ID: id, Type: typ, Time: time.Now().UTC(), Library: library, Version: version, Actor: actor, Data: data}, nil
+}
+
+// NewDeliveries returns a pending delivery of e for each of hooks that wants
+// it.
+func NewDeliveries(e Event, hooks []Hook) ([]Delivery, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode event: %w", err)
+	}
+
+	now := time.Now().UTC()
+	var deliveries []Delivery
+	for _, h := range hooks {
+		if !h.Matches(e.Type, e.Library) {
+			continue
+		}
+		deliveries = append(deliveries, Delivery{
+			WebhookID:   h.ID,
+			EventID:     e.ID,
+			Event:       e.Type,
+			Payload:     payload,
+			Status:      StatusPending,
+			NextAttempt: now,
+			Created:     now,
+			Updated:     now,
+		})
+	}
+	return deliveries, nil
+}
+
+// Delivery is one event sent, or to be sent, to one webhook.
+type Delivery struct {
+	ID           int64           `json:"id"`
+	WebhookID    int64           `json:"webhook_id"`
+	EventID      string          `json:"event_id"`
+	Event        string          `json:"event"`
+	Payload      json.RawMessage `json:"payload"`
+	Status       string          `json:"status"`
+	Attempts     int             `json:"attempts"`
+	ResponseCode int             `json:"response_code,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	NextAttempt  time.Time       `json:"next_attempt"`
+	Created      time.Time       `json:"created"`
+	Updated      time.Time       `json:"updated"`
+}
+
+// DeliveryFilter selects deliveries from the log. Zero fields match
+// everything.
+type DeliveryFilter struct {
+	WebhookID int64
+	Status    string
+	Limit     int
+}
+
+// Sign returns the signature header value for a payload:
+// "sha256=" followed by the hex HMAC-SHA256 of the payload with secret.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature is the signature of payload
+// with secret. Receivers use it to check that a delivery came from the
+// registry.
+func VerifySignature(secret string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, payload)), []byte(signature))
+}
+
+// Store keeps webhooks and their deliveries.
+type Store interface {
+	GetWebhook(id int64) (Hook, error)
+	DueDeliveries(now time.Time, limit int) ([]Delivery, error)
+	UpdateDelivery(d Delivery) error
+}
+
+// Dispatcher delivers the events queued in a store.
+type Dispatcher struct {
+	store  Store
+	client *http.Client
+	wake   chan struct{}
+
+	// MaxAttempts is how often a delivery is tried before it is marked
+	// failed.
+	MaxAttempts int
+	// Backoff returns the delay before the next try after a number of
+	// failed attempts.
+	Backoff func(attempts int) time.Duration
+	// PollInterval is how often stored deliveries are checked, which picks
+	// up events queued by other processes.
+	PollInterval time.Duration
+	// AllowLocal lets deliveries connect to loopback and link-local
+	// addresses. Without it, such connections are refused even when a
+	// webhook's host name only resolves to one at delivery time.
+	AllowLocal bool
+}
+
+// NewDispatcher returns a dispatcher that retries a delivery up to 8
+// times, waiting 30 seconds after the first failure and doubling the wait
+// up to an hour.
+func NewDispatcher(store Store) *Dispatcher {
+	d := &Dispatcher{
+		store:        store,
+		wake:         make(chan struct{}, 1),
+		MaxAttempts:  8,
+		Backoff:      ExponentialBackoff(30*time.Second, time.Hour),
+		PollInterval: 10 * time.Second,
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: d.checkAddress}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	d.client = &http.Client{Timeout: 10 * time.Second, Transport: transport}
+	return d
+}
+
+// checkAddress refuses connections to loopback and link-local addresses
+// unless AllowLocal is set.
+func (d *Dispatcher) checkAddress(network, address string, _ syscall.RawConn) error {
+	if d.AllowLocal {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip != nil && localIP(ip) {
+		return fmt.Errorf("refusing to deliver to loopback or link-local address %s", host)
+	}
+	return nil
+}
+
+// ExponentialBackoff waits base after the first failure and doubles the
+// wait after each further failure, up to max.
+func ExponentialBackoff(base, max time.Duration) func(int) time.Duration {
+	return func(attempts int) time.Duration {
+		d := base
+		for i := 1; i < attempts && d < max; i++ {
+			d *= 2
+		}
+		if d > max {
+			d = max
+		}
+		return d
+	}
+}
+
+// Wake makes a running dispatcher check for due deliveries now.
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers queued events until ctx is done. A delivery being sent when
+// ctx is done is finished; the rest stay queued.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+	for {
+		if err := d.deliverDue(ctx); err != nil && ctx.Err() == nil {
+			slog.Error("webhook delivery failed", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue sends every delivery whose next attempt is due.
+func (d *Dispatcher) DeliverDue() error {
+	return d.deliverDue(context.Background())
+}
+
+func (d *Dispatcher) deliverDue(ctx context.Context) error {
+	for {
+		due, err := d.store.DueDeliveries(time.Now().UTC(), 100)
+		if err != nil {
+			return err
+		}
+		if len(due) == 0 {
+			return nil
+		}
+		for _, del := range due {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if err := d.store.UpdateDelivery(d.attempt(del)); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// attempt sends a delivery once and returns it updated with the outcome.
+func (d *Dispatcher) attempt(del Delivery) Delivery {
+	now := time.Now().UTC()
+	del.Attempts++
+	del.Updated = now
+
+	hook, err := d.store.GetWebhook(del.WebhookID)
+	if err != nil {
+		del.Status, del.Error = StatusFailed, "webhook no longer exists"
+		return del
+	}
+
+	del.ResponseCode, err = d.post(hook, del)
+	if err == nil {
+		del.Status, del.Error = StatusDelivered, ""
+		return del
+	}
+
+	del.Error = err.Error()
+	if del.Attempts >= d.MaxAttempts {
+		del.Status = StatusFailed
+		slog.Warn("giving up on webhook delivery", "delivery", del.ID, "url", hook.URL, "attempts", del.Attempts, "error", err)
+		return del
+	}
+	del.NextAttempt = now.Add(d.Backoff(del.Attempts))
+	return del
+}
+
+func (d *Dispatcher) post(hook Hook, del Delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(del.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "hvr-webhook")
+	req.Header.Set(HeaderEvent, del.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(del.ID, 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, del.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
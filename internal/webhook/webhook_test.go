@@ -0,0 +1,94 @@
+package webhook
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	payload := []byte(`{"event":"library.published"}`)
+	sig := Sign("secret", payload)
+
+	if !VerifySignature("secret", payload, sig) {
+		t.Error("Expected signature to verify")
+	}
+	if VerifySignature("other", payload, sig) {
+		t.Error("Expected signature with another secret to fail")
+	}
+	if VerifySignature("secret", []byte(`{"event":"library.deleted"}`), sig) {
+		t.Error("Expected signature of another payload to fail")
+	}
+}
+
+func TestHookMatches(t *testing.T) {
+	tests := []struct {
+		hook    Hook
+		event   string
+		library string
+		want    bool
+	}{
+		{Hook{}, EventPublished, "lib-a", true},
+		{Hook{Library: "lib-a"}, EventPublished, "lib-a", true},
+		{Hook{Library: "lib-a"}, EventPublished, "lib-b", false},
+		{Hook{Events: []string{EventPublished}}, EventPublished, "lib-a", true},
+		{Hook{Events: []string{EventPublished}}, "library.deleted", "lib-a", false},
+	}
+	for _, tt := range tests {
+		if got := tt.hook.Matches(tt.event, tt.library); got != tt.want {
+			t.Errorf("%+v.Matches(%s, %s) = %v, want %v", tt.hook, tt.event, tt.library, got, tt.want)
+		}
+	}
+}
+
+func TestHookValidate(t *testing.T) {
+	if err := (&Hook{URL: "https://ci.example.com/hook", Events: []string{EventPublished}}).Validate(false); err != nil {
+		t.Errorf("Expected a valid webhook, got %v", err)
+	}
+	if err := (&Hook{URL: "ci.example.com/hook"}).Validate(false); err == nil {
+		t.Error("Expected a URL without scheme to be rejected")
+	}
+	if err := (&Hook{URL: "https://ci.example.com/hook", Events: []string{"library.deleted"}}).Validate(false); err == nil {
+		t.Error("Expected an unknown event to be rejected")
+	}
+	for _, url := range []string{
+		"http://localhost:8080/hook",
+		"http://127.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0:9000/",
+	} {
+		if err := (&Hook{URL: url}).Validate(false); err == nil {
+			t.Errorf("Expected the local URL %s to be rejected", url)
+		}
+		if err := (&Hook{URL: url}).Validate(true); err != nil {
+			t.Errorf("Expected the local URL %s to be allowed, got %v", url, err)
+		}
+	}
+}
+
+func TestDispatcherRefusesLocalAddresses(t *testing.T) {
+	d := NewDispatcher(nil)
+	if err := d.checkAddress("tcp", "127.0.0.1:80", nil); err == nil {
+		t.Error("Expected a loopback address to be refused")
+	}
+	if err := d.checkAddress("tcp", "[fe80::1]:80", nil); err == nil {
+		t.Error("Expected a link-local address to be refused")
+	}
+	if err := d.checkAddress("tcp", "192.0.2.10:443", nil); err != nil {
+		t.Errorf("Expected a public address to be allowed, got %v", err)
+	}
+	d.AllowLocal = true
+	if err := d.checkAddress("tcp", "127.0.0.1:80", nil); err != nil {
+		t.Errorf("Expected AllowLocal to allow loopback addresses, got %v", err)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	backoff := ExponentialBackoff(time.Second, 5*time.Second)
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := backoff(i + 1); got != w {
+			t.Errorf("backoff(%d) = %s, want %s", i+1, got, w)
+		}
+	}
+}
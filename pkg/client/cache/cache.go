@@ -0,0 +1,362 @@
+// Package cache keeps downloaded library archives on disk, addressed by
+// their SHA-256, together with an index of the libraries they belong to so
+// that libraries can be resolved and installed without the server.
+package cache
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/iamgp/hvr/pkg/client/state"
+)
+
+const indexName = "index.json"
+
+// ErrNotCached is returned when a library version is not in the cache.
+var ErrNotCached = errors.New("not in the cache")
+
+// Entry is a cached library version.
+type Entry struct {
+	Name         string            `json:"name"`
+	Version      string            `json:"version"`
+	Hash         string            `json:"hash"`
+	Size         int64             `json:"size"`
+	Dependencies map[string]string `json:"dependencies,omitempty"`
+	Signature    string            `json:"signature,omitempty"`
+	SigningKey   string            `json:"signing_key,omitempty"`
+	ModTime      time.Time         `json:"mod_time"`
+	CachedAt     time.Time         `json:"cached_at"`
+}
+
+// Cache is a download cache directory.
+type Cache struct {
+	dir string
+
+	mu sync.Mutex
+}
+
+// DefaultDir is the per-user cache directory.
+func DefaultDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "hvr"), nil
+}
+
+func Open(dir string) (*Cache, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "blobs"), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &Cache{dir: dir}, nil
+}
+
+// Dir returns the cache directory.
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// CreateTemp creates a temporary file inside the cache directory, from where
+// Add can move it into place.
+func (c *Cache) CreateTemp() (*os.File, error) {
+	dir := filepath.Join(c.dir, "tmp")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return os.CreateTemp(dir, "download-*")
+}
+
+// BlobPath returns where the archive with the given SHA-256 is stored.
+func (c *Cache) BlobPath(hash string) string {
+	if len(hash) < 2 {
+		return filepath.Join(c.dir, "blobs", "sha256", hash)
+	}
+	return filepath.Join(c.dir, "blobs", "sha256", hash[:2], hash)
+}
+
+// Entries returns every cached library version, sorted by name and version.
+func (c *Cache) Entries() ([]Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.load()
+}
+
+// Get returns the cached entry for name and version.
+func (c *Cache) Get(name, version string) (*Entry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if entries[i].Name == name && sameVersion(entries[i].Version, version) {
+			return &entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("%s %s: %w", name, version, ErrNotCached)
+}
+
+// Latest returns the newest cached version of name that matches constraint,
+// or any version when constraint is empty.
+func (c *Cache) Latest(name, constraint string) (*Entry, error) {
+	var check *semver.Constraints
+	if constraint != "" {
+		var err error
+		if check, err = semver.NewConstraint(constraint); err != nil {
+			return nil, fmt.Errorf("invalid version constraint for %s: %w", name, err)
+		}
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var best *Entry
+	var bestVersion *semver.Version
+	for i := range entries {
+		if entries[i].Name != name {
+			continue
+		}
+		v, err := semver.NewVersion(entries[i].Version)
+		if err != nil || (check != nil && !check.Check(v)) {
+			continue
+		}
+		if bestVersion == nil || v.GreaterThan(bestVersion) {
+			best, bestVersion = &entries[i], v
+		}
+	}
+	if best == nil {
+		if constraint == "" {
+			return nil, fmt.Errorf("%s: %w", name, ErrNotCached)
+		}
+		return nil, fmt.Errorf("%s %s: %w", name, constraint, ErrNotCached)
+	}
+	return best, nil
+}
+
+// Resolve returns the cached versions of everything entry depends on, picking
+// the newest cached version matching each constraint, as the server does.
+func (c *Cache) Resolve(entry *Entry) ([]Entry, error) {
+	resolved := make(map[string]Entry)
+	if err := c.resolve(entry, resolved, 0); err != nil {
+		return nil, err
+	}
+
+	result := make([]Entry, 0, len(resolved))
+	for _, e := range resolved {
+		result = append(result, e)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (c *Cache) resolve(entry *Entry, resolved map[string]Entry, depth int) error {
+	if depth > 100 {
+		return fmt.Errorf("dependency resolution too deep, possible circular dependency")
+	}
+	for name, constraint := range entry.Dependencies {
+		if _, ok := resolved[name]; ok {
+			continue
+		}
+		dep, err := c.Latest(name, constraint)
+		if err != nil {
+			return fmt.Errorf("no suitable version of %s: %w", name, err)
+		}
+		resolved[name] = *dep
+		if err := c.resolve(dep, resolved, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Add stores the archive at path, whose SHA-256 must be entry.Hash, and
+// records entry in the index, replacing an earlier entry for the same
+// version. The file at path is moved into the cache, so it should have been
+// created with CreateTemp.
+func (c *Cache) Add(entry Entry, path string) error {
+	hash, err := state.HashFile(path)
+	if err != nil {
+		return err
+	}
+	if hash != entry.Hash {
+		return fmt.Errorf("hash mismatch: expected %s, got %s", entry.Hash, hash)
+	}
+
+	// The blob is only moved in while holding the lock, so that another
+	// process removing unreferenced archives can't delete it before the
+	// index refers to it.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	unlock, err := c.lock()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	blob := c.BlobPath(entry.Hash)
+	if err := os.MkdirAll(filepath.Dir(blob), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(path, blob); err != nil {
+		return fmt.Errorf("failed to store archive: %w", err)
+	}
+
+	info, err := os.Stat(blob)
+	if err != nil {
+		return err
+	}
+	entry.Size = info.Size()
+	if entry.CachedAt.IsZero() {
+		entry.CachedAt = time.Now().UTC()
+	}
+
+	entries, err := c.load()
+	if err != nil {
+		return err
+	}
+	replaced := false
+	for i := range entries {
+		if entries[i].Name == entry.Name && sameVersion(entries[i].Version, entry.Version) {
+			entries[i] = entry
+			replaced = true
+		}
+	}
+	if !replaced {
+		entries = append(entries, entry)
+	}
+	return c.save(entries)
+}
+
+// Remove drops the entries for which drop returns true and deletes archives
+// no longer referenced by any entry. It returns the removed entries.
+func (c *Cache) Remove(drop func(Entry) bool) ([]Entry, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	unlock, err := c.lock()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	entries, err := c.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var kept, removed []Entry
+	for _, e := range entries {
+		if drop(e) {
+			removed = append(removed, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	if err := c.save(kept); err != nil {
+		return nil, err
+	}
+	return removed, c.removeUnreferenced(kept)
+}
+
+// Verify checks that the archive of entry is present and has the recorded
+// hash.
+func (c *Cache) Verify(entry Entry) error {
+	hash, err := state.HashFile(c.BlobPath(entry.Hash))
+	if err != nil {
+		return err
+	}
+	if hash != entry.Hash {
+		return fmt.Errorf("hash mismatch: expected %s, got %s", entry.Hash, hash)
+	}
+	return nil
+}
+
+func (c *Cache) removeUnreferenced(entries []Entry) error {
+	referenced := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		referenced[e.Hash] = true
+	}
+
+	root := filepath.Join(c.dir, "blobs", "sha256")
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || referenced[d.Name()] {
+			return nil
+		}
+		return os.Remove(path)
+	})
+}
+
+func (c *Cache) load() ([]Entry, error) {
+	data, err := os.ReadFile(filepath.Join(c.dir, indexName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("invalid cache index: %w", err)
+	}
+	return entries, nil
+}
+
+func (c *Cache) save(entries []Entry) error {
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return versionLess(entries[i].Version, entries[j].Version)
+	})
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(c.dir, indexName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(c.dir, indexName))
+}
+
+func sameVersion(a, b string) bool {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return va.Equal(vb)
+}
+
+func versionLess(a, b string) bool {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+	if errA != nil || errB != nil {
+		return a < b
+	}
+	return va.LessThan(vb)
+}
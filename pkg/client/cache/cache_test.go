@@ -0,0 +1,172 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func addArchive(t *testing.T, c *Cache, name, version, content string, deps map[string]string) Entry {
+	t.Helper()
+	tmp, err := c.CreateTemp()
+	if err != nil {
+		t.Fatalf("Failed to create temp file: %v", err)
+	}
+	tmp.WriteString(content)
+	tmp.Close()
+
+	sum := sha256.Sum256([]byte(content))
+	entry := Entry{Name: name, Version: version, Hash: hex.EncodeToString(sum[:]), Dependencies: deps}
+	if err := c.Add(entry, tmp.Name()); err != nil {
+		t.Fatalf("Failed to add %s %s: %v", name, version, err)
+	}
+	return entry
+}
+
+func TestAddAndResolve(t *testing.T) {
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+
+	addArchive(t, c, "lib-c", "1.0.0", "c1", nil)
+	addArchive(t, c, "lib-c", "1.4.0", "c14", nil)
+	addArchive(t, c, "lib-c", "2.0.0", "c2", nil)
+	addArchive(t, c, "lib-b", "1.0.0", "b1", map[string]string{"lib-c": "^1.0.0"})
+	addArchive(t, c, "lib-a", "1.0.0", "a1", map[string]string{"lib-b": "~1.0.0"})
+
+	latest, err := c.Latest("lib-c", "")
+	if err != nil || latest.Version != "2.0.0" {
+		t.Errorf("Expected lib-c 2.0.0 to be the latest, got %+v, %v", latest, err)
+	}
+
+	a, err := c.Get("lib-a", "1.0.0")
+	if err != nil {
+		t.Fatalf("Failed to get lib-a: %v", err)
+	}
+	deps, err := c.Resolve(a)
+	if err != nil {
+		t.Fatalf("Failed to resolve: %v", err)
+	}
+	if len(deps) != 2 || deps[0].Name != "lib-b" || deps[1].Name != "lib-c" || deps[1].Version != "1.4.0" {
+		t.Errorf("Unexpected resolution: %+v", deps)
+	}
+
+	if _, err := c.Get("lib-a", "2.0.0"); !errors.Is(err, ErrNotCached) {
+		t.Errorf("Expected ErrNotCached, got %v", err)
+	}
+}
+
+func TestVerifyAndRemove(t *testing.T) {
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+
+	a := addArchive(t, c, "lib-a", "1.0.0", "same", nil)
+	b := addArchive(t, c, "lib-b", "1.0.0", "same", nil)
+	if a.Hash != b.Hash {
+		t.Fatalf("Expected identical archives to share a hash")
+	}
+	if err := c.Verify(a); err != nil {
+		t.Errorf("Expected lib-a to verify, got %v", err)
+	}
+
+	if _, err := c.Remove(func(e Entry) bool { return e.Name == "lib-a" }); err != nil {
+		t.Fatalf("Failed to remove: %v", err)
+	}
+	if err := c.Verify(b); err != nil {
+		t.Errorf("Removing lib-a should keep the archive lib-b shares, got %v", err)
+	}
+
+	os.WriteFile(c.BlobPath(b.Hash), []byte("tampered"), 0644)
+	if err := c.Verify(b); err == nil {
+		t.Errorf("Expected a tampered archive to fail verification")
+	}
+
+	if _, err := c.Remove(func(Entry) bool { return true }); err != nil {
+		t.Fatalf("Failed to remove: %v", err)
+	}
+	if _, err := os.Stat(c.BlobPath(b.Hash)); !os.IsNotExist(err) {
+		t.Errorf("Expected unreferenced archives to be deleted")
+	}
+}
+
+func TestAddRejectsHashMismatch(t *testing.T) {
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+	tmp, _ := c.CreateTemp()
+	tmp.WriteString("content")
+	tmp.Close()
+
+	if err := c.Add(Entry{Name: "lib-a", Version: "1.0.0", Hash: "0000"}, tmp.Name()); err == nil {
+		t.Errorf("Expected a hash mismatch")
+	}
+}
+
+func TestAddFromSeveralProcesses(t *testing.T) {
+	dir := t.TempDir()
+
+	// Each Cache stands for a separate hvr process: they share the
+	// directory but not the in-process mutex.
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c, err := Open(dir)
+			if err != nil {
+				errs <- err
+				return
+			}
+			tmp, err := c.CreateTemp()
+			if err != nil {
+				errs <- err
+				return
+			}
+			content := fmt.Sprintf("archive %d", i)
+			tmp.WriteString(content)
+			tmp.Close()
+			sum := sha256.Sum256([]byte(content))
+			errs <- c.Add(Entry{Name: fmt.Sprintf("lib-%d", i), Version: "1.0.0", Hash: hex.EncodeToString(sum[:])}, tmp.Name())
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Failed to add: %v", err)
+		}
+	}
+
+	c, _ := Open(dir)
+	entries, err := c.Entries()
+	if err != nil || len(entries) != 20 {
+		t.Errorf("Expected all 20 entries to be kept, got %d, %v", len(entries), err)
+	}
+}
+
+func TestStaleLockIsTakenOver(t *testing.T) {
+	c, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatalf("Failed to open cache: %v", err)
+	}
+	lock := filepath.Join(c.Dir(), lockName)
+	os.WriteFile(lock, []byte("12345\n"), 0644)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(lock, old, old)
+
+	addArchive(t, c, "lib-a", "1.0.0", "a1", nil)
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Errorf("Expected the lock to be released")
+	}
+}
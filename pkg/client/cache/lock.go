@@ -0,0 +1,47 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const lockName = "index.lock"
+
+// lockTimeout is how long lock waits for another process to release the
+// cache, and staleLockAge how old a lock file must be before it is taken to
+// have been left by a process that died while holding it.
+const (
+	lockTimeout  = 30 * time.Second
+	staleLockAge = 2 * time.Minute
+)
+
+// lock takes the lock file that serializes index updates between hvr
+// processes sharing the cache, and returns the function that releases it.
+// The caller also holds c.mu.
+func (c *Cache) lock() (func(), error) {
+	path := filepath.Join(c.dir, lockName)
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to lock the cache: %w", err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > staleLockAge {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("the cache is locked by another hvr process; remove %s if none is running", path)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
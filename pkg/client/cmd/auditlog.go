@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/spf13/cobra"
+)
+
+var (
+	auditUser    string
+	auditAction  string
+	auditLibrary string
+	auditSince   string
+	auditUntil   string
+	auditLimit   int
+	auditJSON    bool
+	auditVerify  bool
+)
+
+var auditLogCmd = &cobra.Command{
+	Use:   "audit-log",
+	Short: "Show the registry's audit log",
+	Long: `Show who changed what in the registry, when and from where.
+
+Entries are shown oldest first; --limit keeps the most recent ones. Every
+entry is chained to the one before it by hash. --verify downloads the whole
+log and checks the chain, which fails if any entry was changed, removed or
+reordered.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		if auditVerify {
+			if auditUser != "" || auditAction != "" || auditLibrary != "" || auditSince != "" || auditUntil != "" {
+				return fmt.Errorf("--verify checks the whole log and cannot be combined with filters")
+			}
+			entries, err := fetchAuditLog(cfg, audit.Filter{})
+			if err != nil {
+				return err
+			}
+			if err := audit.Verify(entries, ""); err != nil {
+				return err
+			}
+			head := "(empty)"
+			if len(entries) > 0 {
+				head = entries[len(entries)-1].Hash
+			}
+			fmt.Printf("Audit log intact: %d entries, head %s\n", len(entries), head)
+			return nil
+		}
+
+		filter := audit.Filter{User: auditUser, Action: auditAction, Library: auditLibrary, Limit: auditLimit}
+		if auditSince != "" {
+			if filter.Since, err = parseSince(auditSince); err != nil {
+				return err
+			}
+		}
+		if auditUntil != "" {
+			if filter.Until, err = parseSince(auditUntil); err != nil {
+				return err
+			}
+		}
+
+		entries, err := fetchAuditLog(cfg, filter)
+		if err != nil {
+			return err
+		}
+
+		if auditJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(entries)
+		}
+		if len(entries) == 0 {
+			fmt.Println("No audit entries found")
+			return nil
+		}
+		printAuditLog(entries)
+		return nil
+	},
+}
+
+func printAuditLog(entries []audit.Entry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTIME\tUSER\tADDRESS\tACTION\tTARGET")
+	for _, e := range entries {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.Time.Local().Format("2006-01-02 15:04:05"), e.User, e.Address, e.Action, e.Target)
+	}
+	w.Flush()
+}
+
+func init() {
+	rootCmd.AddCommand(auditLogCmd)
+	auditLogCmd.Flags().StringVar(&auditUser, "user", "", "Only show changes by this user")
+	auditLogCmd.Flags().StringVar(&auditAction, "action", "", "Only show this action, e.g. library.upload")
+	auditLogCmd.Flags().StringVar(&auditLibrary, "library", "", "Only show changes to this library")
+	auditLogCmd.Flags().StringVar(&auditSince, "since", "", "Only show changes at or after this date or time")
+	auditLogCmd.Flags().StringVar(&auditUntil, "until", "", "Only show changes before this date or time")
+	auditLogCmd.Flags().IntVarP(&auditLimit, "limit", "n", 0, "Only show the most recent entries")
+	auditLogCmd.Flags().BoolVar(&auditJSON, "json", false, "Print entries as JSON, including the before and after states")
+	auditLogCmd.Flags().BoolVar(&auditVerify, "verify", false, "Check the hash chain of the whole log")
+}
@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/iamgp/hvr/internal/audit"
+)
+
+func TestFetchAuditLog(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "lib-a", "1.0.0", nil, map[string]string{"LibA.hsl": "// a\n"})
+	publishTestLibrary(t, s, "lib-b", "1.0.0", nil, map[string]string{"LibB.hsl": "// b & <b>\n"})
+
+	entries, err := fetchAuditLog(cfg, audit.Filter{})
+	if err != nil {
+		t.Fatalf("Failed to fetch audit log: %v", err)
+	}
+	if len(entries) != 2 || entries[0].Action != audit.ActionUpload || entries[0].Target != "lib-a@1.0.0" {
+		t.Fatalf("Expected 2 upload entries, got %+v", entries)
+	}
+	if err := audit.Verify(entries, ""); err != nil {
+		t.Errorf("Expected the fetched chain to verify, got %v", err)
+	}
+
+	entries, err = fetchAuditLog(cfg, audit.Filter{Library: "lib-b"})
+	if err != nil || len(entries) != 1 || entries[0].Target != "lib-b@1.0.0" {
+		t.Errorf("Expected only the lib-b entry, got %+v, %v", entries, err)
+	}
+}
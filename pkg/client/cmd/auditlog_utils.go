@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/pkg/client/config"
+)
+
+// fetchAuditLog queries the server's audit log.
+func fetchAuditLog(cfg *config.Config, filter audit.Filter) ([]audit.Entry, error) {
+	query := url.Values{}
+	for param, v := range map[string]string{"user": filter.User, "action": filter.Action, "library": filter.Library} {
+		if v != "" {
+			query.Set(param, v)
+		}
+	}
+	if !filter.Since.IsZero() {
+		query.Set("since", filter.Since.Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		query.Set("until", filter.Until.Format(time.RFC3339))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	resp, err := httpClient.Get(cfg.Endpoint("api/v1/audit", query))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to read audit log: %s: %s", resp.Status, string(body))
+	}
+
+	var entries []audit.Entry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return entries, nil
+}
@@ -0,0 +1,141 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/iamgp/hvr/pkg/client/cache"
+	"github.com/spf13/cobra"
+)
+
+var cacheVerifyRemove bool
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the local download cache",
+	Long: `Manage the local download cache.
+
+Every archive downloaded by download or install is kept in the cache
+directory (cache_dir in the config file, or the per-user cache directory),
+stored under its SHA-256. Versions already in the cache are not downloaded
+again, and with --offline libraries are resolved and installed from the cache
+alone.`,
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached library versions",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cacheFromConfig()
+		if err != nil {
+			return err
+		}
+		entries, err := c.Entries()
+		if err != nil {
+			return err
+		}
+
+		if len(entries) == 0 {
+			fmt.Printf("Cache %s is empty\n", c.Dir())
+			return nil
+		}
+
+		var total int64
+		fmt.Printf("Cached libraries in %s:\n", c.Dir())
+		for _, e := range entries {
+			total += e.Size
+			fmt.Printf("- %s %s, %d bytes, sha256 %s, cached %s\n", e.Name, e.Version, e.Size, shortHash(e.Hash), e.CachedAt.Local().Format("2006-01-02 15:04"))
+		}
+		fmt.Printf("%d versions, %d bytes\n", len(entries), total)
+		return nil
+	},
+}
+
+var cacheVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check cached archives against their SHA-256",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cacheFromConfig()
+		if err != nil {
+			return err
+		}
+		entries, err := c.Entries()
+		if err != nil {
+			return err
+		}
+
+		damaged := make(map[string]bool)
+		for _, e := range entries {
+			if err := c.Verify(e); err != nil {
+				fmt.Printf("%s %s: %v\n", e.Name, e.Version, err)
+				damaged[e.Name+"@"+e.Version] = true
+			}
+		}
+		fmt.Printf("Checked %d cached versions: %d ok, %d damaged\n", len(entries), len(entries)-len(damaged), len(damaged))
+
+		if len(damaged) == 0 {
+			return nil
+		}
+		if !cacheVerifyRemove {
+			return fmt.Errorf("%d cached archives are damaged (use --remove to drop them)", len(damaged))
+		}
+		removed, err := c.Remove(func(e cache.Entry) bool { return damaged[e.Name+"@"+e.Version] })
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Removed %d damaged versions\n", len(removed))
+		return nil
+	},
+}
+
+var cacheCleanCmd = &cobra.Command{
+	Use:   "clean [library...]",
+	Short: "Remove cached archives",
+	Long:  `Remove the cached archives of the given libraries, or of every library when none are given.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		c, err := cacheFromConfig()
+		if err != nil {
+			return err
+		}
+
+		names := make(map[string]bool, len(args))
+		for _, name := range args {
+			names[name] = true
+		}
+		removed, err := c.Remove(func(e cache.Entry) bool { return len(names) == 0 || names[e.Name] })
+		if err != nil {
+			return err
+		}
+
+		var freed int64
+		for _, e := range removed {
+			freed += e.Size
+		}
+		fmt.Printf("Removed %d cached versions (%d bytes)\n", len(removed), freed)
+		return nil
+	},
+}
+
+// shortHash abbreviates a hash for listings. The index may have been edited
+// by hand, so hashes shorter than the abbreviation are shown in full.
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func cacheFromConfig() (*cache.Cache, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+	return openCache(cfg)
+}
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd, cacheVerifyCmd, cacheCleanCmd)
+	cacheVerifyCmd.Flags().BoolVar(&cacheVerifyRemove, "remove", false, "Drop damaged archives from the cache")
+}
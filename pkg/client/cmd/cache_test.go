@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamgp/hvr/pkg/client/config"
+)
+
+func TestOfflineInstallFromCache(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "lib-b", "1.0.0", nil, map[string]string{"LibB/LibB.hsl": "// b\n"})
+	publishTestLibrary(t, s, "lib-a", "1.0.0", map[string]string{"lib-b": "^1.0.0"}, map[string]string{"LibA/LibA.hsl": "// a\n"})
+
+	// Fill the cache while online.
+	if _, err := installLibrary(cfg, filepath.Join(t.TempDir(), "HAMILTON"), "lib-a", "latest", false, false); err != nil {
+		t.Fatalf("Failed to install online: %v", err)
+	}
+
+	// Point at a server that doesn't exist; nothing may be fetched from it.
+	isolated := &config.Config{ServerURL: "http://127.0.0.1:1", CacheDir: cfg.CacheDir}
+
+	offline = true
+	defer func() { offline = false }()
+
+	root := filepath.Join(t.TempDir(), "HAMILTON")
+	installed, err := installLibrary(isolated, root, "lib-a", "latest", false, false)
+	if err != nil {
+		t.Fatalf("Failed to install offline: %v", err)
+	}
+	if installed != "1.0.0" {
+		t.Errorf("Expected 1.0.0 to be installed, got %s", installed)
+	}
+	for _, rel := range []string{"Library/LibA/LibA.hsl", "Library/LibB/LibB.hsl"} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("Expected %s to be installed: %v", rel, err)
+		}
+	}
+
+	if _, err := installLibrary(isolated, root, "lib-c", "latest", false, false); err == nil {
+		t.Errorf("Expected an uncached library to fail offline")
+	}
+}
+
+func TestCachedVersionIsNotDownloadedAgain(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "lib-a", "1.0.0", nil, map[string]string{"LibA/LibA.hsl": "// a\n"})
+
+	if _, err := downloadLibrary(cfg, "lib-a", "1.0.0", t.TempDir()); err != nil {
+		t.Fatalf("Failed to download: %v", err)
+	}
+
+	isolated := &config.Config{ServerURL: "http://127.0.0.1:1", CacheDir: cfg.CacheDir}
+	archive, err := downloadLibrary(isolated, "lib-a", "1.0.0", t.TempDir())
+	if err != nil {
+		t.Fatalf("Expected the cached copy to be used, got %v", err)
+	}
+	if _, err := os.Stat(archive.Path); err != nil {
+		t.Errorf("Expected %s to be written: %v", archive.Path, err)
+	}
+}
+
+func TestInstallReportsEveryFailedDownload(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "lib-b", "1.0.0", nil, map[string]string{"LibB/LibB.hsl": "// b\n"})
+	publishTestLibrary(t, s, "lib-c", "1.0.0", nil, map[string]string{"LibC/LibC.hsl": "// c\n"})
+	publishTestLibrary(t, s, "lib-d", "1.0.0", nil, map[string]string{"LibD/LibD.hsl": "// d\n"})
+	publishTestLibrary(t, s, "lib-a", "1.0.0", map[string]string{"lib-b": "^1.0.0", "lib-c": "^1.0.0", "lib-d": "^1.0.0"}, map[string]string{"LibA/LibA.hsl": "// a\n"})
+
+	// Fail the downloads of lib-b and lib-d.
+	upstream, _ := url.Parse(cfg.ServerURL)
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if name := r.URL.Query().Get("name"); r.URL.Path == "/download" && (name == "lib-b" || name == "lib-d") {
+			http.Error(w, "storage unavailable", http.StatusInternalServerError)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	failing := &config.Config{ServerURL: server.URL, CacheDir: cfg.CacheDir}
+
+	root := filepath.Join(t.TempDir(), "HAMILTON")
+	_, err := installLibrary(failing, root, "lib-a", "1.0.0", false, false)
+	if err == nil {
+		t.Fatalf("Expected the install to fail")
+	}
+	for _, want := range []string{"2 of 3 dependencies", "lib-b 1.0.0", "lib-d 1.0.0"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to mention %q, got: %v", want, err)
+		}
+	}
+	if strings.Contains(err.Error(), "lib-c") {
+		t.Errorf("lib-c downloaded fine and should not be reported: %v", err)
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Errorf("Nothing should be installed when a download fails")
+	}
+
+	// lib-c was still downloaded and cached.
+	c, _ := openCache(cfg)
+	if _, err := c.Get("lib-c", "1.0.0"); err != nil {
+		t.Errorf("Expected lib-c to be cached: %v", err)
+	}
+}
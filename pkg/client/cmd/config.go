@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/iamgp/hvr/internal/certs"
+	"github.com/iamgp/hvr/pkg/client/cache"
+	"github.com/iamgp/hvr/pkg/client/config"
+	"github.com/iamgp/hvr/pkg/client/signing"
+)
+
+// serverURL is the URL of the server that the client communicates with. When
+// empty the server from the config file is used.
+var serverURL string
+
+// offline makes commands use only the download cache, never the server.
+var offline bool
+
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if serverURL != "" {
+		cfg.ServerURL = serverURL
+	}
+	if httpClient, err = configClient(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// configClient returns a client using the CA bundle and client certificate
+// configured in cfg.
+func configClient(cfg *config.Config) (*http.Client, error) {
+	tlsConfig, err := certs.ClientConfig(cfg.CACert, cfg.ClientCert, cfg.ClientKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid TLS settings in config: %w", err)
+	}
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = tlsConfig
+	return newHTTPClient(base), nil
+}
+
+// openCache opens the download cache configured in cfg, or the per-user
+// cache directory.
+func openCache(cfg *config.Config) (*cache.Cache, error) {
+	dir := cfg.CacheDir
+	if dir == "" {
+		var err error
+		if dir, err = cache.DefaultDir(); err != nil {
+			return nil, fmt.Errorf("failed to find cache directory: %w", err)
+		}
+	}
+	return cache.Open(dir)
+}
+
+// reporter shows messages about a download, such as a ui.Task.
+type reporter interface {
+	Logf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+}
+
+// checkSignature applies the configured signature policy to a downloaded
+// archive. Bad signatures are always rejected; missing or untrusted ones only
+// when the policy requires a signature.
+func checkSignature(cfg *config.Config, data []byte, signature, signingKey string, report reporter) error {
+	policy, err := signing.ParsePolicy(cfg.SignaturePolicy)
+	if err != nil {
+		return err
+	}
+	if policy == signing.PolicyOff {
+		return nil
+	}
+
+	keyring := signing.NewKeyring()
+	for _, key := range cfg.TrustedKeys {
+		if err := keyring.Add(key.Name, key.PublicKey); err != nil {
+			return err
+		}
+	}
+
+	signer, err := keyring.Verify(signingKey, signature, data)
+	switch {
+	case err == nil:
+		report.Logf("Signature verified (signed by %s)", signer)
+	case errors.Is(err, signing.ErrBadSignature) || policy == signing.PolicyRequire:
+		return err
+	default:
+		report.Warnf("%v", err)
+	}
+	return nil
+}
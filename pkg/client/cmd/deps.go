@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/iamgp/hvr/pkg/client/metadata"
+	"github.com/spf13/cobra"
+)
+
+var depsCmd = &cobra.Command{
+	Use:   "deps",
+	Short: "Inspect library dependencies",
+}
+
+var depsScanCmd = &cobra.Command{
+	Use:   "scan [metadata-file]",
+	Short: "Propose dependencies from the #include directives of a library",
+	Long: `Propose dependencies from the #include directives of a library.
+
+Every HSL file listed in the metadata file is scanned for #include directives.
+Includes that the library doesn't ship itself are looked up in the registry by
+file name, and the libraries providing them are proposed as dependencies.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		metadataFile := "library_meta.json"
+		if len(args) > 0 {
+			metadataFile = args[0]
+		}
+
+		meta, err := metadata.ParseMetadataFile(metadataFile)
+		if err != nil {
+			return fmt.Errorf("failed to parse metadata file: %w", err)
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		scan, err := inferDependencies(cfg, localPaths(meta), meta.Dependencies)
+		if err != nil {
+			return err
+		}
+		printDependencyScan(scan)
+		return nil
+	},
+}
+
+// localPaths returns the paths on disk of the files of a parsed metadata
+// file.
+func localPaths(meta *metadata.Metadata) []string {
+	paths := make([]string, len(meta.Files))
+	for i, f := range meta.Files {
+		paths[i] = meta.LocalPath(f)
+	}
+	return paths
+}
+
+func init() {
+	rootCmd.AddCommand(depsCmd)
+	depsCmd.AddCommand(depsScanCmd)
+}
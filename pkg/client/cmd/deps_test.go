@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iamgp/hvr/internal/api/handlers"
+	"github.com/iamgp/hvr/internal/audit"
+	"github.com/iamgp/hvr/internal/services"
+	"github.com/iamgp/hvr/internal/storage"
+	"github.com/iamgp/hvr/pkg/client/config"
+)
+
+// newTestRegistry starts a registry server backed by a temporary database
+// and file store.
+func newTestRegistry(t *testing.T) (*services.LibraryService, *config.Config) {
+	t.Helper()
+	dir := t.TempDir()
+
+	db, err := storage.NewSQLiteDatabase(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	fileStore, err := storage.NewLocalFileStore(filepath.Join(dir, "library_files"))
+	if err != nil {
+		t.Fatalf("Failed to create file store: %v", err)
+	}
+
+	s := services.NewLibraryService(db, fileStore)
+	server := httptest.NewServer(handlers.NewRouter(s, handlers.RouterOptions{}))
+	t.Cleanup(server.Close)
+
+	return s, &config.Config{ServerURL: server.URL, CacheDir: filepath.Join(dir, "cache")}
+}
+
+func publishTestLibrary(t *testing.T, s *services.LibraryService, name, version string, deps map[string]string, files map[string]string) {
+	t.Helper()
+	buf := new(bytes.Buffer)
+	w := zip.NewWriter(buf)
+	for path, content := range files {
+		f, _ := w.Create(path)
+		f.Write([]byte(content))
+	}
+	w.Close()
+
+	if _, err := s.Upload(context.Background(), audit.Actor{User: "test"}, name, version, "", "", "", deps, buf, time.Now(), "", ""); err != nil {
+		t.Fatalf("Failed to publish %s %s: %v", name, version, err)
+	}
+}
+
+func TestInferDependencies(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "plate-utils", "1.0.0", nil, map[string]string{"PlateUtils/PlateUtils.hsl": "// v1\n"})
+	publishTestLibrary(t, s, "plate-utils", "1.2.0", nil, map[string]string{"PlateUtils/PlateUtils.hsl": "// v1.2\n"})
+	publishTestLibrary(t, s, "logging", "2.0.0", nil, map[string]string{"Logging/Logging.hsl": "// log\n"})
+
+	dir := t.TempDir()
+	main := filepath.Join(dir, "MyLib.hsl")
+	helper := filepath.Join(dir, "Helper.hs_")
+	os.WriteFile(main, []byte("#include \"Helper.hs_\"\n#include \"PlateUtils\\\\PlateUtils.hsl\"\n#include \"Logging.hsl\"\n#include \"Unknown.hsl\"\n"), 0644)
+	os.WriteFile(helper, []byte("#include \"HSLTrcLib.hsl\"\n"), 0644)
+
+	scan, err := inferDependencies(cfg, []string{main, helper}, map[string]string{"logging": "^2.0.0"})
+	if err != nil {
+		t.Fatalf("Failed to infer dependencies: %v", err)
+	}
+
+	if len(scan.Proposals) != 1 || scan.Proposals[0].Name != "plate-utils" || scan.Proposals[0].Constraint != "^1.2.0" {
+		t.Errorf("Expected plate-utils ^1.2.0 to be proposed, got %+v", scan.Proposals)
+	}
+	if len(scan.Unresolved) != 1 || scan.Unresolved[0].Line != 4 {
+		t.Errorf("Expected Unknown.hsl to be unresolved, got %+v", scan.Unresolved)
+	}
+}
@@ -0,0 +1,149 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/iamgp/hvr/internal/models"
+	"github.com/iamgp/hvr/internal/venus"
+	"github.com/iamgp/hvr/pkg/client/config"
+)
+
+// dependencyProposal is a registry library that provides files the
+// package includes.
+type dependencyProposal struct {
+	Name       string
+	Constraint string
+	Includes   []venus.Problem
+}
+
+// dependencyScan is the result of matching a package's #include directives
+// against the registry.
+type dependencyScan struct {
+	Proposals  []dependencyProposal
+	Ambiguous  []venus.Problem
+	Unresolved []venus.Problem
+}
+
+// inferDependencies finds the includes in files that the package doesn't
+// provide itself and looks up which registry libraries ship them. Libraries
+// already in declared are not proposed again.
+func inferDependencies(cfg *config.Config, files []string, declared map[string]string) (*dependencyScan, error) {
+	scan := &dependencyScan{}
+	proposals := make(map[string]*dependencyProposal)
+	resolver := venus.NewIncludeResolver(files)
+
+	for _, file := range files {
+		if !venus.IsHSLFile(file) {
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		for _, inc := range venus.ParseIncludes(content) {
+			if _, ok := resolver.Resolve(file, inc.Path); ok {
+				continue
+			}
+			site := venus.Problem{File: file, Line: inc.Line, Message: fmt.Sprintf("%q", inc.Path)}
+
+			providers, err := findProviders(cfg, inc.Path)
+			if err != nil {
+				return nil, err
+			}
+
+			switch len(providers) {
+			case 0:
+				site.Message = fmt.Sprintf("include %q not found in the registry", inc.Path)
+				scan.Unresolved = append(scan.Unresolved, site)
+			case 1:
+				p := providers[0]
+				if _, ok := declared[p.Name]; ok {
+					continue
+				}
+				if proposals[p.Name] == nil {
+					proposals[p.Name] = &dependencyProposal{Name: p.Name, Constraint: "^" + p.Version}
+				}
+				proposals[p.Name].Includes = append(proposals[p.Name].Includes, site)
+			default:
+				names := make([]string, len(providers))
+				for i, p := range providers {
+					names[i] = p.Name
+					if _, ok := declared[p.Name]; ok {
+						names = nil
+						break
+					}
+				}
+				if names == nil {
+					continue
+				}
+				site.Message = fmt.Sprintf("include %q is provided by %s", inc.Path, strings.Join(names, ", "))
+				scan.Ambiguous = append(scan.Ambiguous, site)
+			}
+		}
+	}
+
+	for _, p := range proposals {
+		scan.Proposals = append(scan.Proposals, *p)
+	}
+	sort.Slice(scan.Proposals, func(i, j int) bool { return scan.Proposals[i].Name < scan.Proposals[j].Name })
+	return scan, nil
+}
+
+func findProviders(cfg *config.Config, include string) ([]models.FileMatch, error) {
+	// Includes relative to a sibling library folder are looked up by the
+	// part below the Library directory.
+	path := venus.NormalizePath(include)
+	for strings.HasPrefix(path, "../") {
+		path = strings.TrimPrefix(path, "../")
+	}
+
+	resp, err := httpClient.Get(cfg.Endpoint("providers", url.Values{"file": {path}}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up %s: %w", include, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to look up %s: %s", include, resp.Status)
+	}
+
+	var providers []models.FileMatch
+	if err := json.NewDecoder(resp.Body).Decode(&providers); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return providers, nil
+}
+
+func printDependencyScan(scan *dependencyScan) {
+	if len(scan.Proposals) == 0 {
+		fmt.Println("No missing dependencies found")
+	} else {
+		fmt.Println("Proposed dependencies:")
+		for _, p := range scan.Proposals {
+			fmt.Printf("  %q: %q\n", p.Name, p.Constraint)
+			for _, inc := range p.Includes {
+				fmt.Printf("      included by %s\n", inc)
+			}
+		}
+	}
+
+	if len(scan.Ambiguous) > 0 {
+		fmt.Println("Ambiguous includes (declare one of the providers manually):")
+		for _, p := range scan.Ambiguous {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+	if len(scan.Unresolved) > 0 {
+		fmt.Println("Unresolved includes:")
+		for _, p := range scan.Unresolved {
+			fmt.Printf("  %s\n", p)
+		}
+	}
+}
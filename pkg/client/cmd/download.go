@@ -3,83 +3,220 @@ package cmd
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
 
+	"github.com/iamgp/hvr/pkg/client/cache"
+	"github.com/iamgp/hvr/pkg/client/config"
+	"github.com/iamgp/hvr/pkg/client/ui"
 	"github.com/spf13/cobra"
 )
 
 var outputDir string
 
-func downloadLibrary(name, version, destPath string) error {
-	url := fmt.Sprintf("http://localhost:8080/download?name=%s&version=%s", name, version)
-	fmt.Printf("Downloading from: %s\n", url)
+// downloadedArchive is a verified library archive, either in the cache or
+// copied out of it by downloadLibrary.
+type downloadedArchive struct {
+	Path         string
+	Name         string
+	Version      string
+	Hash         string
+	Dependencies map[string]string
+}
+
+// fetchLibrary returns the archive of a library version from the cache,
+// downloading it first if it isn't cached, and reports progress to task. A
+// specific version that is already cached is never downloaded again;
+// "latest" always asks the server unless offline mode is on.
+func fetchLibrary(cfg *config.Config, c *cache.Cache, name, version string, task *ui.Task) (*downloadedArchive, error) {
+	var entry *cache.Entry
+	var err error
+	switch {
+	case offline && version == "latest":
+		entry, err = c.Latest(name, "")
+	case offline || version != "latest":
+		entry, err = c.Get(name, version)
+	default:
+		err = cache.ErrNotCached
+	}
 
-	resp, err := http.Get(url)
+	if err == nil {
+		if err := c.Verify(*entry); err != nil {
+			if offline {
+				return nil, fmt.Errorf("cached copy of %s %s is damaged: %w", name, entry.Version, err)
+			}
+			task.Warnf("cached copy of %s %s is damaged, downloading it again: %v", name, entry.Version, err)
+		} else {
+			task.Logf("Using cached %s %s", entry.Name, entry.Version)
+			data, err := os.ReadFile(c.BlobPath(entry.Hash))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read cached archive: %w", err)
+			}
+			task.SetTotal(int64(len(data)))
+			task.Write(data)
+			if err := checkSignature(cfg, data, entry.Signature, entry.SigningKey, task); err != nil {
+				return nil, fmt.Errorf("signature check failed: %w", err)
+			}
+			return cachedArchive(c, entry), nil
+		}
+	} else if !errors.Is(err, cache.ErrNotCached) {
+		return nil, err
+	} else if offline {
+		return nil, fmt.Errorf("offline: %w", err)
+	}
+
+	entry, err = downloadArchive(cfg, c, name, version, task)
 	if err != nil {
-		return fmt.Errorf("failed to download: %w", err)
+		return nil, err
+	}
+	return cachedArchive(c, entry), nil
+}
+
+func cachedArchive(c *cache.Cache, entry *cache.Entry) *downloadedArchive {
+	return &downloadedArchive{
+		Path:         c.BlobPath(entry.Hash),
+		Name:         entry.Name,
+		Version:      entry.Version,
+		Hash:         entry.Hash,
+		Dependencies: entry.Dependencies,
+	}
+}
+
+// downloadArchive downloads a library from the server, verifies its hash
+// and signature and adds it to the cache.
+func downloadArchive(cfg *config.Config, c *cache.Cache, name, version string, task *ui.Task) (*cache.Entry, error) {
+	url := cfg.Endpoint("download", neturl.Values{"name": {name}, "version": {version}})
+	task.Logf("Downloading from: %s", url)
+
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("download failed with status: %s, body: %s", resp.Status, string(body))
+		return nil, fmt.Errorf("download failed with status: %s, body: %s", resp.Status, string(body))
 	}
 
-	filename := getFilenameFromHeader(resp.Header.Get("Content-Disposition"))
-	if filename == "" {
-		filename = fmt.Sprintf("%s-%s.zip", name, version)
+	entry := cache.Entry{
+		Name:       name,
+		Version:    version,
+		Signature:  resp.Header.Get("X-File-Signature"),
+		SigningKey: resp.Header.Get("X-File-Signing-Key"),
 	}
-	filePath := filepath.Join(destPath, filename)
-
-	err = os.MkdirAll(filepath.Dir(filePath), 0755)
-	if err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+	if v := resp.Header.Get("X-Library-Version"); v != "" {
+		entry.Version = v
+	}
+	if deps := resp.Header.Get("X-Library-Dependencies"); deps != "" {
+		if err := json.Unmarshal([]byte(deps), &entry.Dependencies); err != nil {
+			return nil, fmt.Errorf("invalid dependencies header: %w", err)
+		}
+	}
+	if modTime, err := strconv.ParseInt(resp.Header.Get("X-File-ModTime"), 10, 64); err == nil {
+		entry.ModTime = time.Unix(modTime, 0).UTC()
 	}
 
-	out, err := os.Create(filePath)
+	out, err := c.CreateTemp()
 	if err != nil {
-		return fmt.Errorf("failed to create file: %w", err)
+		return nil, fmt.Errorf("failed to create file: %w", err)
 	}
-	defer out.Close()
+	defer os.Remove(out.Name())
 
 	expectedHash := resp.Header.Get("X-File-Hash")
 	hasher := sha256.New()
-	teeReader := io.TeeReader(resp.Body, hasher)
+	task.SetTotal(resp.ContentLength)
 
-	n, err := io.Copy(out, teeReader)
+	_, err = io.Copy(io.MultiWriter(out, hasher, task), resp.Body)
+	out.Close()
 	if err != nil {
-		return fmt.Errorf("failed to save file: %w", err)
+		return nil, fmt.Errorf("failed to save file: %w", err)
 	}
-	fmt.Printf("Wrote %d bytes to file\n", n)
 
 	actualHash := hex.EncodeToString(hasher.Sum(nil))
 	if actualHash != expectedHash {
-		os.Remove(filePath) // Delete the file if hash doesn't match
-		return fmt.Errorf("hash mismatch: expected %s, got %s", expectedHash, actualHash)
+		return nil, fmt.Errorf("hash mismatch: expected %s, got %s", expectedHash, actualHash)
 	}
+	entry.Hash = actualHash
 
-	modTimeStr := resp.Header.Get("X-File-ModTime")
-	if modTimeStr != "" {
-		modTime, err := strconv.ParseInt(modTimeStr, 10, 64)
-		if err == nil {
-			err = os.Chtimes(filePath, time.Now(), time.Unix(modTime, 0))
-			if err != nil {
-				fmt.Printf("Warning: Failed to set modification time: %v\n", err)
-			} else {
-				fmt.Printf("Set modification time to: %s\n", time.Unix(modTime, 0))
-			}
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read downloaded file: %w", err)
+	}
+	err = checkSignature(cfg, data, entry.Signature, entry.SigningKey, task)
+	if err != nil {
+		return nil, fmt.Errorf("signature check failed: %w", err)
+	}
+
+	if err := c.Add(entry, out.Name()); err != nil {
+		return nil, fmt.Errorf("failed to cache download: %w", err)
+	}
+	return &entry, nil
+}
+
+// downloadLibrary fetches a library through the cache and copies its
+// archive to destPath.
+func downloadLibrary(cfg *config.Config, name, version, destPath string) (*downloadedArchive, error) {
+	c, err := openCache(cfg)
+	if err != nil {
+		return nil, err
+	}
+	progress := ui.NewProgress(os.Stdout)
+	task := progress.Track(name)
+	archive, err := fetchLibrary(cfg, c, name, version, task)
+	task.Done(err)
+	progress.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	filePath := filepath.Join(destPath, fmt.Sprintf("%s-%s.zip", archive.Name, archive.Version))
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	if err := copyFile(archive.Path, filePath); err != nil {
+		return nil, fmt.Errorf("failed to save file: %w", err)
+	}
+
+	entry, err := c.Get(archive.Name, archive.Version)
+	if err == nil && !entry.ModTime.IsZero() {
+		err = os.Chtimes(filePath, time.Now(), entry.ModTime)
+		if err != nil {
+			fmt.Printf("Warning: Failed to set modification time: %v\n", err)
+		} else {
+			fmt.Printf("Set modification time to: %s\n", entry.ModTime.Local())
 		}
 	}
 
 	fmt.Printf("Library downloaded and verified successfully as %s\n", filePath)
-	return nil
+	archive.Path = filePath
+	return archive, nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
 }
 
 var downloadCmd = &cobra.Command{
@@ -101,8 +238,12 @@ var downloadCmd = &cobra.Command{
 			downloadPath = outputDir
 		}
 
-		// Implement actual download logic here
-		err := downloadLibrary(name, version, downloadPath)
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		_, err = downloadLibrary(cfg, name, version, downloadPath)
 		if err != nil {
 			return fmt.Errorf("failed to download library: %w", err)
 		}
@@ -111,17 +252,6 @@ var downloadCmd = &cobra.Command{
 	},
 }
 
-func getFilenameFromHeader(header string) string {
-	if header == "" {
-		return ""
-	}
-	parts := strings.Split(header, "filename=")
-	if len(parts) != 2 {
-		return ""
-	}
-	return filepath.Base(strings.Trim(parts[1], `"`))
-}
-
 func init() {
 	rootCmd.AddCommand(downloadCmd)
 	downloadCmd.Flags().StringVarP(&outputDir, "output", "o", "", "Output directory for downloaded files")
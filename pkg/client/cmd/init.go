@@ -0,0 +1,120 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	initYes    bool
+	initOutput string
+)
+
+var initCmd = &cobra.Command{
+	Use:   "init [dir]",
+	Short: "Create a library metadata file from an existing Venus library folder",
+	Long: `Create a library metadata file from an existing Venus library folder.
+
+init guesses the library name from the main .hsl file, the author from the
+Hamilton checksum footers, proposes file patterns covering the library (without
+backups, temporary files and traces) and looks up dependencies for its
+#include directives in the registry. Every guess can be changed interactively;
+--yes accepts them all.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+
+		output := initOutput
+		if output == "" {
+			output = filepath.Join(dir, "library_meta.json")
+		}
+		if _, err := os.Stat(output); err == nil {
+			return fmt.Errorf("%s already exists", output)
+		}
+
+		scaffold, err := scaffoldMetadata(dir)
+		if err != nil {
+			return err
+		}
+		meta := &scaffold.Meta
+
+		fmt.Printf("Main library file: %s\n", scaffold.MainFile)
+		if scaffold.FooterTime != "" {
+			fmt.Printf("Last saved in Venus by %s at %s\n", meta.Author, scaffold.FooterTime)
+		}
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		paths := make([]string, len(scaffold.Files))
+		for i, f := range scaffold.Files {
+			paths[i] = filepath.Join(dir, filepath.FromSlash(f))
+		}
+		scan, err := inferDependencies(cfg, paths, nil)
+		if err != nil {
+			fmt.Printf("Warning: skipping dependency detection: %v\n", err)
+		} else {
+			meta.Dependencies = make(map[string]string)
+			for _, p := range scan.Proposals {
+				meta.Dependencies[p.Name] = p.Constraint
+			}
+			for _, p := range append(scan.Ambiguous, scan.Unresolved...) {
+				fmt.Printf("Warning: %s\n", p)
+			}
+		}
+
+		if !initYes {
+			p := &prompter{in: bufio.NewReader(cmd.InOrStdin()), out: cmd.OutOrStdout()}
+			meta.Name = p.ask("Name", meta.Name)
+			meta.Version = p.ask("Version", meta.Version)
+			meta.Description = p.ask("Description", meta.Description)
+			meta.Author = p.ask("Author", meta.Author)
+			meta.RepoURL = p.ask("Repository URL", meta.RepoURL)
+			meta.Files = strings.Fields(p.ask("Files", strings.Join(meta.Files, " ")))
+			for name, constraint := range meta.Dependencies {
+				if !p.confirm(fmt.Sprintf("Depend on %s %s?", name, constraint), true) {
+					delete(meta.Dependencies, name)
+				}
+			}
+		}
+
+		if err := writeMetadataFile(output, meta); err != nil {
+			return err
+		}
+		fmt.Printf("Wrote %s\n", output)
+		return nil
+	},
+}
+
+func writeMetadataFile(path string, meta interface{}) error {
+	var data []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yaml.Marshal(meta)
+	default:
+		data, err = json.MarshalIndent(meta, "", "  ")
+		data = append(data, '\n')
+	}
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func init() {
+	rootCmd.AddCommand(initCmd)
+	initCmd.Flags().BoolVarP(&initYes, "yes", "y", false, "Accept all proposed values without prompting")
+	initCmd.Flags().StringVarP(&initOutput, "output", "o", "", "Metadata file to write (default <dir>/library_meta.json)")
+}
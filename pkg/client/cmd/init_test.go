@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// venusFile returns body with a valid Hamilton checksum footer.
+func venusFile(body, author, time string) string {
+	prefix := fmt.Sprintf("%s// $$author=%s$$valid=0$$time=%s$$checksum=", body, author, time)
+	return fmt.Sprintf("%s%08x$$length=084$$\r\n", prefix, crc32.ChecksumIEEE([]byte(prefix)))
+}
+
+func TestScaffoldMetadata(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "PlateUtils")
+	os.MkdirAll(filepath.Join(dir, "docs"), 0755)
+	files := map[string]string{
+		"PlateUtils.hsl":     venusFile("#include \"Helper.hs_\"\n", "alice", "2024-01-10 08:00"),
+		"Helper.hs_":         venusFile("// helper\n", "bob", "2024-06-01 14:30"),
+		"PlateUtils.hsl.bak": "",
+		"run.trc":            "",
+		"docs/readme.txt":    "docs",
+	}
+	for name, content := range files {
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0644)
+	}
+
+	s, err := scaffoldMetadata(dir)
+	if err != nil {
+		t.Fatalf("Failed to scaffold: %v", err)
+	}
+
+	if s.MainFile != "PlateUtils.hsl" || s.Meta.Name != "plateutils" {
+		t.Errorf("Expected main file PlateUtils.hsl named plateutils, got %s named %s", s.MainFile, s.Meta.Name)
+	}
+	if s.Meta.Author != "bob" {
+		t.Errorf("Expected author of the newest file, got %q", s.Meta.Author)
+	}
+	wantFiles := []string{"*.hs_", "*.hsl", "docs/*.txt"}
+	if !reflect.DeepEqual(s.Meta.Files, wantFiles) {
+		t.Errorf("Expected patterns %v, got %v", wantFiles, s.Meta.Files)
+	}
+}
+
+func TestInitCommandWritesMetadata(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "logging", "2.1.0", nil, map[string]string{"Logging/Logging.hsl": "// log\n"})
+
+	dir := filepath.Join(t.TempDir(), "Mixer")
+	os.MkdirAll(dir, 0755)
+	os.WriteFile(filepath.Join(dir, "Mixer.hsl"), []byte(venusFile("#include \"Logging\\\\Logging.hsl\"\n", "carol", "2024-02-02 10:00")), 0644)
+
+	serverURL, initYes = cfg.ServerURL, true
+	defer func() { serverURL, initYes = "", false }()
+
+	if err := initCmd.RunE(initCmd, []string{dir}); err != nil {
+		t.Fatalf("init failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "library_meta.json"))
+	if err != nil {
+		t.Fatalf("Metadata file not written: %v", err)
+	}
+	var meta map[string]interface{}
+	json.Unmarshal(data, &meta)
+
+	if meta["name"] != "mixer" || meta["author"] != "carol" {
+		t.Errorf("Unexpected metadata: %s", data)
+	}
+	deps, _ := meta["dependencies"].(map[string]interface{})
+	if deps["logging"] != "^2.1.0" {
+		t.Errorf("Expected logging dependency to be inferred, got %s", data)
+	}
+}
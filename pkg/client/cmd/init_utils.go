@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/iamgp/hvr/internal/venus"
+	"github.com/iamgp/hvr/pkg/client/metadata"
+)
+
+// scaffoldExcludedExts are files found in Venus library folders that should
+// never be packaged: editor backups, temporary files and run traces.
+var scaffoldExcludedExts = map[string]bool{
+	".bak": true,
+	".tmp": true,
+	".trc": true,
+	".log": true,
+}
+
+// libraryScaffold is what init learned about a library folder.
+type libraryScaffold struct {
+	Meta     metadata.Metadata
+	MainFile string
+	// Files are the paths of the files to package, relative to the folder.
+	Files      []string
+	FooterTime string
+}
+
+// scaffoldMetadata inspects a Venus library folder and guesses its metadata.
+func scaffoldMetadata(dir string) (*libraryScaffold, error) {
+	files, err := libraryFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var hsl []string
+	for _, f := range files {
+		if strings.EqualFold(path.Ext(f), ".hsl") {
+			hsl = append(hsl, f)
+		}
+	}
+	if len(hsl) == 0 {
+		return nil, fmt.Errorf("no .hsl files found in %s", dir)
+	}
+
+	s := &libraryScaffold{Files: files}
+	s.MainFile = mainHSLFile(dir, hsl)
+	s.Meta.Name = libraryName(strings.TrimSuffix(path.Base(s.MainFile), path.Ext(s.MainFile)))
+	s.Meta.SchemaVersion = metadata.CurrentSchemaVersion
+	s.Meta.Version = "1.0.0"
+	s.Meta.Files = filePatterns(files)
+
+	// The author of the most recently saved Venus file is the best guess
+	// for who maintains the library.
+	for _, f := range files {
+		if !venus.HasFooter(f) {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(f)))
+		if err != nil {
+			return nil, err
+		}
+		footer, ok := venus.ParseFooter(content)
+		if ok && footer.Time >= s.FooterTime {
+			s.FooterTime = footer.Time
+			s.Meta.Author = footer.Author
+		}
+	}
+
+	return s, nil
+}
+
+// libraryFiles lists the files below dir that belong to the library, as
+// slash separated paths relative to dir.
+func libraryFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || scaffoldExcludedExts[strings.ToLower(filepath.Ext(p))] {
+			return nil
+		}
+		switch d.Name() {
+		case "library_meta.json", "library_meta.yaml", "library_meta.yml":
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// mainHSLFile picks the library's entry point: the .hsl named after the
+// folder, otherwise the one no other file includes.
+func mainHSLFile(dir string, hsl []string) string {
+	folder := filepath.Base(filepath.Clean(dir))
+	if abs, err := filepath.Abs(dir); err == nil {
+		folder = filepath.Base(abs)
+	}
+	for _, f := range hsl {
+		if strings.EqualFold(strings.TrimSuffix(path.Base(f), path.Ext(f)), folder) {
+			return f
+		}
+	}
+
+	included := make(map[string]bool)
+	resolver := venus.NewIncludeResolver(hsl)
+	for _, f := range hsl {
+		content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(f)))
+		if err != nil {
+			continue
+		}
+		for _, inc := range venus.ParseIncludes(content) {
+			if target, ok := resolver.Resolve(f, inc.Path); ok {
+				included[target] = true
+			}
+		}
+	}
+	for _, f := range hsl {
+		if !included[venus.NormalizePath(f)] {
+			return f
+		}
+	}
+	return hsl[0]
+}
+
+// libraryName turns a Venus file name into a valid registry name.
+func libraryName(base string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(base) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			b.WriteRune(r)
+		default:
+			b.WriteRune('-')
+		}
+	}
+	return strings.Trim(b.String(), "-._")
+}
+
+// filePatterns proposes one glob per directory and extension covering the
+// given files.
+func filePatterns(files []string) []string {
+	seen := make(map[string]bool)
+	var patterns []string
+	for _, f := range files {
+		pattern := "*" + path.Ext(f)
+		if path.Ext(f) == "" {
+			pattern = path.Base(f)
+		}
+		if dir := path.Dir(f); dir != "." {
+			pattern = dir + "/" + pattern
+		}
+		if !seen[pattern] {
+			seen[pattern] = true
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// prompter asks questions with defaults on a terminal.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (p *prompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, _ := p.in.ReadString('\n')
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def
+	}
+	return line
+}
+
+func (p *prompter) confirm(question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	answer := strings.ToLower(p.ask(fmt.Sprintf("%s (%s)", question, hint), ""))
+	if answer == "" {
+		return def
+	}
+	return answer == "y" || answer == "yes"
+}
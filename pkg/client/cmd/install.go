@@ -2,20 +2,39 @@ package cmd
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
 
 	"github.com/spf13/cobra"
 )
 
-// serverURL is the URL of the server that the client communicates with
-var serverURL string
-
-var installDir string
+var (
+	venusRoot     string
+	installDryRun bool
+	installJobs   int
+	installForce  bool
+)
 
 var installCmd = &cobra.Command{
 	Use:   "install [library] [version]",
 	Short: "Install a library",
+	Long: `Install a library and its dependencies into a Hamilton installation.
+
+Files are placed below the Venus root (--venus-root, the venus_root config
+setting, or C:\Program Files (x86)\HAMILTON on Windows) according to the
+package's install rules, then by extension: .hsl, .hs_, .smt and other library
+files go to Library, .med and .lay to Methods, and .rck, .ctr, .tml and .dck to
+Labware. Anything else goes to Library. Each file keeps its path inside the
+archive below its destination folder.
+
+Dependencies are downloaded concurrently, --jobs at a time, with a progress
+bar for each when the output is a terminal. If some downloads fail, all the
+failures are reported and nothing is installed.
+
+Files already in the installation that no package installed, and files of
+an earlier install of the package that were modified since, stop the
+install if their content differs, unless --force is given, in which case
+they are replaced.
+
+Use --dry-run to print where each file would go without installing anything.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) < 1 {
 			return fmt.Errorf("library name is required")
@@ -31,19 +50,24 @@ var installCmd = &cobra.Command{
 			return fmt.Errorf("invalid version format: %s", version)
 		}
 
-		// Create the installation directory
-		if err := os.MkdirAll(installDir, 0755); err != nil {
-			return fmt.Errorf("failed to create installation directory: %w", err)
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		root, err := venusRootDir(cfg)
+		if err != nil {
+			return err
 		}
 
-		// TODO: Implement actual installation logic here
-		// For now, just create an empty file to simulate installation
-		dummyFile := filepath.Join(installDir, fmt.Sprintf("%s-%s.txt", name, version))
-		if _, err := os.Create(dummyFile); err != nil {
-			return fmt.Errorf("failed to create dummy file: %w", err)
+		installed, err := installLibrary(cfg, root, name, version, installDryRun, installForce)
+		if err != nil {
+			return err
+		}
+		if installDryRun {
+			return nil
 		}
 
-		fmt.Printf("Library %s version %s installed successfully in %s\n", name, version, installDir)
+		fmt.Printf("Library %s version %s installed successfully in %s\n", name, installed, root)
 		return nil
 	},
 }
@@ -54,9 +78,9 @@ func isValidVersion(version string) bool {
 }
 
 func init() {
-	// Set a default value for serverURL
-	serverURL = "http://localhost:8080"  // Adjust this to your default server URL
-
 	rootCmd.AddCommand(installCmd)
-	installCmd.Flags().StringVarP(&installDir, "dir", "d", "vendor", "Installation directory")
+	installCmd.Flags().StringVar(&venusRoot, "venus-root", "", "Hamilton installation root (overrides the config file)")
+	installCmd.Flags().BoolVar(&installDryRun, "dry-run", false, "Print where each file would be installed and exit")
+	installCmd.Flags().IntVarP(&installJobs, "jobs", "j", 4, "Number of dependencies to download at the same time")
+	installCmd.Flags().BoolVarP(&installForce, "force", "f", false, "Replace existing files that no package installed or that were modified")
 }
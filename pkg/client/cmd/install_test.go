@@ -2,89 +2,115 @@ package cmd
 
 import (
 	"bytes"
-	"io/ioutil"
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/iamgp/hvr/pkg/client/layout"
+	"github.com/iamgp/hvr/pkg/client/pack"
 	"github.com/spf13/cobra"
 )
 
-func TestInstallCommand(t *testing.T) {
-	// Create a temporary directory for the test
-	tempDir, err := ioutil.TempDir("", "hvr-test")
+func testManifest(t *testing.T, rules ...layout.Rule) string {
+	t.Helper()
+	data, err := json.Marshal(pack.Manifest{Install: rules})
 	if err != nil {
-		t.Fatalf("Failed to create temp dir: %v", err)
+		t.Fatalf("Failed to encode manifest: %v", err)
 	}
-	defer os.RemoveAll(tempDir)
-
-	// Change to the temp directory
-	oldWd, _ := os.Getwd()
-	os.Chdir(tempDir)
-	defer os.Chdir(oldWd)
-
-	// Run the install command
-	cmd := installCmd
-	cmd.SetArgs([]string{"test-lib", "1.0.0", "--dir", "vendor"})
-
-	// Capture output
-	output := new(bytes.Buffer)
-	cmd.SetOut(output)
-	cmd.SetErr(output)
+	return string(data)
+}
 
-	err = cmd.Execute()
+func TestInstallLibraryLayout(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "plate-utils", "1.0.0", nil, map[string]string{
+		"PlateUtils/PlateUtils.hsl": "// plate utils\n",
+		"PlateUtils/Plate.rck":      "rack\n",
+	})
+	publishTestLibrary(t, s, "my-lib", "1.0.0", map[string]string{"plate-utils": "^1.0.0"}, map[string]string{
+		"MyLib/MyLib.hsl":  "#include \"PlateUtils\\\\PlateUtils.hsl\"\n",
+		"MyLib/Demo.med":   "method\n",
+		"labware/Tips.rck": "rack\n",
+		"README.txt":       "readme\n",
+		pack.ManifestName:  testManifest(t, layout.Rule{Pattern: "*.rck", Dest: "Labware/MyVendor", Strip: "labware"}),
+	})
+
+	root := filepath.Join(t.TempDir(), "HAMILTON")
+	installed, err := installLibrary(cfg, root, "my-lib", "latest", false, false)
 	if err != nil {
-		t.Fatalf("Install command failed: %v", err)
+		t.Fatalf("Failed to install: %v", err)
 	}
-
-	// Check if the vendor directory was created
-	vendorDir := filepath.Join(tempDir, "vendor")
-	if _, err := os.Stat(vendorDir); os.IsNotExist(err) {
-		t.Errorf("Vendor directory was not created")
+	if installed != "1.0.0" {
+		t.Errorf("Expected version 1.0.0 to be installed, got %s", installed)
 	}
 
-	// Check if the dummy file was created
-	dummyFile := filepath.Join(vendorDir, "test-lib-1.0.0.txt")
-	if _, err := os.Stat(dummyFile); os.IsNotExist(err) {
-		t.Errorf("Dummy file was not created")
+	for _, rel := range []string{
+		"Library/PlateUtils/PlateUtils.hsl",
+		"Labware/PlateUtils/Plate.rck",
+		"Library/MyLib/MyLib.hsl",
+		"Methods/MyLib/Demo.med",
+		"Labware/MyVendor/Tips.rck",
+		"Library/README.txt",
+	} {
+		if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel))); err != nil {
+			t.Errorf("Expected %s to be installed: %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "Library", pack.ManifestName)); !os.IsNotExist(err) {
+		t.Errorf("Manifest should not be installed")
 	}
+}
+
+func TestInstallDryRun(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "my-lib", "1.0.0", nil, map[string]string{"MyLib/MyLib.hsl": "// lib\n"})
 
-	// Check the output
-	expectedOutput := "Library test-lib version 1.0.0 installed successfully in vendor\n"
-	if output.String() != expectedOutput {
-		t.Errorf("Unexpected output.\nExpected: %q\nGot: %q", expectedOutput, output.String())
+	root := filepath.Join(t.TempDir(), "HAMILTON")
+	if _, err := installLibrary(cfg, root, "my-lib", "1.0.0", true, false); err != nil {
+		t.Fatalf("Failed to plan install: %v", err)
+	}
+	if _, err := os.Stat(root); !os.IsNotExist(err) {
+		t.Errorf("Dry run should not create %s", root)
 	}
 }
 
 func TestInstallCmd(t *testing.T) {
-	// Setup temporary directory
-	tempDir, err := os.MkdirTemp("", "hvr-install-test")
-	if err != nil {
-		t.Fatalf("Failed to create temp directory: %v", err)
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "test-lib", "1.0.0", nil, map[string]string{"TestLib/TestLib.hsl": "// lib\n"})
+
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	data, _ := json.Marshal(map[string]string{"cache_dir": cfg.CacheDir})
+	if err := os.WriteFile(configPath, data, 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
 	}
-	defer os.RemoveAll(tempDir)
+	t.Setenv("HVR_CONFIG", configPath)
+	oldServerURL := serverURL
+	serverURL = cfg.ServerURL
+	defer func() { serverURL = oldServerURL }()
+
+	root := filepath.Join(t.TempDir(), "HAMILTON")
 
 	tests := []struct {
-		name     string
-		args     []string
-		wantErr  bool
-		errMsg   string
-		checkFn  func(*testing.T, string)
+		name    string
+		args    []string
+		wantErr bool
+		errMsg  string
+		checkFn func(*testing.T, string)
 	}{
 		{
 			name:    "Install Success",
-			args:    []string{"test-lib", "1.0.0", "--dir", tempDir},
+			args:    []string{"test-lib", "1.0.0", "--venus-root", root},
 			wantErr: false,
 			checkFn: func(t *testing.T, dir string) {
-				if _, err := os.Stat(filepath.Join(dir, "test-lib-1.0.0.txt")); os.IsNotExist(err) {
+				if _, err := os.Stat(filepath.Join(dir, "Library", "TestLib", "TestLib.hsl")); os.IsNotExist(err) {
 					t.Errorf("Installed library not found")
 				}
 			},
 		},
 		{
 			name:    "Install Failure - Invalid Version",
-			args:    []string{"test-lib", "", "--dir", tempDir},
+			args:    []string{"test-lib", "", "--venus-root", root},
 			wantErr: true,
 			errMsg:  "invalid version format: ",
 		},
@@ -116,7 +142,7 @@ func TestInstallCmd(t *testing.T) {
 			}
 
 			if tt.checkFn != nil {
-				tt.checkFn(t, tempDir)
+				tt.checkFn(t, root)
 			}
 
 			// Check output for help text only if we don't expect an error
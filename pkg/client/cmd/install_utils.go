@@ -0,0 +1,397 @@
+package cmd
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/iamgp/hvr/internal/models"
+	"github.com/iamgp/hvr/pkg/client/cache"
+	"github.com/iamgp/hvr/pkg/client/config"
+	"github.com/iamgp/hvr/pkg/client/layout"
+	"github.com/iamgp/hvr/pkg/client/pack"
+	"github.com/iamgp/hvr/pkg/client/state"
+	"github.com/iamgp/hvr/pkg/client/txn"
+	"github.com/iamgp/hvr/pkg/client/ui"
+)
+
+// venusRootDir returns the Hamilton installation root: the --venus-root flag,
+// the config file, or the standard location on Windows.
+func venusRootDir(cfg *config.Config) (string, error) {
+	switch {
+	case venusRoot != "":
+		return venusRoot, nil
+	case cfg.VenusRoot != "":
+		return cfg.VenusRoot, nil
+	case runtime.GOOS == "windows":
+		return layout.DefaultRoot, nil
+	}
+	return "", fmt.Errorf("no Venus root configured; pass --venus-root or set venus_root in %s", configPathHint())
+}
+
+func configPathHint() string {
+	if path, err := config.Path(); err == nil {
+		return path
+	}
+	return "the config file"
+}
+
+// installLibrary downloads a library and everything it depends on and
+// installs them below root, dependencies first, recording every file written
+// in the install state. All files are staged and verified in one transaction
+// before any of them is moved into place, so a failure leaves root as it
+// was. Existing files no package installed are only overwritten with force.
+// It returns the installed version of the library.
+func installLibrary(cfg *config.Config, root, name, version string, dryRun, force bool) (string, error) {
+	st, err := state.Load(root)
+	if err != nil {
+		return "", fmt.Errorf("failed to read install state: %w", err)
+	}
+
+	c, err := openCache(cfg)
+	if err != nil {
+		return "", err
+	}
+
+	archives, err := fetchInstallSet(cfg, c, name, version)
+	if err != nil {
+		return "", err
+	}
+	archive := archives[len(archives)-1]
+
+	if dryRun {
+		for _, a := range archives {
+			if err := installArchive(nil, st, a, root, false); err != nil {
+				return "", fmt.Errorf("failed to install %s %s: %w", a.Name, a.Version, err)
+			}
+		}
+		return archive.Version, nil
+	}
+
+	tx, err := txn.Begin(root, fmt.Sprintf("install %s %s", archive.Name, archive.Version))
+	if err != nil {
+		return "", err
+	}
+	defer tx.Abort()
+
+	for _, a := range archives {
+		if err := installArchive(tx, st, a, root, force); err != nil {
+			return "", fmt.Errorf("failed to install %s %s: %w", a.Name, a.Version, err)
+		}
+	}
+	if err := commitState(tx, st); err != nil {
+		return "", err
+	}
+
+	for _, a := range archives {
+		fmt.Printf("Installed %s %s\n", a.Name, a.Version)
+	}
+	return archive.Version, nil
+}
+
+// commitState stages the updated install state and commits the transaction.
+func commitState(tx *txn.Transaction, st *state.State) error {
+	data, err := st.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := tx.Write(state.RelPath, data); err != nil {
+		return fmt.Errorf("failed to stage install state: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to apply changes, previous files were restored: %w", err)
+	}
+	return nil
+}
+
+// fetchInstallSet fetches a library and, once its version is known, all its
+// dependencies concurrently, showing the progress of each. The library
+// itself comes last in the result.
+func fetchInstallSet(cfg *config.Config, c *cache.Cache, name, version string) ([]*downloadedArchive, error) {
+	progress := ui.NewProgress(os.Stdout)
+	defer progress.Wait()
+
+	task := progress.Track(name)
+	archive, err := fetchLibrary(cfg, c, name, version, task)
+	task.Done(err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", name, err)
+	}
+
+	dependencies, err := resolveLibrary(cfg, c, archive.Name, archive.Version)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(dependencies, func(i, j int) bool { return dependencies[i].Name < dependencies[j].Name })
+
+	archives, err := fetchLibraries(cfg, c, progress, dependencies, installJobs)
+	if err != nil {
+		return nil, err
+	}
+	return append(archives, archive), nil
+}
+
+// fetchLibraries fetches libraries with a pool of at most jobs concurrent
+// downloads. A failure doesn't stop the other downloads; every failure is
+// reported together once they are all done.
+func fetchLibraries(cfg *config.Config, c *cache.Cache, progress *ui.Progress, libraries []models.Library, jobs int) ([]*downloadedArchive, error) {
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	archives := make([]*downloadedArchive, len(libraries))
+	errs := make([]error, len(libraries))
+	tasks := make([]*ui.Task, len(libraries))
+	for i, lib := range libraries {
+		tasks[i] = progress.Track(lib.Name)
+	}
+
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs && w < len(libraries); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				lib := libraries[i]
+				archive, err := fetchLibrary(cfg, c, lib.Name, lib.Version.String(), tasks[i])
+				tasks[i].Done(err)
+				if err != nil {
+					errs[i] = fmt.Errorf("%s %s: %w", lib.Name, lib.Version, err)
+					continue
+				}
+				archives[i] = archive
+			}
+		}()
+	}
+	for i := range libraries {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	var failed []error
+	for _, err := range errs {
+		if err != nil {
+			failed = append(failed, err)
+		}
+	}
+	if len(failed) > 0 {
+		return nil, fmt.Errorf("failed to download %d of %d dependencies:\n%w", len(failed), len(libraries), errors.Join(failed...))
+	}
+	return archives, nil
+}
+
+// archiveEntry is an archive file read into memory before it is installed.
+type archiveEntry struct {
+	data []byte
+	hash string
+}
+
+// installArchive stages the files of a library archive in tx, placed below
+// root following the package's install rules and the default layout, and
+// records the package in st. Files another package already installed with
+// different content are a conflict, and so are different files that no
+// package installed, unless force is set. Files of an earlier install of the
+// package that the new version no longer contains are deleted. With a nil tx
+// it only prints where each file would go.
+func installArchive(tx *txn.Transaction, st *state.State, archive *downloadedArchive, root string, force bool) error {
+	zr, err := zip.OpenReader(archive.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer zr.Close()
+
+	manifest, err := pack.ReadManifest(&zr.Reader)
+	if err != nil {
+		return err
+	}
+	var rules []layout.Rule
+	if manifest != nil {
+		for _, rule := range manifest.Install {
+			if err := rule.Validate(); err != nil {
+				return fmt.Errorf("invalid install rule %q: %w", rule.Pattern, err)
+			}
+		}
+		rules = manifest.Install
+	}
+
+	entries := make(map[string]*zip.File)
+	var files []string
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || f.Name == pack.ManifestName {
+			continue
+		}
+		name := strings.TrimPrefix(f.Name, "./")
+		entries[name] = f
+		files = append(files, name)
+	}
+
+	placements, err := layout.New(root, rules).Plan(files)
+	if err != nil {
+		return err
+	}
+
+	if tx == nil {
+		for _, p := range placements {
+			fmt.Printf("%s/%s -> %s\n", archive.Name, p.Source, p.Target)
+		}
+		return nil
+	}
+
+	previous := st.Find(archive.Name)
+	contents := make(map[string]archiveEntry, len(placements))
+	var unowned, edited []string
+	for _, p := range placements {
+		entry, err := readArchiveEntry(entries[p.Source])
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", p.Source, err)
+		}
+		rel := rootRelative(root, p.Target)
+		owners := st.Owners(rel, archive.Name)
+		for _, owner := range owners {
+			if owner.File(rel).SHA256 != entry.hash {
+				return fmt.Errorf("%s conflicts with the file installed by %s %s", rel, owner.Name, owner.Version)
+			}
+		}
+		if !force && len(owners) == 0 {
+			var installed *state.File
+			if previous != nil {
+				installed = previous.File(rel)
+			}
+			differs, err := differsFrom(p.Target, entry.hash)
+			if err == nil && differs && installed != nil {
+				differs, err = installed.Modified(root)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to check %s: %w", rel, err)
+			}
+			switch {
+			case differs && installed == nil:
+				unowned = append(unowned, rel)
+			case differs:
+				edited = append(edited, rel)
+			}
+		}
+		contents[p.Target] = entry
+	}
+	if len(unowned) > 0 {
+		return fmt.Errorf("files not installed by hvr would be overwritten (use --force to replace them):\n  %s", strings.Join(unowned, "\n  "))
+	}
+	if len(edited) > 0 {
+		return fmt.Errorf("files modified since they were installed would be overwritten (use --force to replace them):\n  %s", strings.Join(edited, "\n  "))
+	}
+
+	pkg := state.Package{
+		Name:        archive.Name,
+		Version:     archive.Version,
+		Hash:        archive.Hash,
+		InstalledAt: time.Now().UTC(),
+	}
+	for _, p := range placements {
+		entry := contents[p.Target]
+		rel := rootRelative(root, p.Target)
+		if err := tx.Write(rel, entry.data); err != nil {
+			return fmt.Errorf("failed to stage %s: %w", p.Source, err)
+		}
+		pkg.Files = append(pkg.Files, state.File{
+			Path:   rel,
+			Size:   int64(len(entry.data)),
+			SHA256: entry.hash,
+		})
+	}
+
+	if previous != nil {
+		var stale []state.File
+		for _, f := range previous.Files {
+			if pkg.File(f.Path) == nil {
+				stale = append(stale, f)
+			}
+		}
+		removeFiles(tx, st, root, previous, stale)
+	}
+
+	st.Put(pkg)
+	return nil
+}
+
+// differsFrom reports whether something other than a regular file with the
+// given hash exists at path. A missing path doesn't differ.
+func differsFrom(path, hash string) (bool, error) {
+	info, err := os.Lstat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if !info.Mode().IsRegular() {
+		return true, nil
+	}
+	existing, err := state.HashFile(path)
+	if err != nil {
+		return false, err
+	}
+	return existing != hash, nil
+}
+
+func readArchiveEntry(f *zip.File) (archiveEntry, error) {
+	src, err := f.Open()
+	if err != nil {
+		return archiveEntry{}, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return archiveEntry{}, err
+	}
+	sum := sha256.Sum256(data)
+	return archiveEntry{data: data, hash: hex.EncodeToString(sum[:])}, nil
+}
+
+// rootRelative returns target as a slash separated path relative to root,
+// the form files are recorded in the install state.
+func rootRelative(root, target string) string {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return filepath.ToSlash(target)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// removeFiles stages the deletion of files installed by pkg. Files another
+// package also owns and files modified since they were installed are kept.
+// It returns the number of files to be deleted.
+func removeFiles(tx *txn.Transaction, st *state.State, root string, pkg *state.Package, files []state.File) int {
+	removed := 0
+	for _, f := range files {
+		if owners := st.Owners(f.Path, pkg.Name); len(owners) > 0 {
+			fmt.Printf("Keeping %s, also installed by %s\n", f.Path, owners[0].Name)
+			continue
+		}
+		modified, err := f.Modified(root)
+		if err != nil {
+			fmt.Printf("Warning: failed to check %s: %v\n", f.Path, err)
+			continue
+		}
+		if modified {
+			fmt.Printf("Keeping %s, modified since it was installed\n", f.Path)
+			continue
+		}
+
+		tx.Delete(f.Path)
+		removed++
+	}
+	return removed
+}
@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/iamgp/hvr/pkg/client/signing"
+	"github.com/spf13/cobra"
+)
+
+var keygenCmd = &cobra.Command{
+	Use:   "keygen [name]",
+	Short: "Generate an ed25519 key pair for signing libraries",
+	Long: `Generate an ed25519 key pair for signing libraries.
+
+The private key is written to <name>.key and the public key to <name>.pub.
+Give the public key to consumers so they can add it to trusted_keys in their
+config, and sign uploads with 'hvr upload --sign --key <name>.key'.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		base := "hvr"
+		if len(args) > 0 {
+			base = args[0]
+		}
+
+		if _, err := os.Stat(base + ".key"); err == nil {
+			return fmt.Errorf("%s.key already exists", base)
+		}
+
+		pub, priv, err := signing.GenerateKey()
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+		if err := signing.WriteKeyPair(base, pub, priv); err != nil {
+			return fmt.Errorf("failed to write key pair: %w", err)
+		}
+
+		fmt.Printf("Private key written to %s.key\n", base)
+		fmt.Printf("Public key written to %s.pub (key id %s)\n", base, signing.KeyID(pub))
+		fmt.Printf("Public key: %s\n", signing.EncodePublicKey(pub))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(keygenCmd)
+}
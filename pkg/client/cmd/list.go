@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/iamgp/hvr/pkg/client/state"
+	"github.com/spf13/cobra"
+)
+
+var listFiles bool
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the libraries installed in the Venus root",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		root, err := venusRootDir(cfg)
+		if err != nil {
+			return err
+		}
+
+		st, err := state.Load(root)
+		if err != nil {
+			return fmt.Errorf("failed to read install state: %w", err)
+		}
+
+		if len(st.Packages) == 0 {
+			fmt.Printf("No libraries installed in %s\n", root)
+			return nil
+		}
+
+		fmt.Printf("Libraries installed in %s:\n", root)
+		for _, pkg := range st.Packages {
+			fmt.Printf("- %s (%s), %d files, installed %s\n", pkg.Name, pkg.Version, len(pkg.Files), pkg.InstalledAt.Local().Format("2006-01-02 15:04"))
+			if listFiles {
+				for _, f := range pkg.Files {
+					fmt.Printf("    %s\n", f.Path)
+				}
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().StringVar(&venusRoot, "venus-root", "", "Hamilton installation root (overrides the config file)")
+	listCmd.Flags().BoolVar(&listFiles, "files", false, "Also list the files of each library")
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/iamgp/hvr/pkg/client/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	mirrorFrom    string
+	mirrorTo      string
+	mirrorFilters []string
+	mirrorSince   string
+)
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror --from <registry> --to <registry>",
+	Short: "Copy library versions from one registry to another",
+	Long: `Copy library versions, with their metadata, hashes and signatures, from
+one registry to another.
+
+Versions already on the target are skipped once their hash has been checked
+against the source. Every copied archive is verified against the source hash
+after downloading and again after the target has stored it. Dependencies are
+copied before the libraries that need them, and an interrupted mirror carries
+on where it stopped when run again.
+
+--filter selects libraries by name with a glob pattern and may be repeated.
+--since selects versions published on the source at or after a date
+(2006-01-02) or time (RFC 3339).`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var since time.Time
+		if mirrorSince != "" {
+			var err error
+			since, err = parseSince(mirrorSince)
+			if err != nil {
+				return err
+			}
+		}
+
+		// Only the TLS settings of the config apply to a mirror.
+		if _, err := loadConfig(); err != nil {
+			return err
+		}
+		from := &config.Config{ServerURL: mirrorFrom}
+		to := &config.Config{ServerURL: mirrorTo}
+		return mirrorRegistry(from, to, mirrorFilters, since)
+	},
+}
+
+// parseSince parses a date or an RFC 3339 time. Dates are midnight local
+// time.
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --since %q, expected a date (2006-01-02) or RFC 3339 time", s)
+	}
+	return t, nil
+}
+
+func init() {
+	rootCmd.AddCommand(mirrorCmd)
+	mirrorCmd.Flags().StringVar(&mirrorFrom, "from", "", "URL of the registry to copy from")
+	mirrorCmd.Flags().StringVar(&mirrorTo, "to", "", "URL of the registry to copy to")
+	mirrorCmd.Flags().StringArrayVar(&mirrorFilters, "filter", nil, "Only copy libraries whose name matches this glob pattern")
+	mirrorCmd.Flags().StringVar(&mirrorSince, "since", "", "Only copy versions published at or after this date or time")
+	mirrorCmd.MarkFlagRequired("from")
+	mirrorCmd.MarkFlagRequired("to")
+}
@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMirrorRegistry(t *testing.T) {
+	source, from := newTestRegistry(t)
+	target, to := newTestRegistry(t)
+
+	// lib-a sorts before its dependency, so it is only accepted by the
+	// target if lib-b is copied first.
+	publishTestLibrary(t, source, "lib-b", "1.0.0", nil, map[string]string{"LibB.hsl": "// b\n"})
+	publishTestLibrary(t, source, "lib-a", "1.0.0", map[string]string{"lib-b": "^1.0.0"}, map[string]string{"LibA.hsl": "#include \"LibB.hsl\"\n"})
+	publishTestLibrary(t, source, "other", "2.0.0", nil, map[string]string{"Other.hsl": "// other\n"})
+
+	// A version copied before an interrupted run is skipped.
+	publishTestLibrary(t, target, "lib-b", "1.0.0", nil, map[string]string{"LibB.hsl": "// b\n"})
+
+	if err := mirrorRegistry(from, to, []string{"lib-*"}, time.Time{}); err != nil {
+		t.Fatalf("Failed to mirror: %v", err)
+	}
+
+	for _, v := range []string{"lib-a", "lib-b"} {
+		src, _, _ := libraryInfo(from, v, "1.0.0")
+		dst, found, err := libraryInfo(to, v, "1.0.0")
+		if err != nil || !found {
+			t.Fatalf("Expected %s to be mirrored: %v", v, err)
+		}
+		if dst.Hash != src.Hash {
+			t.Errorf("Expected %s hash %s on the target, got %s", v, src.Hash, dst.Hash)
+		}
+	}
+	if a, _, _ := libraryInfo(to, "lib-a", "1.0.0"); a.Dependencies["lib-b"] != "^1.0.0" {
+		t.Errorf("Expected dependencies to be copied, got %v", a.Dependencies)
+	}
+	if _, found, _ := libraryInfo(to, "other", "2.0.0"); found {
+		t.Errorf("Expected other to be excluded by the filter")
+	}
+
+	// Running again copies nothing.
+	if err := mirrorRegistry(from, to, nil, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to mirror with --since: %v", err)
+	}
+	if _, found, _ := libraryInfo(to, "other", "2.0.0"); found {
+		t.Errorf("Expected --since to exclude older versions")
+	}
+	if err := mirrorRegistry(from, to, nil, time.Time{}); err != nil {
+		t.Fatalf("Failed to mirror everything: %v", err)
+	}
+	if _, found, _ := libraryInfo(to, "other", "2.0.0"); !found {
+		t.Errorf("Expected other to be mirrored")
+	}
+}
+
+func TestMirrorReportsHashMismatch(t *testing.T) {
+	source, from := newTestRegistry(t)
+	target, to := newTestRegistry(t)
+
+	publishTestLibrary(t, source, "lib-a", "1.0.0", nil, map[string]string{"LibA.hsl": "// source\n"})
+	publishTestLibrary(t, source, "lib-b", "1.0.0", nil, map[string]string{"LibB.hsl": "// b\n"})
+	publishTestLibrary(t, target, "lib-a", "1.0.0", nil, map[string]string{"LibA.hsl": "// target\n"})
+
+	err := mirrorRegistry(from, to, nil, time.Time{})
+	if err == nil || !strings.Contains(err.Error(), "lib-a 1.0.0: target already has this version with hash") {
+		t.Fatalf("Expected a hash mismatch for lib-a, got %v", err)
+	}
+	if _, found, _ := libraryInfo(to, "lib-b", "1.0.0"); !found {
+		t.Errorf("Expected lib-b to be mirrored despite the lib-a failure")
+	}
+}
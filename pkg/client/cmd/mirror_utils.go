@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/iamgp/hvr/internal/models"
+	"github.com/iamgp/hvr/pkg/client/config"
+)
+
+// mirrorRegistry copies the library versions selected by filters and since
+// from one registry to another, dependencies first. Versions that fail are
+// reported together once the others have been copied.
+func mirrorRegistry(from, to *config.Config, filters []string, since time.Time) error {
+	for _, f := range filters {
+		if _, err := path.Match(f, ""); err != nil {
+			return fmt.Errorf("invalid filter %q: %w", f, err)
+		}
+	}
+
+	libraries, err := listLibraries(from, since)
+	if err != nil {
+		return err
+	}
+
+	var selected []models.Library
+	for _, lib := range libraries {
+		if matchesFilters(lib.Name, filters) {
+			selected = append(selected, lib)
+		}
+	}
+	if len(selected) == 0 {
+		fmt.Println("No library versions to mirror")
+		return nil
+	}
+
+	var copied, skipped int
+	var errs []error
+	for _, lib := range mirrorOrder(selected) {
+		done, err := mirrorLibrary(from, to, lib)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Errorf("%s %s: %w", lib.Name, lib.Version, err))
+		case done:
+			copied++
+			fmt.Printf("Copied %s %s\n", lib.Name, lib.Version)
+		default:
+			skipped++
+		}
+	}
+
+	fmt.Printf("%d copied, %d already present\n", copied, skipped)
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to mirror %d of %d library versions:\n%w", len(errs), len(selected), errors.Join(errs...))
+	}
+	return nil
+}
+
+func matchesFilters(name string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, f := range filters {
+		if ok, _ := path.Match(f, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// mirrorOrder sorts library versions so that every library comes after the
+// libraries it depends on, and the versions of a library oldest first.
+// Libraries in a dependency cycle keep their name order.
+func mirrorOrder(libraries []models.Library) []models.Library {
+	byName := make(map[string][]models.Library)
+	for _, lib := range libraries {
+		byName[lib.Name] = append(byName[lib.Name], lib)
+	}
+	names := make([]string, 0, len(byName))
+	for name, versions := range byName {
+		names = append(names, name)
+		sort.Slice(versions, func(i, j int) bool { return versions[i].Version.LessThan(versions[j].Version) })
+	}
+	sort.Strings(names)
+
+	var ordered []models.Library
+	state := make(map[string]int) // 1 while visiting, 2 when done
+	var visit func(name string)
+	visit = func(name string) {
+		if state[name] != 0 {
+			return
+		}
+		state[name] = 1
+
+		var deps []string
+		for _, lib := range byName[name] {
+			for dep := range lib.Dependencies {
+				if _, ok := byName[dep]; ok {
+					deps = append(deps, dep)
+				}
+			}
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			visit(dep)
+		}
+
+		state[name] = 2
+		ordered = append(ordered, byName[name]...)
+	}
+	for _, name := range names {
+		visit(name)
+	}
+	return ordered
+}
+
+// mirrorLibrary copies one library version unless the target already has
+// it, and reports whether it was copied.
+func mirrorLibrary(from, to *config.Config, lib models.Library) (bool, error) {
+	existing, found, err := libraryInfo(to, lib.Name, lib.Version.String())
+	if err != nil {
+		return false, err
+	}
+	if found {
+		if existing.Hash != lib.Hash {
+			return false, fmt.Errorf("target already has this version with hash %s, source has %s", existing.Hash, lib.Hash)
+		}
+		return false, nil
+	}
+
+	content, modTime, err := fetchArchive(from, lib)
+	if err != nil {
+		return false, err
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, err := writer.CreateFormFile("file", fmt.Sprintf("%s-%s.zip", lib.Name, lib.Version))
+	if err != nil {
+		return false, fmt.Errorf("failed to create form file: %w", err)
+	}
+	part.Write(content)
+
+	dependenciesJSON, err := json.Marshal(lib.Dependencies)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal dependencies: %w", err)
+	}
+	writer.WriteField("name", lib.Name)
+	writer.WriteField("version", lib.Version.String())
+	writer.WriteField("description", lib.Description)
+	writer.WriteField("author", lib.Author)
+	writer.WriteField("repoURL", lib.RepoURL)
+	writer.WriteField("dependencies", string(dependenciesJSON))
+	writer.WriteField("signature", lib.Signature)
+	writer.WriteField("signingKey", lib.SigningKey)
+	writer.WriteField("modTime", fmt.Sprintf("%d", modTime.Unix()))
+	if err := writer.Close(); err != nil {
+		return false, fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	if _, err := sendUpload(to, body, writer.FormDataContentType()); err != nil {
+		return false, err
+	}
+
+	stored, found, err := libraryInfo(to, lib.Name, lib.Version.String())
+	if err != nil {
+		return false, fmt.Errorf("failed to check the copy: %w", err)
+	}
+	if !found || stored.Hash != lib.Hash {
+		return false, fmt.Errorf("target stored hash %s, expected %s", stored.Hash, lib.Hash)
+	}
+	return true, nil
+}
+
+// listLibraries returns every library version on a registry published at
+// or after since.
+func listLibraries(cfg *config.Config, since time.Time) ([]models.Library, error) {
+	query := url.Values{}
+	if !since.IsZero() {
+		query.Set("since", since.Format(time.RFC3339))
+	}
+
+	resp, err := httpClient.Get(cfg.Endpoint("libraries", query))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list libraries: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to list libraries: %s: %s", resp.Status, string(body))
+	}
+
+	var libraries []models.Library
+	if err := json.NewDecoder(resp.Body).Decode(&libraries); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return libraries, nil
+}
+
+// libraryInfo looks up a library version on a registry.
+func libraryInfo(cfg *config.Config, name, version string) (models.Library, bool, error) {
+	resp, err := httpClient.Get(cfg.Endpoint("info", url.Values{"name": {name}, "version": {version}}))
+	if err != nil {
+		return models.Library{}, false, fmt.Errorf("failed to look up %s %s: %w", name, version, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return models.Library{}, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return models.Library{}, false, fmt.Errorf("failed to look up %s %s: %s", name, version, resp.Status)
+	}
+
+	var library models.Library
+	if err := json.NewDecoder(resp.Body).Decode(&library); err != nil {
+		return models.Library{}, false, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return library, true, nil
+}
+
+// fetchArchive downloads a library archive and checks it against the hash
+// the registry listed for it.
+func fetchArchive(cfg *config.Config, lib models.Library) ([]byte, time.Time, error) {
+	resp, err := httpClient.Get(cfg.Endpoint("download", url.Values{"name": {lib.Name}, "version": {lib.Version.String()}}))
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to download: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, time.Time{}, fmt.Errorf("download failed with status: %s, body: %s", resp.Status, string(body))
+	}
+
+	content, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("failed to download: %w", err)
+	}
+
+	sum := sha256.Sum256(content)
+	if hash := hex.EncodeToString(sum[:]); hash != lib.Hash {
+		return nil, time.Time{}, fmt.Errorf("downloaded archive has hash %s, expected %s", hash, lib.Hash)
+	}
+
+	modTime := time.Now()
+	if unix, err := strconv.ParseInt(resp.Header.Get("X-File-ModTime"), 10, 64); err == nil {
+		modTime = time.Unix(unix, 0)
+	}
+	return content, modTime, nil
+}
@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/iamgp/hvr/pkg/client/metadata"
+	"github.com/iamgp/hvr/pkg/client/pack"
+	"github.com/spf13/cobra"
+)
+
+var (
+	packOutput     string
+	packPreserveMT bool
+	packList       bool
+)
+
+var packCmd = &cobra.Command{
+	Use:   "pack [metadata-file]",
+	Short: "Build a library archive from a metadata file",
+	Long: `Build a library archive from a metadata file, exactly as uploadmeta would.
+
+Files are stored under their path relative to the metadata file, in sorted
+order and with a fixed timestamp, so packing identical files always gives a
+byte-identical archive. Files matched by .hvrignore next to the metadata file
+(gitignore syntax) or by the metadata's exclude patterns are left out, as
+are the output archive and earlier archives named <name>-<version>.zip. An
+hvr-manifest.json entry lists every file with its size and SHA-256.
+
+Use --list to print the files that would be packed without writing anything.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		metadataFile := "library_meta.json"
+		if len(args) > 0 {
+			metadataFile = args[0]
+		}
+
+		meta, err := metadata.ParseMetadataFile(metadataFile)
+		if err != nil {
+			return fmt.Errorf("failed to parse metadata file: %w", err)
+		}
+
+		output := packOutput
+		if output == "" {
+			output = fmt.Sprintf("%s-%s.zip", meta.Name, meta.Version)
+		}
+		meta.Files = withoutFile(meta, output)
+
+		if packList {
+			for _, file := range meta.Files {
+				fmt.Println(file)
+			}
+			return nil
+		}
+
+		manifest, hash, err := pack.WriteFile(output, meta, pack.Options{PreserveModTimes: packPreserveMT})
+		if err != nil {
+			return fmt.Errorf("failed to pack library: %w", err)
+		}
+
+		fmt.Printf("Packed %d files into %s\n", len(manifest.Files), output)
+		fmt.Printf("SHA-256: %s\n", hash)
+		return nil
+	},
+}
+
+// withoutFile returns the files of meta other than path, so that an archive
+// written into the library directory is never packed into itself.
+func withoutFile(meta *metadata.Metadata, path string) []string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return meta.Files
+	}
+	var files []string
+	for _, file := range meta.Files {
+		if local, err := filepath.Abs(meta.LocalPath(file)); err != nil || local != abs {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func init() {
+	rootCmd.AddCommand(packCmd)
+	packCmd.Flags().StringVarP(&packOutput, "output", "o", "", "Archive to write (default <name>-<version>.zip)")
+	packCmd.Flags().BoolVar(&packPreserveMT, "mtimes", false, "Record file modification times in the manifest")
+	packCmd.Flags().BoolVar(&packList, "list", false, "Print the files that would be packed and exit")
+}
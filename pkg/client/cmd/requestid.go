@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/iamgp/hvr/internal/logging"
+)
+
+// commandID identifies this run of hvr in the server logs. Every request the
+// command sends carries it in X-Request-ID, followed by the request's
+// number, so all of them can be found by searching the logs for it.
+var commandID = logging.NewRequestID()
+
+// Requests sent by the command, and how many of them the server answered.
+var requestsSent, requestsAnswered atomic.Int64
+
+// requestIDTransport numbers the requests sent by the command.
+type requestIDTransport struct {
+	base http.RoundTripper
+}
+
+func (t *requestIDTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := requestsSent.Add(1)
+	if req.Header.Get(logging.RequestIDHeader) == "" {
+		// RoundTrippers must not modify the caller's request.
+		req = req.Clone(req.Context())
+		req.Header.Set(logging.RequestIDHeader, fmt.Sprintf("%s-%d", commandID, n))
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		requestsAnswered.Add(1)
+	}
+	return resp, err
+}
+
+// httpClient sends every request of the command. loadConfig replaces it
+// with one using the TLS settings of the config.
+var httpClient = newHTTPClient(http.DefaultTransport.(*http.Transport).Clone())
+
+// newHTTPClient returns a client sending requests with base and numbering
+// them.
+func newHTTPClient(base *http.Transport) *http.Client {
+	return &http.Client{Transport: &requestIDTransport{base: base}}
+}
+
+// withRequestID adds the command ID to err once the server has answered
+// one of the command's requests, so a failure can be matched with the
+// server's logs.
+func withRequestID(err error) error {
+	if err == nil || requestsAnswered.Load() == 0 {
+		return err
+	}
+	return fmt.Errorf("%w\nRequest ID: %s (search the server logs for it)", err, commandID)
+}
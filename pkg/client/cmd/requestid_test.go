@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/iamgp/hvr/internal/logging"
+)
+
+func TestRequestIDTransport(t *testing.T) {
+	var ids []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, r.Header.Get(logging.RequestIDHeader))
+	}))
+	defer server.Close()
+
+	for i := 0; i < 2; i++ {
+		resp, err := httpClient.Get(server.URL)
+		if err != nil {
+			t.Fatalf("Failed to send request: %v", err)
+		}
+		resp.Body.Close()
+	}
+
+	if len(ids) != 2 || ids[0] == ids[1] {
+		t.Fatalf("Expected 2 distinct request IDs, got %q", ids)
+	}
+	for _, id := range ids {
+		if !strings.HasPrefix(id, commandID+"-") || !logging.ValidRequestID(id) {
+			t.Errorf("Expected a valid request ID starting with %s, got %q", commandID, id)
+		}
+	}
+
+	err := withRequestID(errors.New("install failed"))
+	if !strings.Contains(err.Error(), "Request ID: "+commandID) {
+		t.Errorf("Expected the command ID in the error, got %q", err)
+	}
+}
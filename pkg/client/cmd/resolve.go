@@ -14,7 +14,17 @@ var resolveCmd = &cobra.Command{
 		name := args[0]
 		version := args[1]
 
-		dependencies, err := resolveDependencies(name, version)
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		c, err := openCache(cfg)
+		if err != nil {
+			return err
+		}
+
+		dependencies, err := resolveLibrary(cfg, c, name, version)
 		if err != nil {
 			return err
 		}
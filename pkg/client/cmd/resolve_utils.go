@@ -4,13 +4,16 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
 
+	"github.com/Masterminds/semver/v3"
 	"github.com/iamgp/hvr/internal/models"
+	"github.com/iamgp/hvr/pkg/client/cache"
+	"github.com/iamgp/hvr/pkg/client/config"
 )
 
-func resolveDependencies(name, version string) ([]models.Library, error) {
-	url := fmt.Sprintf("http://localhost:8080/resolve?name=%s&version=%s", name, version)
-	resp, err := http.Get(url)
+func resolveDependencies(cfg *config.Config, name, version string) ([]models.Library, error) {
+	resp, err := httpClient.Get(cfg.Endpoint("resolve", url.Values{"name": {name}, "version": {version}}))
 	if err != nil {
 		return nil, fmt.Errorf("failed to resolve dependencies: %w", err)
 	}
@@ -28,3 +31,30 @@ func resolveDependencies(name, version string) ([]models.Library, error) {
 
 	return dependencies, nil
 }
+
+// resolveLibrary resolves the dependencies of a library version using the
+// server, or only the download cache in offline mode.
+func resolveLibrary(cfg *config.Config, c *cache.Cache, name, version string) ([]models.Library, error) {
+	if !offline {
+		return resolveDependencies(cfg, name, version)
+	}
+
+	entry, err := c.Get(name, version)
+	if err != nil {
+		return nil, fmt.Errorf("offline: %w", err)
+	}
+	entries, err := c.Resolve(entry)
+	if err != nil {
+		return nil, fmt.Errorf("offline: %w", err)
+	}
+
+	dependencies := make([]models.Library, 0, len(entries))
+	for _, e := range entries {
+		v, err := semver.NewVersion(e.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid cached version %s %s: %w", e.Name, e.Version, err)
+		}
+		dependencies = append(dependencies, models.Library{Name: e.Name, Version: v, Dependencies: e.Dependencies, Hash: e.Hash})
+	}
+	return dependencies, nil
+}
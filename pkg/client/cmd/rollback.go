@@ -0,0 +1,85 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/iamgp/hvr/pkg/client/state"
+	"github.com/iamgp/hvr/pkg/client/txn"
+	"github.com/spf13/cobra"
+)
+
+var rollbackList bool
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback",
+	Short: "Undo the last install or uninstall",
+	Long: `Undo the last install or uninstall in the Venus root.
+
+Every install and uninstall backs up the files it replaces or deletes.
+rollback restores them, removes the files the change added and restores the
+install state, returning the Venus root to the last known-good set of
+libraries. It also recovers from an install that was interrupted halfway.
+Run it again to undo earlier changes; the last 5 are kept.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		root, err := venusRootDir(cfg)
+		if err != nil {
+			return err
+		}
+
+		if rollbackList {
+			return printTransactions(root)
+		}
+
+		journal, err := txn.Rollback(root)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back %s from %s (%d files restored)\n", journal.Description, journal.Started.Local().Format("2006-01-02 15:04"), changedFiles(*journal))
+		return nil
+	},
+}
+
+// changedFiles counts the library files a transaction changed, leaving out
+// the install state it also records.
+func changedFiles(j txn.Journal) int {
+	n := 0
+	for _, c := range j.Changes {
+		if c.Path != state.RelPath {
+			n++
+		}
+	}
+	return n
+}
+
+func printTransactions(root string) error {
+	journals, err := txn.List(root)
+	if err != nil {
+		return err
+	}
+	if len(journals) == 0 {
+		fmt.Println("Nothing to roll back")
+		return nil
+	}
+
+	fmt.Println("Changes that can be rolled back, most recent first:")
+	for i := len(journals) - 1; i >= 0; i-- {
+		j := journals[i]
+		status := ""
+		if j.Status != txn.StatusCommitted {
+			status = fmt.Sprintf(" [%s]", j.Status)
+		}
+		fmt.Printf("- %s: %s, %d files%s\n", j.Started.Local().Format("2006-01-02 15:04"), j.Description, changedFiles(j), status)
+	}
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(rollbackCmd)
+	rollbackCmd.Flags().StringVar(&venusRoot, "venus-root", "", "Hamilton installation root (overrides the config file)")
+	rollbackCmd.Flags().BoolVar(&rollbackList, "list", false, "List the changes that can be rolled back")
+}
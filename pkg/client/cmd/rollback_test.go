@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/iamgp/hvr/pkg/client/state"
+	"github.com/iamgp/hvr/pkg/client/txn"
+)
+
+func TestRollbackRestoresPreviousInstall(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "lib-a", "1.0.0", nil, map[string]string{"LibA/LibA.hsl": "// v1\n", "LibA/Old.hs_": "// old\n"})
+	publishTestLibrary(t, s, "lib-a", "2.0.0", nil, map[string]string{"LibA/LibA.hsl": "// v2\n", "LibA/New.hs_": "// new\n"})
+
+	root := filepath.Join(t.TempDir(), "HAMILTON")
+	for _, version := range []string{"1.0.0", "2.0.0"} {
+		if _, err := installLibrary(cfg, root, "lib-a", version, false, false); err != nil {
+			t.Fatalf("Failed to install lib-a %s: %v", version, err)
+		}
+	}
+
+	journal, err := txn.Rollback(root)
+	if err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if n := changedFiles(*journal); n != 3 {
+		t.Errorf("Expected 3 library files to be restored, got %d", n)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(root, "Library", "LibA", "LibA.hsl"))
+	if string(data) != "// v1\n" {
+		t.Errorf("Expected version 1.0.0 to be restored, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(root, "Library", "LibA", "Old.hs_")); err != nil {
+		t.Errorf("Expected Old.hs_ to be restored: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "Library", "LibA", "New.hs_")); !os.IsNotExist(err) {
+		t.Errorf("Expected New.hs_ to be removed")
+	}
+
+	st, err := state.Load(root)
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if pkg := st.Find("lib-a"); pkg == nil || pkg.Version != "1.0.0" {
+		t.Errorf("Expected the install state of 1.0.0 to be restored, got %+v", st.Packages)
+	}
+}
+
+func TestFailedInstallLeavesRootUntouched(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "lib-a", "1.0.0", nil, map[string]string{"Shared/Common.hsl": "// a\n"})
+	publishTestLibrary(t, s, "lib-c", "1.0.0", nil, map[string]string{"LibC/LibC.hsl": "// c\n"})
+	publishTestLibrary(t, s, "lib-b", "1.0.0", map[string]string{"lib-c": "^1.0.0"}, map[string]string{"Shared/Common.hsl": "// b\n"})
+
+	root := filepath.Join(t.TempDir(), "HAMILTON")
+	if _, err := installLibrary(cfg, root, "lib-a", "1.0.0", false, false); err != nil {
+		t.Fatalf("Failed to install lib-a: %v", err)
+	}
+	if _, err := installLibrary(cfg, root, "lib-b", "1.0.0", false, false); err == nil {
+		t.Fatalf("Expected lib-b to conflict with lib-a")
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "Library", "LibC")); !os.IsNotExist(err) {
+		t.Errorf("The dependency of a failed install should not be installed")
+	}
+	st, _ := state.Load(root)
+	if len(st.Packages) != 1 {
+		t.Errorf("Expected only lib-a to be installed, got %+v", st.Packages)
+	}
+}
@@ -11,7 +11,7 @@ var rootCmd = &cobra.Command{
 }
 
 func Execute() error {
-	return rootCmd.Execute()
+	return withRequestID(rootCmd.Execute())
 }
 
 func init() {
@@ -21,4 +21,7 @@ func init() {
 	rootCmd.AddCommand(uploadMetaCmd)
 	rootCmd.AddCommand(resolveCmd)
 	rootCmd.AddCommand(installCmd)
+
+	rootCmd.PersistentFlags().StringVar(&serverURL, "server", "", "Registry server URL (overrides the config file)")
+	rootCmd.PersistentFlags().BoolVar(&offline, "offline", false, "Use only the download cache, never the server")
 }
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/iamgp/hvr/pkg/client/state"
+	"github.com/iamgp/hvr/pkg/client/txn"
+	"github.com/spf13/cobra"
+)
+
+var uninstallForce bool
+
+var uninstallCmd = &cobra.Command{
+	Use:   "uninstall <name>",
+	Short: "Remove an installed library",
+	Long: `Remove the files an installed library wrote to the Venus root.
+
+Files that another installed library also owns are kept. Files modified since
+they were installed stop the uninstall unless --force is given, in which case
+they are kept and everything else is removed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		root, err := venusRootDir(cfg)
+		if err != nil {
+			return err
+		}
+
+		return uninstallLibrary(root, args[0], uninstallForce)
+	},
+}
+
+// uninstallLibrary removes the files of an installed library and forgets it.
+func uninstallLibrary(root, name string, force bool) error {
+	st, err := state.Load(root)
+	if err != nil {
+		return fmt.Errorf("failed to read install state: %w", err)
+	}
+
+	pkg := st.Find(name)
+	if pkg == nil {
+		return fmt.Errorf("library %s is not installed in %s", name, root)
+	}
+
+	if !force {
+		var modified []string
+		for _, f := range pkg.Files {
+			changed, err := f.Modified(root)
+			if err != nil {
+				return fmt.Errorf("failed to check %s: %w", f.Path, err)
+			}
+			if changed {
+				modified = append(modified, f.Path)
+			}
+		}
+		if len(modified) > 0 {
+			return fmt.Errorf("files of %s were modified since they were installed (use --force to keep them and remove the rest):\n  %s", name, strings.Join(modified, "\n  "))
+		}
+	}
+
+	version := pkg.Version
+	tx, err := txn.Begin(root, fmt.Sprintf("uninstall %s %s", name, version))
+	if err != nil {
+		return err
+	}
+	defer tx.Abort()
+
+	removed := removeFiles(tx, st, root, pkg, pkg.Files)
+	st.Remove(name)
+	if err := commitState(tx, st); err != nil {
+		return err
+	}
+
+	fmt.Printf("Library %s version %s uninstalled (%d files removed)\n", name, version, removed)
+	return nil
+}
+
+func init() {
+	rootCmd.AddCommand(uninstallCmd)
+	uninstallCmd.Flags().StringVar(&venusRoot, "venus-root", "", "Hamilton installation root (overrides the config file)")
+	uninstallCmd.Flags().BoolVarP(&uninstallForce, "force", "f", false, "Keep modified files and remove the rest")
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iamgp/hvr/pkg/client/state"
+)
+
+func TestUninstallLibrary(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "lib-a", "1.0.0", nil, map[string]string{
+		"LibA/LibA.hsl":     "// a\n",
+		"Shared/Common.hsl": "// common\n",
+	})
+	publishTestLibrary(t, s, "lib-b", "1.0.0", nil, map[string]string{
+		"LibB/LibB.hsl":     "// b\n",
+		"LibB/Demo.med":     "method\n",
+		"Shared/Common.hsl": "// common\n",
+	})
+
+	root := filepath.Join(t.TempDir(), "HAMILTON")
+	for _, name := range []string{"lib-a", "lib-b"} {
+		if _, err := installLibrary(cfg, root, name, "1.0.0", false, false); err != nil {
+			t.Fatalf("Failed to install %s: %v", name, err)
+		}
+	}
+
+	installed := func(rel string) bool {
+		_, err := os.Stat(filepath.Join(root, filepath.FromSlash(rel)))
+		return err == nil
+	}
+
+	demo := filepath.Join(root, "Methods", "LibB", "Demo.med")
+	if err := os.WriteFile(demo, []byte("edited\n"), 0644); err != nil {
+		t.Fatalf("Failed to modify %s: %v", demo, err)
+	}
+
+	err := uninstallLibrary(root, "lib-b", false)
+	if err == nil || !strings.Contains(err.Error(), "Methods/LibB/Demo.med") {
+		t.Fatalf("Expected uninstall to refuse the modified file, got %v", err)
+	}
+	if !installed("Library/LibB/LibB.hsl") {
+		t.Errorf("A refused uninstall should not remove any files")
+	}
+
+	if err := uninstallLibrary(root, "lib-b", true); err != nil {
+		t.Fatalf("Failed to force uninstall: %v", err)
+	}
+	if installed("Library/LibB/LibB.hsl") || installed("Library/LibB") {
+		t.Errorf("Expected lib-b's files and folder to be removed")
+	}
+	if !installed("Methods/LibB/Demo.med") {
+		t.Errorf("Expected the modified file to be kept")
+	}
+	if !installed("Library/Shared/Common.hsl") || !installed("Library/LibA/LibA.hsl") {
+		t.Errorf("Expected lib-a's files, including the shared one, to be kept")
+	}
+
+	st, err := state.Load(root)
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if st.Find("lib-b") != nil || st.Find("lib-a") == nil {
+		t.Errorf("Unexpected install state: %+v", st.Packages)
+	}
+
+	if err := uninstallLibrary(root, "lib-a", false); err != nil {
+		t.Fatalf("Failed to uninstall lib-a: %v", err)
+	}
+	if installed("Library/Shared/Common.hsl") {
+		t.Errorf("Expected the shared file to be removed with its last owner")
+	}
+}
+
+func TestInstallConflict(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "lib-a", "1.0.0", nil, map[string]string{"Shared/Common.hsl": "// a\n"})
+	publishTestLibrary(t, s, "lib-b", "1.0.0", nil, map[string]string{"Shared/Common.hsl": "// b\n"})
+
+	root := filepath.Join(t.TempDir(), "HAMILTON")
+	if _, err := installLibrary(cfg, root, "lib-a", "1.0.0", false, false); err != nil {
+		t.Fatalf("Failed to install lib-a: %v", err)
+	}
+	_, err := installLibrary(cfg, root, "lib-b", "1.0.0", false, false)
+	if err == nil || !strings.Contains(err.Error(), "installed by lib-a") {
+		t.Fatalf("Expected a conflict with lib-a, got %v", err)
+	}
+}
+
+func TestInstallUnownedFiles(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "lib-a", "1.0.0", nil, map[string]string{"LibA/LibA.hsl": "// a\n", "LibA/Same.hsl": "// same\n"})
+
+	root := filepath.Join(t.TempDir(), "HAMILTON")
+	local := filepath.Join(root, "Library", "LibA", "LibA.hsl")
+	os.MkdirAll(filepath.Dir(local), 0755)
+	os.WriteFile(local, []byte("// hand written\n"), 0644)
+	os.WriteFile(filepath.Join(root, "Library", "LibA", "Same.hsl"), []byte("// same\n"), 0644)
+
+	_, err := installLibrary(cfg, root, "lib-a", "1.0.0", false, false)
+	if err == nil || !strings.Contains(err.Error(), "Library/LibA/LibA.hsl") || strings.Contains(err.Error(), "Same.hsl") {
+		t.Fatalf("Expected only the differing file to stop the install, got %v", err)
+	}
+	if data, _ := os.ReadFile(local); string(data) != "// hand written\n" {
+		t.Errorf("Expected the existing file to be kept, got %q", data)
+	}
+
+	if _, err := installLibrary(cfg, root, "lib-a", "1.0.0", false, true); err != nil {
+		t.Fatalf("Failed to install with force: %v", err)
+	}
+	if data, _ := os.ReadFile(local); string(data) != "// a\n" {
+		t.Errorf("Expected the existing file to be replaced, got %q", data)
+	}
+}
+
+func TestReinstallModifiedFiles(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "lib-a", "1.0.0", nil, map[string]string{"LibA/LibA.hsl": "// v1\n", "LibA/Demo.med": "method\n"})
+	publishTestLibrary(t, s, "lib-a", "1.1.0", nil, map[string]string{"LibA/LibA.hsl": "// v1.1\n", "LibA/Demo.med": "method\n"})
+
+	root := filepath.Join(t.TempDir(), "HAMILTON")
+	if _, err := installLibrary(cfg, root, "lib-a", "1.0.0", false, false); err != nil {
+		t.Fatalf("Failed to install lib-a 1.0.0: %v", err)
+	}
+	demo := filepath.Join(root, "Methods", "LibA", "Demo.med")
+	os.WriteFile(demo, []byte("edited\n"), 0644)
+
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		_, err := installLibrary(cfg, root, "lib-a", version, false, false)
+		if err == nil || !strings.Contains(err.Error(), "Methods/LibA/Demo.med") || strings.Contains(err.Error(), "LibA.hsl") {
+			t.Fatalf("Expected installing %s to refuse only the modified file, got %v", version, err)
+		}
+	}
+	if data, _ := os.ReadFile(demo); string(data) != "edited\n" {
+		t.Errorf("Expected the modified file to be kept, got %q", data)
+	}
+
+	if _, err := installLibrary(cfg, root, "lib-a", "1.1.0", false, true); err != nil {
+		t.Fatalf("Failed to install with force: %v", err)
+	}
+	if data, _ := os.ReadFile(demo); string(data) != "method\n" {
+		t.Errorf("Expected the modified file to be replaced, got %q", data)
+	}
+}
+
+func TestReinstallRemovesStaleFiles(t *testing.T) {
+	s, cfg := newTestRegistry(t)
+	publishTestLibrary(t, s, "lib-a", "1.0.0", nil, map[string]string{"LibA/LibA.hsl": "// v1\n", "LibA/Old.hs_": "// old\n"})
+	publishTestLibrary(t, s, "lib-a", "1.1.0", nil, map[string]string{"LibA/LibA.hsl": "// v1.1\n"})
+
+	root := filepath.Join(t.TempDir(), "HAMILTON")
+	for _, version := range []string{"1.0.0", "1.1.0"} {
+		if _, err := installLibrary(cfg, root, "lib-a", version, false, false); err != nil {
+			t.Fatalf("Failed to install lib-a %s: %v", version, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(root, "Library", "LibA", "Old.hs_")); !os.IsNotExist(err) {
+		t.Errorf("Expected the file dropped in 1.1.0 to be removed")
+	}
+	st, _ := state.Load(root)
+	if pkg := st.Find("lib-a"); pkg == nil || pkg.Version != "1.1.0" || len(pkg.Files) != 1 {
+		t.Errorf("Unexpected install state: %+v", st.Packages)
+	}
+}
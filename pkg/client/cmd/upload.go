@@ -17,7 +17,12 @@ var uploadCmd = &cobra.Command{
 		repoURL, _ := cmd.Flags().GetString("repo-url")
 		dependencies, _ := cmd.Flags().GetStringToString("dependencies")
 
-		return uploadLibrary(filePath, name, version, description, author, repoURL, dependencies)
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		return uploadLibrary(cfg, filePath, name, version, description, author, repoURL, dependencies)
 	},
 }
 
@@ -29,6 +34,8 @@ func init() {
 	uploadCmd.Flags().String("author", "", "Author of the library")
 	uploadCmd.Flags().String("repo-url", "", "Repository URL of the library")
 	uploadCmd.Flags().StringToString("dependencies", nil, "Dependencies of the library (format: name=version)")
+	uploadCmd.Flags().BoolVar(&signUpload, "sign", false, "Sign the archive with your private key")
+	uploadCmd.Flags().StringVar(&signingKeyPath, "key", "", "Private key used with --sign (defaults to signing_key from the config)")
 	uploadCmd.MarkFlagRequired("name")
 	uploadCmd.MarkFlagRequired("version")
 }
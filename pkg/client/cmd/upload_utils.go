@@ -2,16 +2,28 @@ package cmd
 
 import (
 	"bytes"
+	"crypto/ed25519"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/iamgp/hvr/internal/venus"
+	"github.com/iamgp/hvr/pkg/client/config"
+	"github.com/iamgp/hvr/pkg/client/signing"
+)
+
+var (
+	signUpload     bool
+	signingKeyPath string
 )
 
-func uploadLibrary(filePath, name, version, description, author, repoURL string, dependencies map[string]string) error {
+func uploadLibrary(cfg *config.Config, filePath, name, version, description, author, repoURL string, dependencies map[string]string) error {
 	file, err := os.Open(filePath)
 	if err != nil {
 		return fmt.Errorf("failed to open file: %w", err)
@@ -43,6 +55,15 @@ func uploadLibrary(filePath, name, version, description, author, repoURL string,
 	}
 	writer.WriteField("dependencies", string(dependenciesJSON))
 
+	if signUpload {
+		signature, publicKey, err := signFile(cfg, filePath)
+		if err != nil {
+			return err
+		}
+		writer.WriteField("signature", signature)
+		writer.WriteField("signingKey", publicKey)
+	}
+
 	// Add modification time to the form data
 	fileInfo, err := file.Stat()
 	if err != nil {
@@ -56,24 +77,88 @@ func uploadLibrary(filePath, name, version, description, author, repoURL string,
 		return fmt.Errorf("failed to close multipart writer: %w", err)
 	}
 
-	req, err := http.NewRequest("POST", "http://localhost:8080/upload", body)
+	warnings, err := sendUpload(cfg, body, writer.FormDataContentType())
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return err
+	}
+	for _, w := range warnings {
+		fmt.Printf("Warning: %s\n", w)
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	fmt.Printf("Library %s version %s uploaded successfully\n", name, version)
+	return nil
+}
+
+// sendUpload posts a multipart upload form to the server and returns the
+// warnings it reports about the stored library.
+func sendUpload(cfg *config.Config, body io.Reader, contentType string) ([]venus.Problem, error) {
+	req, err := http.NewRequest("POST", cfg.Endpoint("upload", nil), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := httpClient.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnprocessableEntity {
+		return nil, validationFailure(resp.Body)
+	}
+
 	if resp.StatusCode != http.StatusCreated {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("upload failed with status: %s, body: %s", resp.Status, string(bodyBytes))
+		return nil, fmt.Errorf("upload failed with status: %s, body: %s", resp.Status, string(bodyBytes))
 	}
 
-	fmt.Printf("Library %s version %s uploaded successfully\n", name, version)
-	return nil
+	var result struct {
+		Warnings []venus.Problem `json:"warnings"`
+	}
+	json.NewDecoder(resp.Body).Decode(&result)
+	return result.Warnings, nil
+}
+
+// signFile signs the archive at filePath with the configured private key and
+// returns the encoded signature and public key.
+func signFile(cfg *config.Config, filePath string) (string, string, error) {
+	keyPath := signingKeyPath
+	if keyPath == "" {
+		keyPath = cfg.SigningKey
+	}
+	if keyPath == "" {
+		return "", "", fmt.Errorf("no signing key given; use --key or set signing_key in the config")
+	}
+
+	priv, err := signing.LoadPrivateKey(keyPath)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to load signing key: %w", err)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read file for signing: %w", err)
+	}
+
+	pub := priv.Public().(ed25519.PublicKey)
+	return signing.Sign(priv, data), signing.EncodePublicKey(pub), nil
+}
+
+// validationFailure turns the server's list of validation problems into an
+// error with one problem per line.
+func validationFailure(body io.Reader) error {
+	var result struct {
+		Error    string          `json:"error"`
+		Problems []venus.Problem `json:"problems"`
+	}
+	if err := json.NewDecoder(body).Decode(&result); err != nil {
+		return fmt.Errorf("upload rejected by server validation")
+	}
+
+	var b strings.Builder
+	b.WriteString(result.Error)
+	for _, p := range result.Problems {
+		b.WriteString("\n  " + p.String())
+	}
+	return errors.New(b.String())
 }
@@ -1,12 +1,12 @@
 package cmd
 
 import (
-	"archive/zip"
 	"fmt"
-	"io"
 	"os"
 
+	"github.com/iamgp/hvr/pkg/client/config"
 	"github.com/iamgp/hvr/pkg/client/metadata"
+	"github.com/iamgp/hvr/pkg/client/pack"
 	"github.com/spf13/cobra"
 )
 
@@ -23,67 +23,61 @@ var uploadMetaCmd = &cobra.Command{
 			return fmt.Errorf("failed to parse metadata file: %w", err)
 		}
 
-		// Create a temporary zip file
-		tempFile, err := os.CreateTemp("", "library-*.zip")
+		cfg, err := loadConfig()
 		if err != nil {
-			return fmt.Errorf("failed to create temporary file: %w", err)
+			return err
 		}
-		defer os.Remove(tempFile.Name())
-
-		// Create a zip writer
-		zipWriter := zip.NewWriter(tempFile)
 
-		// Add files to the zip
-		for _, file := range meta.Files {
-			err = addFileToZip(zipWriter, file)
-			if err != nil {
-				return fmt.Errorf("failed to add file to zip: %w", err)
+		if inferDeps {
+			if err := addInferredDependencies(cfg, meta); err != nil {
+				return err
 			}
 		}
 
-		// Close the zip writer
-		err = zipWriter.Close()
+		// Create a temporary zip file
+		tempFile, err := os.CreateTemp("", "library-*.zip")
 		if err != nil {
-			return fmt.Errorf("failed to close zip writer: %w", err)
+			return fmt.Errorf("failed to create temporary file: %w", err)
 		}
+		tempFile.Close()
+		defer os.Remove(tempFile.Name())
 
-		// Reopen the zip file for reading
-		tempFile.Seek(0, 0)
+		// Pack the files the same way as 'hvr pack'
+		if _, _, err := pack.WriteFile(tempFile.Name(), meta, pack.Options{}); err != nil {
+			return fmt.Errorf("failed to pack library: %w", err)
+		}
 
 		// Use the existing upload logic
-		return uploadLibrary(tempFile.Name(), meta.Name, meta.Version, meta.Description, meta.Author, meta.RepoURL, meta.Dependencies)
+		return uploadLibrary(cfg, tempFile.Name(), meta.Name, meta.Version, meta.Description, meta.Author, meta.RepoURL, meta.Dependencies)
 	},
 }
 
-func addFileToZip(zipWriter *zip.Writer, filename string) error {
-	file, err := os.Open(filename)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
+var inferDeps bool
 
-	info, err := file.Stat()
+// addInferredDependencies fills in dependencies the metadata file forgot,
+// based on the #include directives of the library's HSL files.
+func addInferredDependencies(cfg *config.Config, meta *metadata.Metadata) error {
+	scan, err := inferDependencies(cfg, localPaths(meta), meta.Dependencies)
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to infer dependencies: %w", err)
 	}
 
-	header, err := zip.FileInfoHeader(info)
-	if err != nil {
-		return err
+	if meta.Dependencies == nil {
+		meta.Dependencies = make(map[string]string)
 	}
-
-	header.Name = filename
-	header.Method = zip.Deflate
-
-	writer, err := zipWriter.CreateHeader(header)
-	if err != nil {
-		return err
+	for _, p := range scan.Proposals {
+		meta.Dependencies[p.Name] = p.Constraint
+		fmt.Printf("Added dependency %s %s\n", p.Name, p.Constraint)
 	}
-
-	_, err = io.Copy(writer, file)
-	return err
+	for _, p := range append(scan.Ambiguous, scan.Unresolved...) {
+		fmt.Printf("Warning: %s\n", p)
+	}
+	return nil
 }
 
 func init() {
 	rootCmd.AddCommand(uploadMetaCmd)
+	uploadMetaCmd.Flags().BoolVar(&inferDeps, "infer-deps", false, "Add dependencies inferred from #include directives")
+	uploadMetaCmd.Flags().BoolVar(&signUpload, "sign", false, "Sign the archive with your private key")
+	uploadMetaCmd.Flags().StringVar(&signingKeyPath, "key", "", "Private key used with --sign (defaults to signing_key from the config)")
 }
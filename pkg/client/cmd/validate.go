@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/iamgp/hvr/pkg/client/metadata"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate <metadata-file>",
+	Short: "Check a library metadata file against the schema",
+	Long: `Check a library metadata file against the schema.
+
+Every problem in the file is reported at once, with its line and column.
+Metadata files can be written in JSON or, with a .yaml or .yml extension, in
+YAML.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		_, problems, err := metadata.Load(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read metadata file: %w", err)
+		}
+
+		for _, p := range problems {
+			fmt.Println(p)
+		}
+
+		errs := metadata.Errors(problems)
+		if len(errs) > 0 {
+			return fmt.Errorf("%d errors, %d warnings", len(errs), len(problems)-len(errs))
+		}
+		fmt.Printf("%s is valid (%d warnings)\n", args[0], len(problems))
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/iamgp/hvr/internal/venus"
+	"github.com/iamgp/hvr/pkg/client/state"
+	"github.com/spf13/cobra"
+)
+
+var verifyCmd = &cobra.Command{
+	Use:   "verify [dir]",
+	Short: "Check the Hamilton checksum footers of installed files",
+	Long: `Check the Hamilton checksum footers of installed files.
+
+Venus refuses to load .hsl, .hs_, .med, .smt and .lay files whose checksum
+footer doesn't match their content, which happens when they are edited outside
+the Venus editor. verify walks dir (the Venus root by default) and reports
+every such file.`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var dir string
+		if len(args) > 0 {
+			dir = args[0]
+		} else {
+			cfg, err := loadConfig()
+			if err != nil {
+				return err
+			}
+			if dir, err = venusRootDir(cfg); err != nil {
+				return err
+			}
+		}
+
+		mismatched, err := verifyFooters(dir)
+		if err != nil {
+			return err
+		}
+		if mismatched > 0 {
+			return fmt.Errorf("%d files have invalid checksum footers", mismatched)
+		}
+		return nil
+	},
+}
+
+// verifyFooters prints the footer status of every Venus file below dir,
+// except those in the .hvr directory, and returns the number of files whose
+// checksum doesn't match.
+func verifyFooters(dir string) (int, error) {
+	var checked, missing, mismatched int
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			// The backups kept by install transactions aren't installed
+			// files.
+			if d.Name() == state.Dir {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !venus.HasFooter(path) {
+			return nil
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+
+		checked++
+		check := venus.CheckFooter(content)
+		switch {
+		case !check.Present:
+			missing++
+			fmt.Printf("%s: %s\n", path, check)
+		case !check.Valid():
+			mismatched++
+			fmt.Printf("%s: %s\n", path, check)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to verify %s: %w", dir, err)
+	}
+
+	fmt.Printf("Checked %d files: %d ok, %d without footer, %d invalid\n", checked, checked-missing-mismatched, missing, mismatched)
+	return mismatched, nil
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+	verifyCmd.Flags().StringVar(&venusRoot, "venus-root", "", "Hamilton installation root (overrides the config file)")
+}
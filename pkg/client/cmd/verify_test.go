@@ -0,0 +1,29 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVerifyFootersSkipsTransactionBackups(t *testing.T) {
+	root := t.TempDir()
+	invalid := []byte("method;\n// $$author=labuser$$valid=0$$time=2024-05-01 09:30$$checksum=00000000$$length=001$$\n")
+	backup := filepath.Join(root, ".hvr", "transactions", "1", "backup", "Library")
+	os.MkdirAll(backup, 0755)
+	os.WriteFile(filepath.Join(backup, "Old.hsl"), invalid, 0644)
+
+	mismatched, err := verifyFooters(root)
+	if err != nil {
+		t.Fatalf("Failed to verify: %v", err)
+	}
+	if mismatched != 0 {
+		t.Errorf("Expected backups to be skipped, got %d invalid files", mismatched)
+	}
+
+	os.MkdirAll(filepath.Join(root, "Library"), 0755)
+	os.WriteFile(filepath.Join(root, "Library", "Edited.hsl"), invalid, 0644)
+	if mismatched, _ = verifyFooters(root); mismatched != 1 {
+		t.Errorf("Expected 1 invalid file, got %d", mismatched)
+	}
+}
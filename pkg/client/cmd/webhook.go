@@ -0,0 +1,215 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/iamgp/hvr/internal/webhook"
+	"github.com/spf13/cobra"
+)
+
+var (
+	webhookLibrary string
+	webhookEvents  []string
+	webhookSecret  string
+
+	deliveriesWebhook int64
+	deliveriesStatus  string
+	deliveriesLimit   int
+	deliveriesJSON    bool
+)
+
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Short: "Manage the registry's webhooks",
+	Long: `Manage the registry's webhooks.
+
+A webhook receives a JSON POST for every registry event it subscribes to,
+either for one library or for all of them. Each request carries the event in
+the X-HVR-Event header and an X-HVR-Signature header of the form
+"sha256=<hex>", the HMAC-SHA256 of the body keyed with the webhook's secret.
+Failed deliveries are retried with exponential backoff and every attempt is
+recorded in the delivery log.
+
+Events: ` + strings.Join(webhook.Events, ", "),
+}
+
+var webhookAddCmd = &cobra.Command{
+	Use:   "add <url>",
+	Short: "Register a webhook",
+	Long: `Register a webhook.
+
+Without --library the webhook receives events for every library; without
+--event it receives every event. A secret is generated unless --secret is
+given. It is shown only once, so store it where the receiver can check
+signatures with it.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		hook, err := createWebhook(cfg, webhook.Hook{URL: args[0], Library: webhookLibrary, Events: webhookEvents, Secret: webhookSecret})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Registered webhook %d for %s\n", hook.ID, describeWebhook(hook))
+		fmt.Printf("Secret: %s\n", hook.Secret)
+		return nil
+	},
+}
+
+var webhookListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List registered webhooks",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		hooks, err := listWebhooks(cfg)
+		if err != nil {
+			return err
+		}
+		if len(hooks) == 0 {
+			fmt.Println("No webhooks registered")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tURL\tSUBSCRIBED TO\tCREATED")
+		for _, h := range hooks {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", h.ID, h.URL, describeWebhook(h), h.Created.Local().Format("2006-01-02 15:04"))
+		}
+		return w.Flush()
+	},
+}
+
+var webhookRemoveCmd = &cobra.Command{
+	Use:   "remove <id>",
+	Short: "Remove a webhook",
+	Long: `Remove a webhook. Deliveries still pending for it fail; the delivery log
+is kept.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid webhook ID: %s", args[0])
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		if err := deleteWebhook(cfg, id); err != nil {
+			return err
+		}
+		fmt.Printf("Removed webhook %d\n", id)
+		return nil
+	},
+}
+
+var webhookDeliveriesCmd = &cobra.Command{
+	Use:   "deliveries",
+	Short: "Show the webhook delivery log",
+	Long: `Show the webhook delivery log, newest first.
+
+A delivery is pending while it is being retried, delivered once the receiver
+answered with a 2xx status, and failed after the last retry or when its
+webhook was removed.`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		deliveries, err := fetchDeliveries(cfg, webhook.DeliveryFilter{WebhookID: deliveriesWebhook, Status: deliveriesStatus, Limit: deliveriesLimit})
+		if err != nil {
+			return err
+		}
+
+		if deliveriesJSON {
+			enc := json.NewEncoder(os.Stdout)
+			enc.SetIndent("", "  ")
+			return enc.Encode(deliveries)
+		}
+		if len(deliveries) == 0 {
+			fmt.Println("No deliveries found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tWEBHOOK\tEVENT\tCREATED\tSTATUS\tATTEMPTS\tRESULT")
+		for _, d := range deliveries {
+			fmt.Fprintf(w, "%d\t%d\t%s\t%s\t%s\t%d\t%s\n", d.ID, d.WebhookID, d.Event, d.Created.Local().Format("2006-01-02 15:04:05"), d.Status, d.Attempts, deliveryResult(d))
+		}
+		return w.Flush()
+	},
+}
+
+var webhookRedeliverCmd = &cobra.Command{
+	Use:   "redeliver <delivery-id>",
+	Short: "Send a past delivery again",
+	Long: `Send the payload of a past delivery again, as a new delivery to the same
+webhook. Use it after fixing a receiver that missed events.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.ParseInt(args[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid delivery ID: %s", args[0])
+		}
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		d, err := redeliver(cfg, id)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Queued delivery %d of %s to webhook %d\n", d.ID, d.Event, d.WebhookID)
+		return nil
+	},
+}
+
+func describeWebhook(h webhook.Hook) string {
+	library := "all libraries"
+	if h.Library != "" {
+		library = h.Library
+	}
+	events := "all events"
+	if len(h.Events) > 0 {
+		events = strings.Join(h.Events, ", ")
+	}
+	return events + " on " + library
+}
+
+func deliveryResult(d webhook.Delivery) string {
+	switch {
+	case d.Error != "":
+		return d.Error
+	case d.ResponseCode != 0:
+		return strconv.Itoa(d.ResponseCode)
+	}
+	return ""
+}
+
+func init() {
+	rootCmd.AddCommand(webhookCmd)
+	webhookCmd.AddCommand(webhookAddCmd, webhookListCmd, webhookRemoveCmd, webhookDeliveriesCmd, webhookRedeliverCmd)
+	webhookAddCmd.Flags().StringVar(&webhookLibrary, "library", "", "Only send events about this library")
+	webhookAddCmd.Flags().StringArrayVar(&webhookEvents, "event", nil, "Only send this event; repeat for several")
+	webhookAddCmd.Flags().StringVar(&webhookSecret, "secret", "", "Sign payloads with this secret instead of a generated one")
+	webhookDeliveriesCmd.Flags().Int64Var(&deliveriesWebhook, "webhook", 0, "Only show deliveries to this webhook")
+	webhookDeliveriesCmd.Flags().StringVar(&deliveriesStatus, "status", "", "Only show pending, delivered or failed deliveries")
+	webhookDeliveriesCmd.Flags().IntVarP(&deliveriesLimit, "limit", "n", 20, "Show at most this many deliveries (0 for all)")
+	webhookDeliveriesCmd.Flags().BoolVar(&deliveriesJSON, "json", false, "Print deliveries as JSON, including their payloads")
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/iamgp/hvr/internal/webhook"
+	"github.com/iamgp/hvr/pkg/client/config"
+)
+
+// createWebhook registers hook with the server and returns it with its ID
+// and secret.
+func createWebhook(cfg *config.Config, hook webhook.Hook) (webhook.Hook, error) {
+	body, err := json.Marshal(hook)
+	if err != nil {
+		return webhook.Hook{}, err
+	}
+	var created webhook.Hook
+	err = webhookRequest(http.MethodPost, cfg.Endpoint("api/v1/webhooks", nil), body, http.StatusCreated, &created)
+	if err != nil {
+		return webhook.Hook{}, fmt.Errorf("failed to register webhook: %w", err)
+	}
+	return created, nil
+}
+
+// listWebhooks returns the server's webhooks.
+func listWebhooks(cfg *config.Config) ([]webhook.Hook, error) {
+	var hooks []webhook.Hook
+	if err := webhookRequest(http.MethodGet, cfg.Endpoint("api/v1/webhooks", nil), nil, http.StatusOK, &hooks); err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	return hooks, nil
+}
+
+// deleteWebhook removes a webhook from the server.
+func deleteWebhook(cfg *config.Config, id int64) error {
+	endpoint := cfg.Endpoint("api/v1/webhooks/"+strconv.FormatInt(id, 10), nil)
+	if err := webhookRequest(http.MethodDelete, endpoint, nil, http.StatusNoContent, nil); err != nil {
+		return fmt.Errorf("failed to remove webhook %d: %w", id, err)
+	}
+	return nil
+}
+
+// fetchDeliveries queries the server's webhook delivery log.
+func fetchDeliveries(cfg *config.Config, filter webhook.DeliveryFilter) ([]webhook.Delivery, error) {
+	query := url.Values{}
+	if filter.WebhookID != 0 {
+		query.Set("webhook", strconv.FormatInt(filter.WebhookID, 10))
+	}
+	if filter.Status != "" {
+		query.Set("status", filter.Status)
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	var deliveries []webhook.Delivery
+	if err := webhookRequest(http.MethodGet, cfg.Endpoint("api/v1/webhooks/deliveries", query), nil, http.StatusOK, &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to read webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// redeliver asks the server to send a past delivery again and returns the
+// new delivery.
+func redeliver(cfg *config.Config, id int64) (webhook.Delivery, error) {
+	endpoint := cfg.Endpoint("api/v1/webhooks/deliveries/"+strconv.FormatInt(id, 10)+"/redeliver", nil)
+	var d webhook.Delivery
+	if err := webhookRequest(http.MethodPost, endpoint, nil, http.StatusAccepted, &d); err != nil {
+		return webhook.Delivery{}, fmt.Errorf("failed to redeliver %d: %w", id, err)
+	}
+	return d, nil
+}
+
+// webhookRequest sends a request to the webhook API and decodes the JSON
+// response into out unless it is nil.
+func webhookRequest(method, endpoint string, body []byte, wantStatus int, out interface{}) error {
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != wantStatus {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultServerURL is used when neither the config file nor the command line
+// names a server.
+const DefaultServerURL = "http://localhost:8080"
+
+// Config holds the client settings read from the hvr config file.
+type Config struct {
+	ServerURL       string       `json:"server_url"`
+	SigningKey      string       `json:"signing_key"`
+	SignaturePolicy string       `json:"signature_policy"`
+	TrustedKeys     []TrustedKey `json:"trusted_keys"`
+	VenusRoot       string       `json:"venus_root"`
+	CacheDir        string       `json:"cache_dir"`
+	// CACert is a PEM bundle of CAs trusted for HTTPS servers, as well as
+	// the system ones.
+	CACert string `json:"ca_cert"`
+	// ClientCert and ClientKey are the PEM certificate and key presented to
+	// servers that require client certificates.
+	ClientCert string `json:"client_cert"`
+	ClientKey  string `json:"client_key"`
+}
+
+// TrustedKey is a publisher public key whose signatures the client accepts.
+type TrustedKey struct {
+	Name      string `json:"name"`
+	PublicKey string `json:"public_key"`
+}
+
+// Path returns the location of the config file. HVR_CONFIG takes precedence
+// over the per-user config directory.
+func Path() (string, error) {
+	if p := os.Getenv("HVR_CONFIG"); p != "" {
+		return p, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "hvr", "config.json"), nil
+}
+
+// Load reads the config file. A missing file is not an error; the defaults
+// are returned instead.
+func Load() (*Config, error) {
+	path, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	return LoadFile(path)
+}
+
+func LoadFile(path string) (*Config, error) {
+	cfg := &Config{}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	}
+
+	if cfg.ServerURL == "" {
+		cfg.ServerURL = DefaultServerURL
+	}
+	return cfg, nil
+}
+
+// Endpoint builds the URL of a server endpoint with the given query.
+func (c *Config) Endpoint(path string, query url.Values) string {
+	u := strings.TrimRight(c.ServerURL, "/") + "/" + strings.TrimLeft(path, "/")
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	return u
+}
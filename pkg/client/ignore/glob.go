@@ -0,0 +1,52 @@
+package ignore
+
+import (
+	"path"
+	"strings"
+)
+
+// MatchPattern reports whether the slash separated path rel matches a glob
+// pattern. Besides the path.Match syntax, a "**" path element matches any
+// number of directories: "src/**/*.hsl" matches "src/a.hsl" and
+// "src/a/b/c.hsl", and a trailing "/**" matches everything inside a
+// directory.
+func MatchPattern(pattern, rel string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"))
+}
+
+// ValidPattern reports whether pattern has valid glob syntax.
+func ValidPattern(pattern string) bool {
+	for _, seg := range strings.Split(pattern, "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func matchSegments(pattern, parts []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			// A trailing "**" matches the contents of a directory, not
+			// the directory itself.
+			if len(rest) == 0 {
+				return len(parts) > 0
+			}
+			for i := 0; i <= len(parts); i++ {
+				if matchSegments(rest, parts[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(parts) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], parts[0]); !ok {
+			return false
+		}
+		pattern, parts = pattern[1:], parts[1:]
+	}
+	return len(parts) == 0
+}
@@ -0,0 +1,134 @@
+package ignore
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strings"
+)
+
+// FileName is the ignore file read from the directory of a metadata file.
+const FileName = ".hvrignore"
+
+type pattern struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// Matcher decides which paths are excluded, following .gitignore rules:
+// the last matching pattern wins, "!" re-includes, a trailing "/" only
+// matches directories, patterns without a slash match at any depth and "**"
+// matches any number of directories.
+type Matcher struct {
+	patterns []pattern
+}
+
+// Load reads an ignore file. A missing file gives a matcher that ignores
+// nothing.
+func Load(filename string) (*Matcher, error) {
+	m := &Matcher{}
+	if err := m.AddFile(filename); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Parse reads ignore patterns, one per line. Blank lines and lines starting
+// with '#' are skipped.
+func Parse(r io.Reader) (*Matcher, error) {
+	m := &Matcher{}
+	return m, m.addLines(r)
+}
+
+// AddFile appends the patterns of an ignore file, which take precedence over
+// the patterns added before. A missing file adds nothing.
+func (m *Matcher) AddFile(filename string) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.addLines(f)
+}
+
+func (m *Matcher) addLines(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		m.Add(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// Add appends a single pattern line. Later patterns take precedence.
+func (m *Matcher) Add(line string) {
+	line = trimTrailingSpace(strings.TrimLeft(line, " \t"))
+	if line == "" || strings.HasPrefix(line, "#") {
+		return
+	}
+
+	p := pattern{}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return
+	}
+
+	// A slash anywhere but at the end anchors the pattern to the directory
+	// of the ignore file; otherwise it matches at any depth.
+	if strings.Contains(line, "/") {
+		line = strings.TrimPrefix(line, "/")
+	} else {
+		line = "**/" + line
+	}
+	p.segments = strings.Split(line, "/")
+	m.patterns = append(m.patterns, p)
+}
+
+// trimTrailingSpace removes unescaped trailing spaces.
+func trimTrailingSpace(s string) string {
+	for strings.HasSuffix(s, " ") && !strings.HasSuffix(s, `\ `) {
+		s = s[:len(s)-1]
+	}
+	return strings.ReplaceAll(s, `\ `, " ")
+}
+
+// Match reports whether the slash separated path rel, relative to the
+// directory of the ignore file, is excluded. As with git, a path inside an
+// excluded directory can't be re-included.
+func (m *Matcher) Match(rel string, isDir bool) bool {
+	if m == nil || len(m.patterns) == 0 {
+		return false
+	}
+	parts := strings.Split(strings.Trim(rel, "/"), "/")
+	for i := 1; i < len(parts); i++ {
+		if m.excluded(parts[:i], true) {
+			return true
+		}
+	}
+	return m.excluded(parts, isDir)
+}
+
+func (m *Matcher) excluded(parts []string, isDir bool) bool {
+	excluded := false
+	for _, p := range m.patterns {
+		if p.dirOnly && !isDir {
+			continue
+		}
+		if matchSegments(p.segments, parts) {
+			excluded = !p.negate
+		}
+	}
+	return excluded
+}
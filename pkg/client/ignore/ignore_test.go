@@ -0,0 +1,78 @@
+package ignore
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatcher(t *testing.T) {
+	m, err := Parse(strings.NewReader(`
+# Venus leftovers
+*.bak
+*.trc
+!keep.trc
+/build/
+Logs/
+docs/**/*.tmp
+\#literal
+`))
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"Main.hsl", false, false},
+		{"Main.hsl.bak", false, true},
+		{"sub/dir/Old.hsl.bak", false, true},
+		{"run.trc", false, true},
+		{"keep.trc", false, false},
+		{"build", true, true},
+		{"build/out.zip", false, true},
+		{"sub/build/out.zip", false, false},
+		{"Logs", true, true},
+		{"a/Logs/x.txt", false, true},
+		{"Logs", false, false},
+		{"docs/x.tmp", false, true},
+		{"docs/a/b/x.tmp", false, true},
+		{"x.tmp", false, false},
+		{"#literal", false, true},
+	}
+	for _, tt := range tests {
+		if got := m.Match(tt.path, tt.isDir); got != tt.ignored {
+			t.Errorf("Match(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.ignored)
+		}
+	}
+}
+
+func TestNegationCannotReincludeInsideExcludedDirectory(t *testing.T) {
+	m, _ := Parse(strings.NewReader("Traces/\n!Traces/important.trc\n"))
+	if !m.Match("Traces/important.trc", false) {
+		t.Errorf("Expected file inside excluded directory to stay excluded")
+	}
+}
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		match         bool
+	}{
+		{"*.hsl", "Main.hsl", true},
+		{"*.hsl", "sub/Main.hsl", false},
+		{"**/*.hsl", "Main.hsl", true},
+		{"**/*.hsl", "a/b/Main.hsl", true},
+		{"src/**/*.hs_", "src/x.hs_", true},
+		{"src/**/*.hs_", "src/a/b/x.hs_", true},
+		{"src/**", "src/a/b", true},
+		{"src/**", "src", false},
+		{"Labware/*.rck", "Labware/plate.rck", true},
+	}
+	for _, tt := range tests {
+		if got := MatchPattern(tt.pattern, tt.path); got != tt.match {
+			t.Errorf("MatchPattern(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.match)
+		}
+	}
+}
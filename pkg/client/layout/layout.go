@@ -0,0 +1,164 @@
+// Package layout maps the files of a library archive to their place in a
+// Hamilton installation tree.
+package layout
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/iamgp/hvr/internal/venus"
+	"github.com/iamgp/hvr/pkg/client/ignore"
+)
+
+// Destination folders below the Hamilton installation root.
+const (
+	LibraryDir = "Library"
+	MethodsDir = "Methods"
+	LabwareDir = "Labware"
+)
+
+// DefaultRoot is where Venus is installed unless configured otherwise.
+const DefaultRoot = `C:\Program Files (x86)\HAMILTON`
+
+// Rule places the archive files matching Pattern in Dest, a folder relative
+// to the installation root. Patterns without a slash match the file name,
+// others the whole archive path. Strip removes a leading folder from the
+// archive path before it is joined to Dest.
+type Rule struct {
+	Pattern string `json:"pattern" yaml:"pattern"`
+	Dest    string `json:"dest" yaml:"dest"`
+	Strip   string `json:"strip,omitempty" yaml:"strip,omitempty"`
+}
+
+// DefaultRules place files by extension. Anything they don't match goes to
+// the Library folder.
+var DefaultRules = []Rule{
+	{Pattern: "*.hsl", Dest: LibraryDir},
+	{Pattern: "*.hs_", Dest: LibraryDir},
+	{Pattern: "*.hsi", Dest: LibraryDir},
+	{Pattern: "*.smt", Dest: LibraryDir},
+	{Pattern: "*.stp", Dest: LibraryDir},
+	{Pattern: "*.res", Dest: LibraryDir},
+	{Pattern: "*.chm", Dest: LibraryDir},
+	{Pattern: "*.bmp", Dest: LibraryDir},
+	{Pattern: "*.med", Dest: MethodsDir},
+	{Pattern: "*.lay", Dest: MethodsDir},
+	{Pattern: "*.rck", Dest: LabwareDir},
+	{Pattern: "*.ctr", Dest: LabwareDir},
+	{Pattern: "*.tml", Dest: LabwareDir},
+	{Pattern: "*.dck", Dest: LabwareDir},
+}
+
+// Validate checks that a rule has a valid pattern and stays inside the
+// installation root.
+func (r Rule) Validate() error {
+	if !ignore.ValidPattern(r.Pattern) {
+		return fmt.Errorf("invalid pattern %q", r.Pattern)
+	}
+	if err := checkRelative(r.Dest); err != nil {
+		return fmt.Errorf("invalid destination: %w", err)
+	}
+	if r.Strip != "" {
+		if err := checkRelative(r.Strip); err != nil {
+			return fmt.Errorf("invalid strip prefix: %w", err)
+		}
+	}
+	return nil
+}
+
+// Match reports whether the rule applies to the slash separated archive
+// path. Matching ignores case, as Windows does.
+func (r Rule) Match(rel string) bool {
+	pattern := strings.ToLower(r.Pattern)
+	rel = strings.ToLower(rel)
+	if !strings.Contains(pattern, "/") {
+		rel = path.Base(rel)
+	}
+	return ignore.MatchPattern(pattern, rel)
+}
+
+// Layout maps archive paths to files below Root. The package's own rules are
+// tried before the default ones; the first match wins.
+type Layout struct {
+	Root  string
+	Rules []Rule
+}
+
+func New(root string, packageRules []Rule) *Layout {
+	rules := make([]Rule, 0, len(packageRules)+len(DefaultRules))
+	rules = append(rules, packageRules...)
+	rules = append(rules, DefaultRules...)
+	return &Layout{Root: root, Rules: rules}
+}
+
+// Target returns the path below Root where the archive file rel belongs.
+// Zip tools on Windows may separate the path with backslashes.
+func (l *Layout) Target(rel string) (string, error) {
+	rel = strings.ReplaceAll(rel, `\`, "/")
+	if err := checkRelative(rel); err != nil {
+		return "", err
+	}
+
+	rule := Rule{Dest: LibraryDir}
+	for _, r := range l.Rules {
+		if r.Match(rel) {
+			rule = r
+			break
+		}
+	}
+
+	if rule.Strip != "" {
+		prefix := path.Clean(rule.Strip) + "/"
+		if len(rel) > len(prefix) && strings.EqualFold(rel[:len(prefix)], prefix) {
+			rel = rel[len(prefix):]
+		}
+	}
+	return filepath.Join(l.Root, filepath.FromSlash(rule.Dest), filepath.FromSlash(rel)), nil
+}
+
+// Placement is an archive file and where it is installed.
+type Placement struct {
+	Source string
+	Target string
+}
+
+// Plan maps every archive file to its target. Two files mapping to the same
+// target, which Windows compares without case, are an error.
+func (l *Layout) Plan(files []string) ([]Placement, error) {
+	placements := make([]Placement, 0, len(files))
+	seen := make(map[string]string)
+	for _, rel := range files {
+		target, err := l.Target(rel)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(target)
+		if other, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%s and %s would both be installed as %s", other, rel, target)
+		}
+		seen[key] = rel
+		placements = append(placements, Placement{Source: rel, Target: target})
+	}
+	return placements, nil
+}
+
+// checkRelative rejects slash separated paths that are absolute or leave the
+// folder they are relative to.
+func checkRelative(p string) error {
+	switch {
+	case p == "":
+		return fmt.Errorf("empty path")
+	case strings.Contains(p, `\`):
+		return fmt.Errorf("path %q must use forward slashes", p)
+	case path.IsAbs(p) || venus.IsAbsoluteWindowsPath(p):
+		return fmt.Errorf("path %q must be relative", p)
+	}
+	for _, segment := range strings.Split(p, "/") {
+		if segment == ".." {
+			return fmt.Errorf("path %q leaves the installation root", p)
+		}
+	}
+	return nil
+}
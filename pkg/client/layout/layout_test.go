@@ -0,0 +1,76 @@
+package layout
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTarget(t *testing.T) {
+	root := filepath.Join("fake", "HAMILTON")
+	l := New(root, []Rule{
+		{Pattern: "*.rck", Dest: "Labware/Acme", Strip: "labware"},
+		{Pattern: "docs/**", Dest: "Library/Acme/Docs", Strip: "docs"},
+	})
+
+	tests := []struct {
+		rel  string
+		want string
+	}{
+		{"Acme/Acme.hsl", "Library/Acme/Acme.hsl"},
+		{"Acme/Acme.HS_", "Library/Acme/Acme.HS_"},
+		{"Acme/Demo.med", "Methods/Acme/Demo.med"},
+		{"Acme/Demo.lay", "Methods/Acme/Demo.lay"},
+		{"labware/Plate.rck", "Labware/Acme/Plate.rck"},
+		{"Labware/Tips.RCK", "Labware/Acme/Tips.RCK"},
+		{"labware/Tube.ctr", "Labware/labware/Tube.ctr"},
+		{"docs/manual.pdf", "Library/Acme/Docs/manual.pdf"},
+		{"README.txt", "Library/README.txt"},
+		{`labware\Rack.rck`, "Labware/Acme/Rack.rck"},
+		{`Acme\Sub\Util.hsl`, "Library/Acme/Sub/Util.hsl"},
+	}
+	for _, tt := range tests {
+		got, err := l.Target(tt.rel)
+		if err != nil {
+			t.Errorf("Target(%q) failed: %v", tt.rel, err)
+			continue
+		}
+		if want := filepath.Join(root, filepath.FromSlash(tt.want)); got != want {
+			t.Errorf("Target(%q) = %q, want %q", tt.rel, got, want)
+		}
+	}
+}
+
+func TestTargetRejectsEscapes(t *testing.T) {
+	l := New("root", nil)
+	for _, rel := range []string{"../evil.hsl", "a/../../evil.hsl", "/etc/evil.hsl", "C:/evil.hsl", `a\..\..\evil.hsl`, `\evil.hsl`, `C:\evil.hsl`} {
+		if _, err := l.Target(rel); err == nil {
+			t.Errorf("Expected %q to be rejected", rel)
+		}
+	}
+}
+
+func TestRuleValidate(t *testing.T) {
+	valid := Rule{Pattern: "*.rck", Dest: "Labware/Acme"}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected %+v to be valid, got %v", valid, err)
+	}
+	for _, rule := range []Rule{
+		{Pattern: "[bad", Dest: "Library"},
+		{Pattern: "*.rck", Dest: ""},
+		{Pattern: "*.rck", Dest: "../Windows"},
+		{Pattern: "*.rck", Dest: "Labware", Strip: "/abs"},
+	} {
+		if err := rule.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", rule)
+		}
+	}
+}
+
+func TestPlanDetectsCollisions(t *testing.T) {
+	l := New("root", []Rule{{Pattern: "*.rck", Dest: "Labware", Strip: "a"}})
+	_, err := l.Plan([]string{"a/Plate.rck", "Plate.RCK"})
+	if err == nil || !strings.Contains(err.Error(), "both be installed") {
+		t.Errorf("Expected a collision error, got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Position is a line and column in a metadata file, both starting at 1.
+type Position struct {
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.Line == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// document is a decoded metadata file together with the position of every
+// field, keyed by path such as "version", "files[2]" or
+// "dependencies.lib-b", and the keys of its top-level object.
+type document struct {
+	meta      Metadata
+	positions map[string]Position
+	topLevel  []string
+}
+
+func (d *document) position(path string) Position {
+	return d.positions[path]
+}
+
+func decode(filename string, data []byte) (*document, []Problem) {
+	if isYAML(filename) {
+		return decodeYAML(data)
+	}
+	return decodeJSON(data)
+}
+
+func decodeYAML(data []byte) (*document, []Problem) {
+	var root yaml.Node
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, []Problem{yamlProblem(err)}
+	}
+
+	doc := &document{positions: make(map[string]Position)}
+	if len(root.Content) == 0 {
+		return doc, nil
+	}
+	recordYAMLPositions(root.Content[0], "", doc.positions)
+	if root.Content[0].Kind == yaml.MappingNode {
+		for i := 0; i < len(root.Content[0].Content); i += 2 {
+			doc.topLevel = append(doc.topLevel, root.Content[0].Content[i].Value)
+		}
+	}
+
+	if err := root.Content[0].Decode(&doc.meta); err != nil {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			var problems []Problem
+			for _, msg := range typeErr.Errors {
+				problems = append(problems, yamlProblem(errors.New(msg)))
+			}
+			return nil, problems
+		}
+		return nil, []Problem{yamlProblem(err)}
+	}
+	return doc, nil
+}
+
+func recordYAMLPositions(node *yaml.Node, path string, positions map[string]Position) {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			child := key.Value
+			if path != "" {
+				child = path + "." + key.Value
+			}
+			positions[child] = Position{Line: key.Line, Column: key.Column}
+			recordYAMLPositions(value, child, positions)
+		}
+	case yaml.SequenceNode:
+		for i, item := range node.Content {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			positions[child] = Position{Line: item.Line, Column: item.Column}
+			recordYAMLPositions(item, child, positions)
+		}
+	}
+}
+
+var yamlLinePattern = regexp.MustCompile(`line (\d+)`)
+
+func yamlProblem(err error) Problem {
+	p := Problem{Severity: SeverityError, Message: err.Error()}
+	if m := yamlLinePattern.FindStringSubmatch(err.Error()); m != nil {
+		p.Position.Line, _ = strconv.Atoi(m[1])
+	}
+	return p
+}
+
+func decodeJSON(data []byte) (*document, []Problem) {
+	doc := &document{positions: make(map[string]Position)}
+
+	if err := json.Unmarshal(data, &doc.meta); err != nil {
+		p := Problem{Severity: SeverityError, Message: err.Error()}
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			p.Position = offsetPosition(data, int(syntaxErr.Offset))
+		case errors.As(err, &typeErr):
+			p.Field = typeErr.Field
+			p.Position = offsetPosition(data, int(typeErr.Offset))
+			p.Message = fmt.Sprintf("expected %s, got %s", typeErr.Type, typeErr.Value)
+		}
+		return nil, []Problem{p}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if err := recordJSONPositions(dec, data, "", doc.positions, &doc.topLevel); err != nil {
+		return nil, []Problem{{Severity: SeverityError, Message: err.Error()}}
+	}
+	return doc, nil
+}
+
+// recordJSONPositions walks the value at the decoder's position, recording
+// where each object key and array element starts. The keys of the
+// outermost object are appended to topLevel.
+func recordJSONPositions(dec *json.Decoder, data []byte, path string, positions map[string]Position, topLevel *[]string) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		for dec.More() {
+			start := tokenStart(data, int(dec.InputOffset()))
+			keyTok, err := dec.Token()
+			if err != nil {
+				return err
+			}
+			key, _ := keyTok.(string)
+			child := key
+			if path != "" {
+				child = path + "." + key
+			} else if topLevel != nil {
+				*topLevel = append(*topLevel, key)
+			}
+			positions[child] = offsetPosition(data, start)
+			if err := recordJSONPositions(dec, data, child, positions, nil); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+	case json.Delim('['):
+		for i := 0; dec.More(); i++ {
+			child := fmt.Sprintf("%s[%d]", path, i)
+			positions[child] = offsetPosition(data, tokenStart(data, int(dec.InputOffset())))
+			if err := recordJSONPositions(dec, data, child, positions, nil); err != nil {
+				return err
+			}
+		}
+		_, err = dec.Token()
+	}
+	return err
+}
+
+// tokenStart skips the whitespace and separators following offset.
+func tokenStart(data []byte, offset int) int {
+	for offset < len(data) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+func offsetPosition(data []byte, offset int) Position {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	line := 1 + bytes.Count(data[:offset], []byte("\n"))
+	column := offset - bytes.LastIndexByte(data[:offset], '\n')
+	return Position{Line: line, Column: column}
+}
@@ -0,0 +1,124 @@
+package metadata
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/iamgp/hvr/pkg/client/ignore"
+)
+
+// excludeMatcher combines .hvrignore next to the metadata file and the
+// Exclude patterns, the latter taking precedence.
+func (m *Metadata) excludeMatcher() (*ignore.Matcher, error) {
+	matcher := &ignore.Matcher{}
+	if err := matcher.AddFile(filepath.Join(m.BaseDir, ignore.FileName)); err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ignore.FileName, err)
+	}
+	for _, pattern := range m.Exclude {
+		matcher.Add(pattern)
+	}
+	return matcher, nil
+}
+
+// resolveFiles expands the Files patterns to the files they match, leaving
+// out excluded ones.
+func (m *Metadata) resolveFiles() ([]string, error) {
+	excluded, err := m.excludeMatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := cleanPatterns(m.Files)
+	var files []string
+	err = m.walk(excluded, func(rel string) {
+		if m.isPackOutput(rel) {
+			return
+		}
+		for _, pattern := range patterns {
+			if ignore.MatchPattern(pattern, rel) {
+				files = append(files, rel)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(files)
+	return files, nil
+}
+
+// isPackOutput reports whether rel is an archive hvr pack wrote next to the
+// metadata file under its default name, <name>-<version>.zip, so that
+// packing again doesn't include an earlier archive of the library.
+func (m *Metadata) isPackOutput(rel string) bool {
+	version, ok := strings.CutPrefix(rel, m.Name+"-")
+	if !ok {
+		return false
+	}
+	version, ok = strings.CutSuffix(version, ".zip")
+	if !ok {
+		return false
+	}
+	_, err := semver.NewVersion(version)
+	return err == nil
+}
+
+// cleanPatterns returns patterns with "./" prefixes and other redundant
+// elements removed, as paths are compared without them.
+func cleanPatterns(patterns []string) []string {
+	cleaned := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		cleaned[i] = path.Clean(pattern)
+	}
+	return cleaned
+}
+
+// countMatches walks BaseDir once and returns how many files each pattern
+// matches, ignoring exclusions. Empty patterns match nothing.
+func (m *Metadata) countMatches(patterns []string) ([]int, error) {
+	counts := make([]int, len(patterns))
+	err := m.walk(nil, func(rel string) {
+		for i, pattern := range patterns {
+			if pattern != "" && ignore.MatchPattern(pattern, rel) {
+				counts[i]++
+			}
+		}
+	})
+	return counts, err
+}
+
+// walk calls fn with the slash separated path, relative to BaseDir, of every
+// file that isn't excluded. Excluded directories are not entered.
+func (m *Metadata) walk(excluded *ignore.Matcher, fn func(rel string)) error {
+	return filepath.WalkDir(m.BaseDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == m.BaseDir {
+			return nil
+		}
+		rel, err := filepath.Rel(m.BaseDir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if excluded.Match(rel, d.IsDir()) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			fn(rel)
+		}
+		return nil
+	})
+}
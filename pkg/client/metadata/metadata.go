@@ -1,43 +1,112 @@
 package metadata
 
 import (
-	"encoding/json"
-	"io/ioutil"
+	"errors"
+	"os"
 	"path/filepath"
+	"strings"
+
+	"github.com/iamgp/hvr/pkg/client/layout"
 )
 
+// CurrentSchemaVersion is the newest metadata schema this client understands.
+// Files without a schema_version are treated as version 1.
+const CurrentSchemaVersion = 1
+
 type Metadata struct {
-	Name         string            `json:"name"`
-	Version      string            `json:"version"`
-	Description  string            `json:"description"`
-	Author       string            `json:"author"`
-	RepoURL      string            `json:"repo_url"`
-	Files        []string          `json:"files"`
-	Dependencies map[string]string `json:"dependencies"`
+	SchemaVersion int               `json:"schema_version,omitempty" yaml:"schema_version,omitempty"`
+	Name          string            `json:"name" yaml:"name"`
+	Version       string            `json:"version" yaml:"version"`
+	Description   string            `json:"description" yaml:"description"`
+	Author        string            `json:"author" yaml:"author"`
+	RepoURL       string            `json:"repo_url" yaml:"repo_url"`
+	Files         []string          `json:"files" yaml:"files"`
+	Exclude       []string          `json:"exclude,omitempty" yaml:"exclude,omitempty"`
+	Dependencies  map[string]string `json:"dependencies" yaml:"dependencies"`
+	Install       []layout.Rule     `json:"install,omitempty" yaml:"install,omitempty"`
+
+	// BaseDir is the directory of the metadata file. Files patterns are
+	// resolved relative to it.
+	BaseDir string `json:"-" yaml:"-"`
 }
 
+// LocalPath returns the path on disk of a file listed in Files.
+func (m *Metadata) LocalPath(file string) string {
+	return filepath.Join(m.BaseDir, filepath.FromSlash(file))
+}
+
+// ParseMetadataFile reads and validates a JSON or YAML metadata file and
+// resolves the glob patterns in Files to sorted, slash separated paths
+// relative to the metadata file, leaving out anything matched by .hvrignore
+// or the Exclude patterns. It fails if the file has any validation errors;
+// warnings are ignored.
 func ParseMetadataFile(filename string) (*Metadata, error) {
-	data, err := ioutil.ReadFile(filename)
+	meta, problems, err := Load(filename)
 	if err != nil {
 		return nil, err
 	}
+	if errs := Errors(problems); len(errs) > 0 {
+		return nil, &ValidationError{Problems: errs}
+	}
 
-	var meta Metadata
-	err = json.Unmarshal(data, &meta)
+	files, err := meta.resolveFiles()
 	if err != nil {
 		return nil, err
 	}
+	meta.Files = files
 
-	// Resolve glob patterns in Files
-	var resolvedFiles []string
-	for _, pattern := range meta.Files {
-		matches, err := filepath.Glob(pattern)
-		if err != nil {
-			return nil, err
-		}
-		resolvedFiles = append(resolvedFiles, matches...)
+	return meta, nil
+}
+
+// Load reads a metadata file and validates it against the schema, returning
+// every problem found. The error is only set when the file cannot be read at
+// all.
+func Load(filename string) (*Metadata, []Problem, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	doc, problems := decode(filename, data)
+	if doc != nil {
+		doc.meta.BaseDir = filepath.Dir(filename)
+		problems = append(problems, validate(doc)...)
+	}
+	for i := range problems {
+		problems[i].File = filename
 	}
-	meta.Files = resolvedFiles
+	sortProblems(problems)
 
-	return &meta, nil
+	if doc == nil {
+		return nil, problems, nil
+	}
+	return &doc.meta, problems, nil
+}
+
+// ValidationError is returned by ParseMetadataFile for invalid files.
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.String()
+	}
+	return "invalid metadata:\n  " + strings.Join(msgs, "\n  ")
+}
+
+// IsValidationError reports whether err is caused by an invalid metadata
+// file.
+func IsValidationError(err error) bool {
+	var v *ValidationError
+	return errors.As(err, &v)
+}
+
+func isYAML(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return true
+	}
+	return false
 }
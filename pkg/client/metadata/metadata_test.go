@@ -0,0 +1,183 @@
+package metadata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoadReportsAllProblems(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "library_meta.json", `{
+  "name": "My Library",
+  "version": "1.0",
+  "repo_url": "not a url",
+  "files": ["*.nothing", "[bad"],
+  "dependencies": {
+    "lib-b": "^2.0.0",
+    "lib-c": "not-a-constraint"
+  },
+  "licence": "MIT",
+  "build.tool": "make"
+}`)
+
+	_, problems, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	want := []string{
+		":2:3: error: name:",
+		":3:3: error: version:",
+		":4:3: error: repo_url:",
+		":5:13: warning: files[0]:",
+		":5:26: error: files[1]:",
+		":8:5: error: dependencies.lib-c:",
+		":10:3: warning: licence: unknown field",
+		":11:3: warning: build.tool: unknown field",
+	}
+	if len(problems) != len(want) {
+		t.Fatalf("Expected %d problems, got %d: %v", len(want), len(problems), problems)
+	}
+	for i, w := range want {
+		if !strings.Contains(problems[i].String(), w) {
+			t.Errorf("Problem %d: expected %q in %q", i, w, problems[i].String())
+		}
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "lib.hsl", "")
+	path := writeFile(t, dir, "library_meta.yaml", `schema_version: 1
+name: plate-utils
+version: 1.2.0
+repo_url: https://example.com/plate-utils
+files:
+  - "*.hsl"
+dependencies:
+  logging: ">=2.0.0, <3.0.0"
+  bad: "~~1"
+tags[0]: pipetting
+`)
+
+	meta, problems, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if meta.Name != "plate-utils" || meta.RepoURL != "https://example.com/plate-utils" {
+		t.Errorf("Unexpected metadata: %+v", meta)
+	}
+	if len(problems) != 2 || problems[0].Position.Line != 9 || problems[0].Field != "dependencies.bad" {
+		t.Fatalf("Expected problems for dependencies.bad on line 9 and tags[0], got %v", problems)
+	}
+	if problems[1].Field != "tags[0]" || problems[1].Message != "unknown field" {
+		t.Errorf("Expected the top-level key tags[0] to be unknown, got %v", problems[1])
+	}
+}
+
+func TestParseMetadataFileRejectsInvalid(t *testing.T) {
+	dir := t.TempDir()
+	path := writeFile(t, dir, "library_meta.json", `{"name": "lib", "version": 2, "files": ["x"]}`)
+
+	_, err := ParseMetadataFile(path)
+	if !IsValidationError(err) {
+		t.Fatalf("Expected validation error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "library_meta.json:1:") {
+		t.Errorf("Expected position in error, got %q", err.Error())
+	}
+}
+
+func TestParseMetadataFileExcludes(t *testing.T) {
+	dir := t.TempDir()
+	for _, sub := range []string{"library/helpers", "library/Backup"} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", sub, err)
+		}
+	}
+	writeFile(t, dir, "library/main.hsl", "")
+	writeFile(t, dir, "library/helpers/util.hsl", "")
+	writeFile(t, dir, "library/helpers/util.hsl.bak", "")
+	writeFile(t, dir, "library/Backup/old.hsl", "")
+	writeFile(t, dir, "library/Backup/keep.hsl", "")
+	writeFile(t, dir, "library/scratch.hsl", "")
+	writeFile(t, dir, ".hvrignore", "# editor leftovers\n*.bak\n/library/scratch.hsl\n")
+	path := writeFile(t, dir, "library_meta.json", `{
+  "name": "lib-a",
+  "version": "1.0.0",
+  "files": ["library/**"],
+  "exclude": ["Backup/"]
+}`)
+
+	meta, err := ParseMetadataFile(path)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	want := []string{"library/helpers/util.hsl", "library/main.hsl"}
+	if strings.Join(meta.Files, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected files %v, got %v", want, meta.Files)
+	}
+}
+
+func TestParseMetadataFileExcludesPackOutputs(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, dir, "main.hsl", "")
+	writeFile(t, dir, "lib-a-1.0.0.zip", "")
+	writeFile(t, dir, "lib-a-0.9.0.zip", "")
+	writeFile(t, dir, "samples.zip", "")
+	path := writeFile(t, dir, "library_meta.json", `{
+  "name": "lib-a",
+  "version": "1.1.0",
+  "files": ["**"]
+}`)
+
+	meta, err := ParseMetadataFile(path)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	want := []string{"library_meta.json", "main.hsl", "samples.zip"}
+	if strings.Join(meta.Files, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected files %v, got %v", want, meta.Files)
+	}
+}
+
+func TestParseMetadataFileCleansPatterns(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "src"), 0755)
+	writeFile(t, dir, "src/main.hsl", "")
+	path := writeFile(t, dir, "library_meta.json", `{
+  "name": "lib-a",
+  "version": "1.0.0",
+  "files": ["./src/*.hsl", "src/../../other/*.hsl"]
+}`)
+
+	_, problems, err := Load(path)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if len(problems) != 1 || problems[0].Field != "files[1]" || problems[0].Severity != SeverityError {
+		t.Fatalf("Expected only files[1] to be rejected, got %v", problems)
+	}
+
+	writeFile(t, dir, "library_meta.json", `{"name": "lib-a", "version": "1.0.0", "files": ["./src/*.hsl"]}`)
+	meta, err := ParseMetadataFile(path)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if strings.Join(meta.Files, ",") != "src/main.hsl" {
+		t.Errorf("Expected ./src/*.hsl to match src/main.hsl, got %v", meta.Files)
+	}
+}
@@ -0,0 +1,198 @@
+package metadata
+
+import (
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/iamgp/hvr/pkg/client/ignore"
+)
+
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Problem is a single schema violation in a metadata file.
+type Problem struct {
+	File     string
+	Position Position
+	Field    string
+	Severity Severity
+	Message  string
+}
+
+func (p Problem) String() string {
+	loc := p.File
+	if pos := p.Position.String(); pos != "" {
+		loc += ":" + pos
+	}
+	msg := p.Message
+	if p.Field != "" {
+		msg = p.Field + ": " + msg
+	}
+	if loc == "" {
+		return fmt.Sprintf("%s: %s", p.Severity, msg)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, p.Severity, msg)
+}
+
+// Errors returns the problems with error severity.
+func Errors(problems []Problem) []Problem {
+	var errs []Problem
+	for _, p := range problems {
+		if p.Severity == SeverityError {
+			errs = append(errs, p)
+		}
+	}
+	return errs
+}
+
+// namePattern restricts library names to lower case so that names can't
+// collide on case-insensitive Windows file systems.
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+const maxNameLength = 64
+
+var knownFields = map[string]bool{
+	"schema_version": true,
+	"name":           true,
+	"version":        true,
+	"description":    true,
+	"author":         true,
+	"repo_url":       true,
+	"files":          true,
+	"exclude":        true,
+	"install":        true,
+	"dependencies":   true,
+}
+
+func validate(doc *document) []Problem {
+	var problems []Problem
+	meta := &doc.meta
+
+	report := func(severity Severity, field, format string, args ...interface{}) {
+		problems = append(problems, Problem{
+			Position: doc.position(field),
+			Field:    field,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, field := range doc.topLevel {
+		if !knownFields[field] {
+			report(SeverityWarning, field, "unknown field")
+		}
+	}
+
+	if meta.SchemaVersion < 0 || meta.SchemaVersion > CurrentSchemaVersion {
+		report(SeverityError, "schema_version", "unsupported schema version %d (this client supports up to %d)", meta.SchemaVersion, CurrentSchemaVersion)
+	}
+
+	if err := checkName(meta.Name); err != nil {
+		report(SeverityError, "name", "%v", err)
+	}
+
+	if meta.Version == "" {
+		report(SeverityError, "version", "is required")
+	} else if _, err := semver.StrictNewVersion(meta.Version); err != nil {
+		report(SeverityError, "version", "%q is not a semantic version (MAJOR.MINOR.PATCH)", meta.Version)
+	}
+
+	if meta.RepoURL != "" {
+		if u, err := url.Parse(meta.RepoURL); err != nil || !u.IsAbs() {
+			report(SeverityError, "repo_url", "%q is not an absolute URL", meta.RepoURL)
+		}
+	}
+
+	for dep, constraint := range meta.Dependencies {
+		field := "dependencies." + dep
+		if err := checkName(dep); err != nil {
+			report(SeverityError, field, "invalid dependency name: %v", err)
+		}
+		if dep == meta.Name {
+			report(SeverityError, field, "library cannot depend on itself")
+		}
+		if _, err := semver.NewConstraint(constraint); err != nil {
+			report(SeverityError, field, "invalid version constraint %q: %v", constraint, err)
+		}
+	}
+
+	if len(meta.Files) == 0 {
+		report(SeverityError, "files", "at least one file pattern is required")
+	}
+	// Valid patterns are matched in a single walk of the library directory.
+	patterns := cleanPatterns(meta.Files)
+	for i, pattern := range meta.Files {
+		if err := checkPattern(pattern); err != nil {
+			report(SeverityError, fmt.Sprintf("files[%d]", i), "%v", err)
+			patterns[i] = ""
+		}
+	}
+	counts, err := meta.countMatches(patterns)
+	if err != nil {
+		report(SeverityError, "files", "%v", err)
+	}
+	for i, pattern := range meta.Files {
+		if err == nil && patterns[i] != "" && counts[i] == 0 {
+			report(SeverityWarning, fmt.Sprintf("files[%d]", i), "pattern %q matches no files", pattern)
+		}
+	}
+
+	for i, pattern := range meta.Exclude {
+		if err := checkPattern(strings.TrimPrefix(pattern, "!")); err != nil {
+			report(SeverityError, fmt.Sprintf("exclude[%d]", i), "%v", err)
+		}
+	}
+
+	for i, rule := range meta.Install {
+		if err := rule.Validate(); err != nil {
+			report(SeverityError, fmt.Sprintf("install[%d]", i), "%v", err)
+		}
+	}
+
+	return problems
+}
+
+func checkPattern(pattern string) error {
+	cleaned := path.Clean(pattern)
+	switch {
+	case !ignore.ValidPattern(pattern):
+		return fmt.Errorf("invalid glob pattern %q", pattern)
+	case filepath.IsAbs(pattern) || strings.HasPrefix(pattern, "/"):
+		return fmt.Errorf("pattern %q must be relative to the metadata file", pattern)
+	case cleaned == ".." || strings.HasPrefix(cleaned, "../"):
+		return fmt.Errorf("pattern %q points outside the metadata file's directory", pattern)
+	}
+	return nil
+}
+
+func checkName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("is required")
+	case len(name) > maxNameLength:
+		return fmt.Errorf("%q is longer than %d characters", name, maxNameLength)
+	case !namePattern.MatchString(name):
+		return fmt.Errorf("%q must contain only lower case letters, digits, '.', '-' and '_' and start with a letter or digit", name)
+	}
+	return nil
+}
+
+func sortProblems(problems []Problem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		a, b := problems[i].Position, problems[j].Position
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+}
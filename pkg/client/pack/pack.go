@@ -0,0 +1,161 @@
+package pack
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"time"
+
+	"github.com/iamgp/hvr/pkg/client/layout"
+	"github.com/iamgp/hvr/pkg/client/metadata"
+)
+
+// ManifestName is the archive entry describing the packed files.
+const ManifestName = "hvr-manifest.json"
+
+// fixedModTime is written for every archive entry so that packing the same
+// files twice gives the same bytes. It is the earliest time a zip archive can
+// represent.
+var fixedModTime = time.Date(1980, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type Options struct {
+	// PreserveModTimes records each file's modification time in the
+	// manifest. The archive is then only reproducible while the times stay
+	// the same.
+	PreserveModTimes bool
+}
+
+// Manifest lists the files of a packed library and the package's install
+// rules.
+type Manifest struct {
+	Name    string         `json:"name"`
+	Version string         `json:"version"`
+	Files   []ManifestFile `json:"files"`
+	Install []layout.Rule  `json:"install,omitempty"`
+}
+
+type ManifestFile struct {
+	Path    string `json:"path"`
+	Size    int64  `json:"size"`
+	SHA256  string `json:"sha256"`
+	ModTime string `json:"mod_time,omitempty"`
+}
+
+// Write packs the files of meta, as resolved by metadata.ParseMetadataFile,
+// into a zip archive. Entries are stored under their path relative to the
+// metadata file, in sorted order, with a fixed timestamp, followed by the
+// manifest. Identical inputs always give byte-identical archives.
+func Write(w io.Writer, meta *metadata.Metadata, opts Options) (*Manifest, error) {
+	zipWriter := zip.NewWriter(w)
+	manifest := &Manifest{Name: meta.Name, Version: meta.Version, Install: meta.Install}
+
+	for _, rel := range meta.Files {
+		entry, err := addFile(zipWriter, meta.LocalPath(rel), rel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to add %s: %w", rel, err)
+		}
+		if !opts.PreserveModTimes {
+			entry.ModTime = ""
+		}
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	writer, err := zipWriter.CreateHeader(entryHeader(ManifestName))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := writer.Write(data); err != nil {
+		return nil, err
+	}
+
+	if err := zipWriter.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// WriteFile packs meta into the archive at path and returns its SHA-256.
+func WriteFile(path string, meta *metadata.Metadata, opts Options) (*Manifest, string, error) {
+	out, err := os.Create(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer out.Close()
+
+	hasher := sha256.New()
+	manifest, err := Write(io.MultiWriter(out, hasher), meta, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	return manifest, hex.EncodeToString(hasher.Sum(nil)), out.Close()
+}
+
+func addFile(zipWriter *zip.Writer, localPath, name string) (ManifestFile, error) {
+	file, err := os.Open(localPath)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return ManifestFile{}, err
+	}
+
+	writer, err := zipWriter.CreateHeader(entryHeader(name))
+	if err != nil {
+		return ManifestFile{}, err
+	}
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(writer, hasher), file)
+	if err != nil {
+		return ManifestFile{}, err
+	}
+
+	return ManifestFile{
+		Path:    name,
+		Size:    size,
+		SHA256:  hex.EncodeToString(hasher.Sum(nil)),
+		ModTime: info.ModTime().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func entryHeader(name string) *zip.FileHeader {
+	header := &zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: fixedModTime,
+	}
+	header.SetMode(0644)
+	return header
+}
+
+// ReadManifest returns the manifest of a packed archive, or nil if the
+// archive has none, as is the case for archives uploaded without hvr pack.
+func ReadManifest(zr *zip.Reader) (*Manifest, error) {
+	file, err := zr.Open(ManifestName)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	manifest := &Manifest{}
+	if err := json.NewDecoder(file).Decode(manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", ManifestName, err)
+	}
+	return manifest, nil
+}
@@ -0,0 +1,62 @@
+package pack
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/iamgp/hvr/pkg/client/metadata"
+)
+
+func TestWriteIsDeterministic(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "lib", "sub"), 0755)
+	os.WriteFile(filepath.Join(dir, "lib", "Main.hsl"), []byte("main"), 0644)
+	os.WriteFile(filepath.Join(dir, "lib", "sub", "Helper.hs_"), []byte("helper"), 0644)
+	os.WriteFile(filepath.Join(dir, "lib", "Main.hsl.bak"), []byte("old"), 0644)
+	os.WriteFile(filepath.Join(dir, "lib", ".hvrignore"), []byte("# editor backups\n*.bak\n"), 0644)
+	metaFile := filepath.Join(dir, "lib", "library_meta.json")
+	os.WriteFile(metaFile, []byte(`{"name": "lib", "version": "1.0.0", "files": ["sub/*", "*.hsl*"]}`), 0644)
+
+	pack := func() []byte {
+		meta, err := metadata.ParseMetadataFile(metaFile)
+		if err != nil {
+			t.Fatalf("Failed to parse metadata: %v", err)
+		}
+		buf := new(bytes.Buffer)
+		if _, err := Write(buf, meta, Options{}); err != nil {
+			t.Fatalf("Failed to pack: %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	first := pack()
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(dir, "lib", "Main.hsl"), later, later)
+	second := pack()
+
+	if !bytes.Equal(first, second) {
+		t.Errorf("Expected identical archives for identical inputs")
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(first), int64(len(first)))
+	if err != nil {
+		t.Fatalf("Failed to read archive: %v", err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := []string{"Main.hsl", "sub/Helper.hs_", ManifestName}
+	if len(names) != len(want) {
+		t.Fatalf("Expected entries %v, got %v", want, names)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("Expected entries %v, got %v", want, names)
+		}
+	}
+}
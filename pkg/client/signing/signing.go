@@ -0,0 +1,152 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Policy controls how the client treats package signatures.
+type Policy string
+
+const (
+	// PolicyOff skips signature verification entirely.
+	PolicyOff Policy = "off"
+	// PolicyWarn rejects bad signatures but only warns about missing or
+	// untrusted ones.
+	PolicyWarn Policy = "warn"
+	// PolicyRequire rejects any package without a valid signature from a
+	// trusted key.
+	PolicyRequire Policy = "require"
+)
+
+var (
+	ErrMissingSignature = errors.New("package is not signed")
+	ErrUntrustedKey     = errors.New("package is signed by an untrusted key")
+	ErrBadSignature     = errors.New("package signature is invalid")
+)
+
+func ParsePolicy(s string) (Policy, error) {
+	switch Policy(s) {
+	case "":
+		return PolicyWarn, nil
+	case PolicyOff, PolicyWarn, PolicyRequire:
+		return Policy(s), nil
+	}
+	return "", fmt.Errorf("unknown signature policy %q (want off, warn or require)", s)
+}
+
+func GenerateKey() (ed25519.PublicKey, ed25519.PrivateKey, error) {
+	return ed25519.GenerateKey(rand.Reader)
+}
+
+// WriteKeyPair writes the private key as PEM to base+".key" and the encoded
+// public key to base+".pub".
+func WriteKeyPair(base string, pub ed25519.PublicKey, priv ed25519.PrivateKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		return fmt.Errorf("failed to encode private key: %w", err)
+	}
+	block := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+
+	if err := os.WriteFile(base+".key", block, 0600); err != nil {
+		return err
+	}
+	return os.WriteFile(base+".pub", []byte(EncodePublicKey(pub)+"\n"), 0644)
+}
+
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s does not contain a PEM private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	priv, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an ed25519 key", path)
+	}
+	return priv, nil
+}
+
+func EncodePublicKey(pub ed25519.PublicKey) string {
+	return base64.StdEncoding.EncodeToString(pub)
+}
+
+func DecodePublicKey(s string) (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key encoding: %w", err)
+	}
+	if len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key length %d", len(raw))
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// KeyID returns a short fingerprint of a public key for display.
+func KeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// Sign returns the base64 encoded signature of data.
+func Sign(priv ed25519.PrivateKey, data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(priv, data))
+}
+
+// Keyring is the set of publisher keys the client trusts.
+type Keyring struct {
+	names map[string]string
+}
+
+func NewKeyring() *Keyring {
+	return &Keyring{names: make(map[string]string)}
+}
+
+func (k *Keyring) Add(name, publicKey string) error {
+	pub, err := DecodePublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("trusted key %s: %w", name, err)
+	}
+	k.names[EncodePublicKey(pub)] = name
+	return nil
+}
+
+// Verify checks signature over data against publicKey and returns the name of
+// the trusted key that produced it.
+func (k *Keyring) Verify(publicKey, signature string, data []byte) (string, error) {
+	if signature == "" {
+		return "", ErrMissingSignature
+	}
+	pub, err := DecodePublicKey(publicKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrBadSignature, err)
+	}
+	if !ed25519.Verify(pub, data, sig) {
+		return "", ErrBadSignature
+	}
+	name, ok := k.names[EncodePublicKey(pub)]
+	if !ok {
+		return "", fmt.Errorf("%w (key %s)", ErrUntrustedKey, KeyID(pub))
+	}
+	return name, nil
+}
@@ -0,0 +1,61 @@
+package signing
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	pub, priv, err := GenerateKey()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	base := filepath.Join(t.TempDir(), "publisher")
+	if err := WriteKeyPair(base, pub, priv); err != nil {
+		t.Fatalf("Failed to write key pair: %v", err)
+	}
+	loaded, err := LoadPrivateKey(base + ".key")
+	if err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+
+	data := []byte("library archive contents")
+	sig := Sign(loaded, data)
+
+	keyring := NewKeyring()
+	if err := keyring.Add("publisher", EncodePublicKey(pub)); err != nil {
+		t.Fatalf("Failed to add trusted key: %v", err)
+	}
+
+	name, err := keyring.Verify(EncodePublicKey(pub), sig, data)
+	if err != nil {
+		t.Fatalf("Expected signature to verify, got %v", err)
+	}
+	if name != "publisher" {
+		t.Errorf("Expected signer 'publisher', got '%s'", name)
+	}
+
+	if _, err := keyring.Verify(EncodePublicKey(pub), sig, []byte("tampered")); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected ErrBadSignature for tampered data, got %v", err)
+	}
+
+	if _, err := keyring.Verify(EncodePublicKey(pub), "", data); !errors.Is(err, ErrMissingSignature) {
+		t.Errorf("Expected ErrMissingSignature, got %v", err)
+	}
+
+	otherPub, otherPriv, _ := GenerateKey()
+	if _, err := keyring.Verify(EncodePublicKey(otherPub), Sign(otherPriv, data), data); !errors.Is(err, ErrUntrustedKey) {
+		t.Errorf("Expected ErrUntrustedKey, got %v", err)
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	if p, err := ParsePolicy(""); err != nil || p != PolicyWarn {
+		t.Errorf("Expected empty policy to default to warn, got %q, %v", p, err)
+	}
+	if _, err := ParsePolicy("strict"); err == nil {
+		t.Errorf("Expected error for unknown policy")
+	}
+}
@@ -0,0 +1,190 @@
+// Package state records which packages are installed in a Hamilton
+// installation tree and which files each of them wrote.
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Dir is the folder below the installation root where hvr keeps its state.
+const Dir = ".hvr"
+
+// FileName is the install state file inside Dir.
+const FileName = "installed.json"
+
+// State lists the packages installed below an installation root.
+type State struct {
+	Packages []Package `json:"packages"`
+}
+
+// Package is an installed package. Hash is the SHA-256 of the archive it was
+// installed from.
+type Package struct {
+	Name        string    `json:"name"`
+	Version     string    `json:"version"`
+	Hash        string    `json:"hash"`
+	InstalledAt time.Time `json:"installed_at"`
+	Files       []File    `json:"files"`
+}
+
+// File is a file written by a package. Path is slash separated and relative
+// to the installation root.
+type File struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Path returns the location of the state file for root.
+func Path(root string) string {
+	return filepath.Join(root, Dir, FileName)
+}
+
+// Load reads the state of root. A missing state file means nothing is
+// installed.
+func Load(root string) (*State, error) {
+	data, err := os.ReadFile(Path(root))
+	if errors.Is(err, os.ErrNotExist) {
+		return &State{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s := &State{}
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, fmt.Errorf("invalid install state %s: %w", Path(root), err)
+	}
+	return s, nil
+}
+
+// Marshal encodes the state as it is stored in the state file.
+func (s *State) Marshal() ([]byte, error) {
+	sort.Slice(s.Packages, func(i, j int) bool { return s.Packages[i].Name < s.Packages[j].Name })
+	return json.MarshalIndent(s, "", "  ")
+}
+
+// RelPath is the location of the state file relative to the installation
+// root, slash separated.
+const RelPath = Dir + "/" + FileName
+
+// Save writes the state of root, replacing the previous state file
+// atomically.
+func (s *State) Save(root string) error {
+	data, err := s.Marshal()
+	if err != nil {
+		return err
+	}
+
+	path := Path(root)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), FileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Find returns the installed package called name, or nil.
+func (s *State) Find(name string) *Package {
+	for i := range s.Packages {
+		if s.Packages[i].Name == name {
+			return &s.Packages[i]
+		}
+	}
+	return nil
+}
+
+// Put records pkg, replacing any earlier install of the same package.
+func (s *State) Put(pkg Package) {
+	if existing := s.Find(pkg.Name); existing != nil {
+		*existing = pkg
+		return
+	}
+	s.Packages = append(s.Packages, pkg)
+}
+
+// Remove forgets the package called name.
+func (s *State) Remove(name string) {
+	for i := range s.Packages {
+		if s.Packages[i].Name == name {
+			s.Packages = append(s.Packages[:i], s.Packages[i+1:]...)
+			return
+		}
+	}
+}
+
+// Owners returns the packages other than except that own the file at path.
+// Paths are compared without case, as Windows does.
+func (s *State) Owners(path, except string) []*Package {
+	var owners []*Package
+	for i := range s.Packages {
+		pkg := &s.Packages[i]
+		if pkg.Name == except {
+			continue
+		}
+		if pkg.File(path) != nil {
+			owners = append(owners, pkg)
+		}
+	}
+	return owners
+}
+
+// File returns the package's record of the file at path, or nil.
+func (p *Package) File(path string) *File {
+	for i := range p.Files {
+		if strings.EqualFold(p.Files[i].Path, path) {
+			return &p.Files[i]
+		}
+	}
+	return nil
+}
+
+// Modified reports whether the file below root no longer has the content
+// that was installed. A file that has been deleted is not modified.
+func (f File) Modified(root string) (bool, error) {
+	hash, err := HashFile(filepath.Join(root, filepath.FromSlash(f.Path)))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return hash != f.SHA256, nil
+}
+
+// HashFile returns the hex SHA-256 of a file.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
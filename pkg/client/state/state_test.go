@@ -0,0 +1,71 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	root := t.TempDir()
+
+	st, err := Load(root)
+	if err != nil {
+		t.Fatalf("Failed to load empty state: %v", err)
+	}
+	if len(st.Packages) != 0 {
+		t.Fatalf("Expected no packages, got %+v", st.Packages)
+	}
+
+	st.Put(Package{Name: "lib-b", Version: "1.0.0", Files: []File{{Path: "Library/Shared.hsl", SHA256: "aa"}}})
+	st.Put(Package{Name: "lib-a", Version: "1.0.0", Files: []File{{Path: "Library/lib-a.hsl", SHA256: "bb"}, {Path: "Library/Shared.hsl", SHA256: "aa"}}})
+	st.Put(Package{Name: "lib-a", Version: "1.1.0", Files: []File{{Path: "Library/lib-a.hsl", SHA256: "cc"}, {Path: "Library/Shared.hsl", SHA256: "aa"}}})
+	if err := st.Save(root); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	loaded, err := Load(root)
+	if err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if len(loaded.Packages) != 2 || loaded.Packages[0].Name != "lib-a" || loaded.Packages[0].Version != "1.1.0" {
+		t.Fatalf("Unexpected packages: %+v", loaded.Packages)
+	}
+
+	owners := loaded.Owners("library/shared.HSL", "lib-a")
+	if len(owners) != 1 || owners[0].Name != "lib-b" {
+		t.Errorf("Expected lib-b to own the shared file, got %+v", owners)
+	}
+
+	loaded.Remove("lib-b")
+	if loaded.Find("lib-b") != nil || len(loaded.Owners("Library/Shared.hsl", "lib-a")) != 0 {
+		t.Errorf("Expected lib-b to be removed")
+	}
+}
+
+func TestModified(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "Library", "lib-a.hsl")
+	os.MkdirAll(filepath.Dir(path), 0755)
+	os.WriteFile(path, []byte("original"), 0644)
+
+	hash, err := HashFile(path)
+	if err != nil {
+		t.Fatalf("Failed to hash: %v", err)
+	}
+	f := File{Path: "Library/lib-a.hsl", SHA256: hash}
+
+	if modified, err := f.Modified(root); err != nil || modified {
+		t.Errorf("Expected unmodified file, got %v, %v", modified, err)
+	}
+
+	os.WriteFile(path, []byte("edited"), 0644)
+	if modified, err := f.Modified(root); err != nil || !modified {
+		t.Errorf("Expected modified file, got %v, %v", modified, err)
+	}
+
+	os.Remove(path)
+	if modified, err := f.Modified(root); err != nil || modified {
+		t.Errorf("Expected a deleted file not to count as modified, got %v, %v", modified, err)
+	}
+}
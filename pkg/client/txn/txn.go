@@ -0,0 +1,399 @@
+// Package txn applies changes to a Hamilton installation tree atomically.
+//
+// New files are staged and verified below the installation root first. On
+// commit every file about to be replaced or deleted is moved to a backup
+// folder before the staged files are moved into place, and a journal records
+// each step. A commit that fails is undone from the backups straight away;
+// one interrupted by a crash is undone by Rollback, which also undoes the most
+// recent successful transaction.
+package txn
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Dir is the folder below the installation root holding the journals,
+// staged files and backups of recent transactions.
+const Dir = ".hvr/transactions"
+
+// MaxHistory is the number of committed transactions kept for rollback.
+const MaxHistory = 5
+
+const journalName = "journal.json"
+
+// Transaction states recorded in the journal.
+const (
+	StatusPending    = "pending"
+	StatusCommitting = "committing"
+	StatusCommitted  = "committed"
+)
+
+var (
+	// ErrInterrupted is returned by Begin while an earlier commit was
+	// interrupted and has not been rolled back.
+	ErrInterrupted = errors.New("an earlier install was interrupted; run hvr rollback to restore the previous files")
+
+	// ErrNothingToRollBack is returned by Rollback when there is no
+	// transaction to undo.
+	ErrNothingToRollBack = errors.New("nothing to roll back")
+)
+
+// Journal describes a transaction and every file it changes.
+type Journal struct {
+	ID          string    `json:"id"`
+	Description string    `json:"description"`
+	Started     time.Time `json:"started"`
+	Status      string    `json:"status"`
+	Changes     []Change  `json:"changes"`
+}
+
+// Change is a file written or deleted by a transaction. Path is slash
+// separated and relative to the installation root. Existed records whether
+// there was a file to back up before the transaction.
+type Change struct {
+	Path    string `json:"path"`
+	Delete  bool   `json:"delete,omitempty"`
+	SHA256  string `json:"sha256,omitempty"`
+	Existed bool   `json:"existed"`
+}
+
+// Transaction is a set of file changes being prepared for one commit.
+type Transaction struct {
+	root    string
+	dir     string
+	journal Journal
+	changes map[string]int
+	done    bool
+}
+
+// Begin starts a transaction below root. Transactions that were staged but
+// never committed are discarded; an interrupted commit must be rolled back
+// first.
+func Begin(root, description string) (*Transaction, error) {
+	journals, err := List(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, j := range journals {
+		switch j.Status {
+		case StatusCommitting:
+			return nil, ErrInterrupted
+		case StatusPending:
+			if err := os.RemoveAll(transactionDir(root, j.ID)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	now := time.Now().UTC()
+	t := &Transaction{
+		root: root,
+		journal: Journal{
+			ID:          now.Format("20060102T150405.000000000Z"),
+			Description: description,
+			Started:     now,
+			Status:      StatusPending,
+		},
+		changes: make(map[string]int),
+	}
+	t.dir = transactionDir(root, t.journal.ID)
+	if err := os.MkdirAll(t.dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create transaction: %w", err)
+	}
+	if err := t.saveJournal(); err != nil {
+		os.RemoveAll(t.dir)
+		return nil, err
+	}
+	return t, nil
+}
+
+// Write stages data to be written to path on commit.
+func (t *Transaction) Write(path string, data []byte) error {
+	staged := t.stagedPath(path)
+	if err := os.MkdirAll(filepath.Dir(staged), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(staged, data, 0644); err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	t.record(Change{Path: path, SHA256: hex.EncodeToString(sum[:])})
+	return nil
+}
+
+// Delete stages the removal of path on commit.
+func (t *Transaction) Delete(path string) {
+	os.Remove(t.stagedPath(path))
+	t.record(Change{Path: path, Delete: true})
+}
+
+// Empty reports whether the transaction changes nothing.
+func (t *Transaction) Empty() bool {
+	return len(t.journal.Changes) == 0
+}
+
+func (t *Transaction) record(c Change) {
+	if i, ok := t.changes[c.Path]; ok {
+		t.journal.Changes[i] = c
+		return
+	}
+	t.changes[c.Path] = len(t.journal.Changes)
+	t.journal.Changes = append(t.journal.Changes, c)
+}
+
+// Commit verifies the staged files and applies every change. If a change
+// fails, the changes already applied are undone before the error is
+// returned.
+func (t *Transaction) Commit() error {
+	if t.done {
+		return fmt.Errorf("transaction %s already finished", t.journal.ID)
+	}
+	t.done = true
+
+	for _, c := range t.journal.Changes {
+		if c.Delete {
+			continue
+		}
+		if err := verifyFile(t.stagedPath(c.Path), c.SHA256); err != nil {
+			os.RemoveAll(t.dir)
+			return fmt.Errorf("staged file %s failed verification: %w", c.Path, err)
+		}
+	}
+
+	for i := range t.journal.Changes {
+		c := &t.journal.Changes[i]
+		_, err := os.Lstat(t.targetPath(c.Path))
+		c.Existed = err == nil
+	}
+	t.journal.Status = StatusCommitting
+	if err := t.saveJournal(); err != nil {
+		os.RemoveAll(t.dir)
+		return err
+	}
+
+	for _, c := range t.journal.Changes {
+		if err := t.apply(c); err != nil {
+			if rbErr := undo(t.root, t.journal); rbErr != nil {
+				return fmt.Errorf("failed to apply %s: %v; restoring the previous files also failed: %w", c.Path, err, rbErr)
+			}
+			os.RemoveAll(t.dir)
+			return fmt.Errorf("failed to apply %s: %w", c.Path, err)
+		}
+	}
+
+	t.journal.Status = StatusCommitted
+	if err := t.saveJournal(); err != nil {
+		return err
+	}
+	os.RemoveAll(filepath.Join(t.dir, "staged"))
+	return prune(t.root)
+}
+
+// Abort discards a transaction that has not been committed.
+func (t *Transaction) Abort() {
+	if t.done {
+		return
+	}
+	t.done = true
+	os.RemoveAll(t.dir)
+}
+
+func (t *Transaction) apply(c Change) error {
+	target := t.targetPath(c.Path)
+	if c.Existed {
+		backup := backupPath(t.dir, c.Path)
+		if err := os.MkdirAll(filepath.Dir(backup), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(target, backup); err != nil {
+			return err
+		}
+	}
+	if c.Delete {
+		pruneEmptyDirs(t.root, filepath.Dir(target))
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Rename(t.stagedPath(c.Path), target)
+}
+
+// Rollback undoes the most recent transaction below root, whether it was
+// committed or interrupted, and returns its journal. Calling it again undoes
+// the transaction before that, as long as it is still kept.
+func Rollback(root string) (*Journal, error) {
+	journals, err := List(root)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(journals) - 1; i >= 0; i-- {
+		j := journals[i]
+		if j.Status == StatusPending {
+			continue
+		}
+		if err := undo(root, j); err != nil {
+			return nil, fmt.Errorf("failed to roll back %s: %w", j.Description, err)
+		}
+		if err := os.RemoveAll(transactionDir(root, j.ID)); err != nil {
+			return nil, err
+		}
+		return &j, nil
+	}
+	return nil, ErrNothingToRollBack
+}
+
+// undo restores the files changed by the journal, in reverse order. Changes
+// that were never applied are skipped.
+func undo(root string, j Journal) error {
+	dir := transactionDir(root, j.ID)
+	for i := len(j.Changes) - 1; i >= 0; i-- {
+		c := j.Changes[i]
+		target := filepath.Join(root, filepath.FromSlash(c.Path))
+
+		if !c.Existed {
+			if _, err := os.Lstat(target); c.Delete || err != nil {
+				// Nothing was there before and nothing was put there.
+				continue
+			}
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+			pruneEmptyDirs(root, filepath.Dir(target))
+			continue
+		}
+
+		backup := backupPath(dir, c.Path)
+		if _, err := os.Lstat(backup); os.IsNotExist(err) {
+			// The commit stopped before this file was touched.
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := os.Rename(backup, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns the journals of the transactions kept below root, oldest
+// first.
+func List(root string) ([]Journal, error) {
+	entries, err := os.ReadDir(filepath.Join(root, filepath.FromSlash(Dir)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var journals []Journal
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(transactionDir(root, entry.Name()), journalName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read transaction %s: %w", entry.Name(), err)
+		}
+		var j Journal
+		if err := json.Unmarshal(data, &j); err != nil {
+			return nil, fmt.Errorf("invalid journal for transaction %s: %w", entry.Name(), err)
+		}
+		journals = append(journals, j)
+	}
+	sort.Slice(journals, func(i, k int) bool { return journals[i].ID < journals[k].ID })
+	return journals, nil
+}
+
+// prune drops the oldest committed transactions beyond MaxHistory.
+func prune(root string) error {
+	journals, err := List(root)
+	if err != nil {
+		return err
+	}
+	var committed []Journal
+	for _, j := range journals {
+		if j.Status == StatusCommitted {
+			committed = append(committed, j)
+		}
+	}
+	for len(committed) > MaxHistory {
+		if err := os.RemoveAll(transactionDir(root, committed[0].ID)); err != nil {
+			return err
+		}
+		committed = committed[1:]
+	}
+	return nil
+}
+
+func (t *Transaction) saveJournal() error {
+	data, err := json.MarshalIndent(t.journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(t.dir, journalName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write journal: %w", err)
+	}
+	return nil
+}
+
+func (t *Transaction) stagedPath(path string) string {
+	return filepath.Join(t.dir, "staged", filepath.FromSlash(path))
+}
+
+func (t *Transaction) targetPath(path string) string {
+	return filepath.Join(t.root, filepath.FromSlash(path))
+}
+
+func transactionDir(root, id string) string {
+	return filepath.Join(root, filepath.FromSlash(Dir), id)
+}
+
+func backupPath(dir, path string) string {
+	return filepath.Join(dir, "backup", filepath.FromSlash(path))
+}
+
+func verifyFile(path, expected string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if actual := hex.EncodeToString(sum[:]); actual != expected {
+		return fmt.Errorf("hash mismatch: expected %s, got %s", expected, actual)
+	}
+	return nil
+}
+
+// pruneEmptyDirs removes dir and its parents while they are empty, stopping
+// at the top-level folders of root such as Library.
+func pruneEmptyDirs(root, dir string) {
+	for {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil || rel == "." || !strings.Contains(filepath.ToSlash(rel), "/") {
+			return
+		}
+		if os.Remove(dir) != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
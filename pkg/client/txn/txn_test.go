@@ -0,0 +1,162 @@
+package txn
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	path := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create %s: %v", rel, err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", rel, err)
+	}
+}
+
+func readFile(t *testing.T, root, rel string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+	if os.IsNotExist(err) {
+		return "<missing>"
+	}
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", rel, err)
+	}
+	return string(data)
+}
+
+func TestCommitAndRollback(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "Library/A/a.hsl", "a v1")
+	writeFile(t, root, "Library/A/old.hsl", "old")
+
+	tx, err := Begin(root, "install a 2.0.0")
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	tx.Write("Library/A/a.hsl", []byte("a v2"))
+	tx.Write("Library/B/b.hsl", []byte("b"))
+	tx.Delete("Library/A/old.hsl")
+
+	if got := readFile(t, root, "Library/A/a.hsl"); got != "a v1" {
+		t.Errorf("Staged changes should not touch the root before commit, got %q", got)
+	}
+
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Failed to commit: %v", err)
+	}
+	if got := readFile(t, root, "Library/A/a.hsl"); got != "a v2" {
+		t.Errorf("Expected a v2, got %q", got)
+	}
+	if got := readFile(t, root, "Library/B/b.hsl"); got != "b" {
+		t.Errorf("Expected b, got %q", got)
+	}
+	if got := readFile(t, root, "Library/A/old.hsl"); got != "<missing>" {
+		t.Errorf("Expected old.hsl to be deleted, got %q", got)
+	}
+
+	journal, err := Rollback(root)
+	if err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if journal.Description != "install a 2.0.0" {
+		t.Errorf("Rolled back the wrong transaction: %+v", journal)
+	}
+	if got := readFile(t, root, "Library/A/a.hsl"); got != "a v1" {
+		t.Errorf("Expected a v1 after rollback, got %q", got)
+	}
+	if got := readFile(t, root, "Library/A/old.hsl"); got != "old" {
+		t.Errorf("Expected old.hsl to be restored, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(root, "Library", "B")); !os.IsNotExist(err) {
+		t.Errorf("Expected the folder added by the transaction to be removed")
+	}
+
+	if _, err := Rollback(root); !errors.Is(err, ErrNothingToRollBack) {
+		t.Errorf("Expected nothing left to roll back, got %v", err)
+	}
+}
+
+func TestFailedCommitRestoresFiles(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "Library/a.hsl", "a v1")
+	writeFile(t, root, "blocker", "not a folder")
+
+	tx, err := Begin(root, "install broken")
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	tx.Write("Library/a.hsl", []byte("a v2"))
+	tx.Write("blocker/file.hsl", []byte("cannot be written"))
+
+	if err := tx.Commit(); err == nil {
+		t.Fatalf("Expected the commit to fail")
+	}
+	if got := readFile(t, root, "Library/a.hsl"); got != "a v1" {
+		t.Errorf("Expected a v1 to be restored, got %q", got)
+	}
+
+	journals, err := List(root)
+	if err != nil || len(journals) != 0 {
+		t.Errorf("Expected the failed transaction to be discarded, got %+v, %v", journals, err)
+	}
+}
+
+func TestInterruptedCommitBlocksBegin(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, root, "Library/a.hsl", "a v1")
+
+	tx, err := Begin(root, "install a")
+	if err != nil {
+		t.Fatalf("Failed to begin: %v", err)
+	}
+	tx.Write("Library/a.hsl", []byte("a v2"))
+
+	// Simulate a crash after the old file was backed up.
+	tx.journal.Changes[0].Existed = true
+	tx.journal.Status = StatusCommitting
+	tx.saveJournal()
+	os.MkdirAll(filepath.Dir(backupPath(tx.dir, "Library/a.hsl")), 0755)
+	os.Rename(filepath.Join(root, "Library", "a.hsl"), backupPath(tx.dir, "Library/a.hsl"))
+
+	if _, err := Begin(root, "install b"); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("Expected Begin to refuse, got %v", err)
+	}
+
+	if _, err := Rollback(root); err != nil {
+		t.Fatalf("Failed to roll back: %v", err)
+	}
+	if got := readFile(t, root, "Library/a.hsl"); got != "a v1" {
+		t.Errorf("Expected a v1 to be restored, got %q", got)
+	}
+	if _, err := Begin(root, "install b"); err != nil {
+		t.Errorf("Expected Begin to succeed after rollback, got %v", err)
+	}
+}
+
+func TestHistoryIsPruned(t *testing.T) {
+	root := t.TempDir()
+	for i := 0; i < MaxHistory+2; i++ {
+		tx, err := Begin(root, "install")
+		if err != nil {
+			t.Fatalf("Failed to begin: %v", err)
+		}
+		tx.Write("Library/a.hsl", []byte{byte(i)})
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+	}
+
+	journals, err := List(root)
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	if len(journals) != MaxHistory {
+		t.Errorf("Expected %d transactions to be kept, got %d", MaxHistory, len(journals))
+	}
+}
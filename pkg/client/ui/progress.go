@@ -0,0 +1,227 @@
+package ui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/mattn/go-isatty"
+)
+
+const barWidth = 30
+
+// Progress shows the progress of tasks running concurrently: a live bar per
+// task when out is a terminal, and one line per event otherwise.
+type Progress struct {
+	out     io.Writer
+	program *tea.Program
+	done    chan struct{}
+
+	mu sync.Mutex
+}
+
+// NewProgress starts showing progress on out. Call Wait when every task is
+// done.
+func NewProgress(out io.Writer) *Progress {
+	p := &Progress{out: out}
+	if f, ok := out.(*os.File); ok && isatty.IsTerminal(f.Fd()) {
+		p.program = tea.NewProgram(progressModel{}, tea.WithOutput(out), tea.WithInput(nil))
+		p.done = make(chan struct{})
+		go func() {
+			defer close(p.done)
+			if _, err := p.program.Run(); err != nil {
+				fmt.Fprintf(out, "Error running progress display: %v\n", err)
+			}
+		}()
+	}
+	return p
+}
+
+// Track adds a task called name.
+func (p *Progress) Track(name string) *Task {
+	t := &Task{progress: p, name: name, total: -1}
+	if p.program != nil {
+		p.program.Send(taskMsg{name: name, total: -1})
+	}
+	return t
+}
+
+// Wait stops the live display, leaving its last frame on screen.
+func (p *Progress) Wait() {
+	if p.program == nil {
+		return
+	}
+	p.program.Quit()
+	<-p.done
+}
+
+func (p *Progress) printf(format string, args ...interface{}) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.out, format, args...)
+}
+
+// Task is one tracked task. Writing to it counts bytes towards its total.
+type Task struct {
+	progress *Progress
+	name     string
+
+	mu      sync.Mutex
+	current int64
+	total   int64
+}
+
+// SetTotal sets the number of bytes the task expects, or -1 if unknown.
+func (t *Task) SetTotal(total int64) {
+	t.mu.Lock()
+	t.total = total
+	current := t.current
+	t.mu.Unlock()
+	t.send(taskMsg{name: t.name, current: current, total: total})
+}
+
+func (t *Task) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	t.current += int64(len(p))
+	current, total := t.current, t.total
+	t.mu.Unlock()
+	t.send(taskMsg{name: t.name, current: current, total: total})
+	return len(p), nil
+}
+
+// Logf shows a message about the task.
+func (t *Task) Logf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if t.progress.program == nil {
+		t.progress.printf("%s: %s\n", t.name, message)
+		return
+	}
+	t.mu.Lock()
+	current, total := t.current, t.total
+	t.mu.Unlock()
+	t.send(taskMsg{name: t.name, current: current, total: total, status: message})
+}
+
+// Warnf shows a warning about the task. On a terminal it is printed above the
+// progress bars so that it stays visible.
+func (t *Task) Warnf(format string, args ...interface{}) {
+	message := fmt.Sprintf("Warning: "+format, args...)
+	if t.progress.program == nil {
+		t.progress.printf("%s: %s\n", t.name, message)
+		return
+	}
+	t.progress.program.Println(t.name + ": " + message)
+}
+
+// Done marks the task as finished, failed if err is set.
+func (t *Task) Done(err error) {
+	t.mu.Lock()
+	current, total := t.current, t.total
+	t.mu.Unlock()
+
+	if t.progress.program == nil {
+		if err != nil {
+			t.progress.printf("%s: failed: %v\n", t.name, err)
+		} else {
+			t.progress.printf("%s: done\n", t.name)
+		}
+		return
+	}
+	t.send(taskMsg{name: t.name, current: current, total: total, finished: true, err: err})
+}
+
+func (t *Task) send(msg taskMsg) {
+	if t.progress.program != nil {
+		t.progress.program.Send(msg)
+	}
+}
+
+// taskMsg updates the state of a task in the live display.
+type taskMsg struct {
+	name     string
+	current  int64
+	total    int64
+	status   string
+	finished bool
+	err      error
+}
+
+type progressModel struct {
+	tasks []taskMsg
+}
+
+func (m progressModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m progressModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case taskMsg:
+		for i := range m.tasks {
+			if m.tasks[i].name == msg.name {
+				if msg.status == "" {
+					msg.status = m.tasks[i].status
+				}
+				m.tasks[i] = msg
+				return m, nil
+			}
+		}
+		m.tasks = append(m.tasks, msg)
+	}
+	return m, nil
+}
+
+func (m progressModel) View() string {
+	var b strings.Builder
+
+	width := 0
+	for _, t := range m.tasks {
+		if len(t.name) > width {
+			width = len(t.name)
+		}
+	}
+
+	for _, t := range m.tasks {
+		b.WriteString(fmt.Sprintf("%-*s %s ", width, t.name, bar(t.current, t.total, t.finished && t.err == nil)))
+		switch {
+		case t.err != nil:
+			b.WriteString("failed: " + t.err.Error())
+		case t.finished:
+			b.WriteString(fmt.Sprintf("done %s", formatBytes(t.current)))
+		case t.total > 0:
+			b.WriteString(fmt.Sprintf("%s / %s", formatBytes(t.current), formatBytes(t.total)))
+		default:
+			b.WriteString(t.status)
+		}
+		b.WriteString("\n")
+	}
+
+	return b.String()
+}
+
+func bar(current, total int64, complete bool) string {
+	filled := 0
+	switch {
+	case complete:
+		filled = barWidth
+	case total > 0:
+		filled = int(current * barWidth / total)
+		if filled > barWidth {
+			filled = barWidth
+		}
+	}
+	return "[" + strings.Repeat("#", filled) + strings.Repeat("-", barWidth-filled) + "]"
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f kB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
@@ -0,0 +1,51 @@
+package ui
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPlainProgress(t *testing.T) {
+	out := new(bytes.Buffer)
+	p := NewProgress(out)
+
+	a := p.Track("lib-a")
+	b := p.Track("lib-b")
+	a.Logf("Using cached %s", "lib-a 1.0.0")
+	a.Warnf("package is not signed")
+	a.Done(nil)
+	b.Done(errors.New("download failed"))
+	p.Wait()
+
+	want := "lib-a: Using cached lib-a 1.0.0\nlib-a: Warning: package is not signed\nlib-a: done\nlib-b: failed: download failed\n"
+	if out.String() != want {
+		t.Errorf("Unexpected output.\nExpected: %q\nGot: %q", want, out.String())
+	}
+}
+
+func TestProgressView(t *testing.T) {
+	var m progressModel
+	for _, msg := range []taskMsg{
+		{name: "lib-a", total: -1},
+		{name: "long-library", total: -1},
+		{name: "lib-a", current: 512, total: 2048},
+		{name: "long-library", status: "Using cached long-library 1.0.0"},
+		{name: "long-library", current: 10, total: 10, finished: true},
+	} {
+		model, _ := m.Update(msg)
+		m = model.(progressModel)
+	}
+
+	lines := strings.Split(strings.TrimSpace(m.View()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a line per task, got %q", lines)
+	}
+	if want := "lib-a        [#######-----------------------] 512 B / 2.0 kB"; lines[0] != want {
+		t.Errorf("Unexpected line.\nExpected: %q\nGot: %q", want, lines[0])
+	}
+	if want := "long-library [##############################] done 10 B"; lines[1] != want {
+		t.Errorf("Unexpected line.\nExpected: %q\nGot: %q", want, lines[1])
+	}
+}